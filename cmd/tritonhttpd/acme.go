@@ -0,0 +1,10 @@
+//go:build acme
+
+package main
+
+import "cse224/tritonhttp"
+
+// newACMEManager returns the manager of -acme-cache and -acme-email.
+func newACMEManager(s *tritonhttp.Server, cacheDir, email string) (tritonhttp.ACMEManager, error) {
+	return s.NewACMEManager(cacheDir, email), nil
+}
@@ -0,0 +1,14 @@
+//go:build !acme
+
+package main
+
+import (
+	"errors"
+
+	"cse224/tritonhttp"
+)
+
+// newACMEManager fails, as -acme-cache needs a build with -tags acme.
+func newACMEManager(s *tritonhttp.Server, cacheDir, email string) (tritonhttp.ACMEManager, error) {
+	return nil, errors.New("-acme-cache needs tritonhttpd built with -tags acme")
+}
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"cse224/tritonhttp"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
 	currDir, err := os.Getwd()
 	if err != nil {
 		log.Fatalf("Could not get current working directory: %v", err)
@@ -20,16 +33,80 @@ func main() {
 
 	// Parse command line flags
 	var port = flag.Int("port", 8080, "the localhost port to listen on")
+	var network = flag.String("network", "tcp", "tcp to accept IPv4 and IPv6 clients, tcp4 for IPv4 only, tcp6 for IPv6 only")
+	var iface = flag.String("interface", "", "network interface to listen on, e.g. eth0 (empty listens on all of them)")
 	var vh_config_path = flag.String("vh_config", default_vh_config_path, "path to the virtual hosting config file")
 	var docroot_dirs_path = flag.String("docroot", default_docroot, "path to the directory that contains all docroot dirs")
+	var webdav = flag.Bool("webdav", false, "answer read-only WebDAV requests (PROPFIND, OPTIONS)")
+	var uploads = flag.Bool("uploads", false, "accept PUT uploads into the docroots")
+	var tlsCert = flag.String("tls-cert", "", "PEM certificate file to serve HTTPS with, instead of HTTP (needs -tls-key)")
+	var tlsKey = flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	var certCheck = flag.Duration("cert-check", tritonhttp.DefaultCertCheckInterval, "how often to check -tls-cert and -tls-key for a renewed certificate")
+	var acmeCache = flag.String("acme-cache", "", "directory to keep certificates obtained from Let's Encrypt for the virtual hosts in, serving HTTPS with them (empty disables ACME; needs -tags acme)")
+	var acmeEmail = flag.String("acme-email", "", "contact address for notices from Let's Encrypt about the certificates of -acme-cache")
+	var httpPort = flag.Int("http-port", 0, "with HTTPS, also serve plain HTTP on this port, e.g. 80 for the HTTP-01 challenges of -acme-cache (0 disables it)")
+	var redirectHTTPS = flag.Bool("redirect-https", false, "redirect GET and HEAD requests on -http-port to HTTPS on -port instead of serving them")
+	var http3 = flag.Bool("http3", false, "with HTTPS, also serve HTTP/3 (experimental, when built with -tags http3) on the UDP port of -port")
+	var h2c = flag.Bool("h2c", false, "also serve cleartext HTTP/2 (prior knowledge and Upgrade: h2c)")
+	var transcode = flag.Bool("transcode", false, "transcode text files to the charset named by Accept-Charset")
+	var compress = flag.Bool("compress", false, "compress text-like files with gzip (or brotli and zstd, when built with -tags 'brotli zstd') as Accept-Encoding allows")
+	var compressMin = flag.Int64("compress-min", 0, "size in bytes of the smallest file to compress (0 means 256)")
+	var compressTypes = flag.String("compress-types", "", "comma-separated MIME types or prefixes like text/ to compress (empty means text-like types)")
+	var compressExclude = flag.String("compress-exclude", "", "comma-separated MIME types or prefixes never to compress")
+	var precompressed = flag.Bool("precompressed", false, "serve the .br/.zst/.gz sidecar of a file, e.g. app.js.gz, when Accept-Encoding allows")
+	var digests = flag.Bool("digests", false, "send SHA-256 Repr-Digest and Digest headers for served files")
+	var tunnels = flag.String("tunnel", "", "comma-separated host:port targets the CONNECT method may tunnel to")
+	var proxyHosts = flag.String("proxy", "", "comma-separated host names to forward absolute-form GET requests to")
+	var forwarded = flag.String("forwarded", "append", "how proxied requests carry the client address: append to the Forwarded headers of the client, replace them, or off")
+	var proxyCache = flag.Int64("proxy-cache", 0, "bytes of upstream responses to cache for proxied virtual hosts (0 disables caching)")
+	var immutable = flag.String("immutable", "", "regexp matching fingerprinted asset names to serve as immutable, or \"default\" for common bundler names (empty disables)")
+	var dev = flag.Bool("dev", false, "development mode: watch the docroots for changes and disable caching")
+	var liveReload = flag.Bool("livereload", false, "in development mode, reload HTML pages in the browser when a watched file changes")
+	var transferFile = flag.String("transfer-file", "", "JSON file to keep the bytes sent per virtual host in across restarts")
+	var maxRequests = flag.Int("max-requests", 0, "requests to serve per keep-alive connection before closing it (0 means no limit)")
+	var grace = flag.Duration("grace", tritonhttp.DefaultShutdownGrace, "how long in-flight requests may take to finish on SIGTERM before their connections are closed")
+	var drainDelay = flag.Duration("drain-delay", 0, "how long to keep serving on SIGTERM, with the readiness check failing, before shutting down")
+	var admin = flag.String("admin", "", "path prefix to serve the admin API under, e.g. /_admin/ (empty disables it)")
 	flag.Parse()
 
 	// Log server configs
 	fmt.Println()
 	log.Print("Server configs:")
 	log.Printf("  port: %v", *port)
+	log.Printf("  network: %v", *network)
+	log.Printf("  interface: %v", *iface)
 	log.Printf("  path to virtual hosts config file: %v", *vh_config_path)
 	log.Printf("  path to docroot directories: %v", *docroot_dirs_path)
+	log.Printf("  webdav: %v", *webdav)
+	log.Printf("  uploads: %v", *uploads)
+	log.Printf("  TLS certificate: %v", *tlsCert)
+	log.Printf("  TLS key: %v", *tlsKey)
+	log.Printf("  certificate check interval: %v", *certCheck)
+	log.Printf("  ACME cache: %v", *acmeCache)
+	log.Printf("  ACME email: %v", *acmeEmail)
+	log.Printf("  plain HTTP port: %v", *httpPort)
+	log.Printf("  redirect to HTTPS: %v", *redirectHTTPS)
+	log.Printf("  HTTP/3: %v", *http3)
+	log.Printf("  h2c: %v", *h2c)
+	log.Printf("  transcode: %v", *transcode)
+	log.Printf("  compress: %v", *compress)
+	log.Printf("  compress min size: %v", *compressMin)
+	log.Printf("  compress types: %v", *compressTypes)
+	log.Printf("  compress excluded types: %v", *compressExclude)
+	log.Printf("  precompressed: %v", *precompressed)
+	log.Printf("  digests: %v", *digests)
+	log.Printf("  tunnel targets: %v", *tunnels)
+	log.Printf("  proxy hosts: %v", *proxyHosts)
+	log.Printf("  forwarded headers: %v", *forwarded)
+	log.Printf("  proxy cache bytes: %v", *proxyCache)
+	log.Printf("  immutable assets: %v", *immutable)
+	log.Printf("  transfer file: %v", *transferFile)
+	log.Printf("  dev: %v", *dev)
+	log.Printf("  live reload: %v", *liveReload)
+	log.Printf("  admin API: %v", *admin)
+	log.Printf("  max requests per connection: %v", *maxRequests)
+	log.Printf("  shutdown grace: %v", *grace)
+	log.Printf("  drain delay: %v", *drainDelay)
 	fmt.Println()
 
 	virtualHosts := tritonhttp.ParseVHConfigFile(*vh_config_path, *docroot_dirs_path)
@@ -38,11 +115,128 @@ func main() {
 	addr := fmt.Sprintf(":%v", *port)
 
 	log.Printf("Starting TritonHTTP server")
-	log.Printf("You can browse the website at http://localhost:%v/", *port)
+	https := *tlsCert != "" || *acmeCache != ""
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	log.Printf("You can browse the website at %v://localhost:%v/", scheme, *port)
 	s := &tritonhttp.Server{
-		Addr:         addr,
-		VirtualHosts: virtualHosts,
-		DocRoot:      *docroot_dirs_path,
+		Addr:                addr,
+		Network:             *network,
+		Interface:           *iface,
+		VirtualHosts:        virtualHosts,
+		VirtualHostSettings: tritonhttp.ParseVHSettingsFile(*vh_config_path),
+		ListenAddrs:         tritonhttp.ParseListenAddrs(*vh_config_path),
+		DocRoot:             *docroot_dirs_path,
+		WebDAV:              *webdav,
+		Uploads:             *uploads,
+		H2C:                 *h2c,
+		HTTP3:               *http3,
+		TranscodeCharsets:   *transcode,
+		Compress:            *compress,
+		Precompressed:       *precompressed,
+		ContentDigests:      *digests,
+		ProxyCacheBytes:     *proxyCache,
+		Forwarded:           *forwarded,
+		TransferFile:        *transferFile,
+		Dev:                 *dev,
+		LiveReload:          *liveReload,
+		DrainDelay:          *drainDelay,
+		MaxRequestsPerConn:  *maxRequests,
+		CertCheckInterval:   *certCheck,
+	}
+	s.CompressionPolicy.MinSize = *compressMin
+	if *compressTypes != "" {
+		s.CompressionPolicy.Types = strings.Split(*compressTypes, ",")
+	}
+	if *compressExclude != "" {
+		s.CompressionPolicy.ExcludeTypes = strings.Split(*compressExclude, ",")
+	}
+	if *tunnels != "" {
+		s.TunnelHosts = strings.Split(*tunnels, ",")
+	}
+	switch *immutable {
+	case "":
+	case "default":
+		s.ImmutableAssets = tritonhttp.DefaultImmutableAssets
+	default:
+		s.ImmutableAssets = regexp.MustCompile(*immutable)
+	}
+	if *admin != "" {
+		s.HandleAdmin(*admin)
+	}
+	if *proxyHosts != "" {
+		s.ProxyHosts = strings.Split(*proxyHosts, ",")
+	}
+	if *acmeCache != "" {
+		acme, err := newACMEManager(s, *acmeCache, *acmeEmail)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.ACME = acme
+	}
+	go reloadListenAddrs(s, *vh_config_path, *grace)
+	serve := s.ListenAndServe
+	if https {
+		serve = func() error { return s.ListenAndServeTLS(*tlsCert, *tlsKey) }
+		if *httpPort != 0 {
+			go servePlainHTTP(s, *network, *httpPort, *redirectHTTPS, *port)
+		}
+	}
+	run(s, serve, *grace)
+}
+
+// reloadListenAddrs applies the "listen" addresses of the config file at
+// path to s on every SIGHUP, keeping the port given on the command line.
+func reloadListenAddrs(s *tritonhttp.Server, path string, grace time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		addrs := append([]string{s.Addr}, tritonhttp.ParseListenAddrs(path)...)
+		log.Printf("Received SIGHUP, listening on %v", addrs)
+		if err := s.SetListenAddrs(addrs, grace); err != nil {
+			log.Printf("Failed to change the listen addresses: %v", err)
+		}
+	}
+}
+
+// servePlainHTTP serves s over plain HTTP on port, next to HTTPS on
+// httpsPort, until s is closed. With redirect, requests are redirected to
+// HTTPS instead of being served.
+func servePlainHTTP(s *tritonhttp.Server, network string, port int, redirect bool, httpsPort int) {
+	addr := fmt.Sprintf(":%v", port)
+	var err error
+	if redirect {
+		err = s.ListenAndRedirectHTTPS(addr, strconv.Itoa(httpsPort))
+	} else {
+		var ln net.Listener
+		if ln, err = net.Listen(network, addr); err == nil {
+			err = s.Serve(ln)
+		}
+	}
+	if !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
+	}
+}
+
+// run serves s with serve, ListenAndServe or ListenAndServeTLS, until
+// SIGTERM or an interrupt, then shuts it down, giving in-flight requests up
+// to grace to finish, and returns, so the process exits with status 0 as
+// container runtimes and systemd expect.
+func run(s *tritonhttp.Server, serve func() error, grace time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		sig := <-signals
+		log.Printf("Received %v, stopping within %v", sig, s.DrainDelay+grace)
+		summary := s.Shutdown(grace)
+		log.Printf("Stopped: %d connections drained, %d aborted", summary.Drained, summary.Aborted)
+		close(stopped)
+	}()
+	if err := serve(); !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
 	}
-	log.Fatal(s.ListenAndServe())
+	<-stopped
 }
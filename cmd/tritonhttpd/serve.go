@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"cse224/tritonhttp"
+)
+
+// serveHost is the name of the only virtual host of the serve subcommand;
+// requests for any other host are served by it too.
+const serveHost = "localhost"
+
+// serve runs the serve subcommand,
+//
+//	tritonhttpd serve [dir] [-port 8080]
+//
+// which serves dir, the current directory by default, without a config
+// file: as a single virtual host answering every Host, with directory
+// listings and with caching disabled, so it can stand in for
+// "python -m http.server". Flags may come before or after dir.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\t%s serve [flags] [dir]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	port := fs.Int("port", 8080, "the localhost port to listen on")
+	_ = fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+		_ = fs.Parse(fs.Args()[1:])
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	docroot, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatalf("Could not resolve %v: %v", dir, err)
+	}
+
+	log.Printf("Serving %v", docroot)
+	log.Printf("You can browse it at http://localhost:%v/", *port)
+	s := &tritonhttp.Server{
+		Addr:         fmt.Sprintf(":%v", *port),
+		DocRoot:      docroot,
+		VirtualHosts: map[string]string{serveHost: docroot},
+		VirtualHostSettings: map[string]tritonhttp.VirtualHostSettings{
+			serveHost: {MissingIndex: tritonhttp.MissingIndexAutoIndex},
+		},
+		DefaultHost: serveHost,
+		Dev:         true,
+	}
+	run(s, s.ListenAndServe, tritonhttp.DefaultShutdownGrace)
+}
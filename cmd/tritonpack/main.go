@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// $ tritonpack docroot_dirs/htdocs1
+// $ tritonpack -min 1024 -br=false docroot_dirs/htdocs1
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\t%s [flags] docroot\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	minSize := flag.Int64("min", 256, "leave files smaller than this many bytes uncompressed")
+	maxRatio := flag.Float64("ratio", 0.9, "keep a compressed sibling only if it is at most this fraction of the original size")
+	gz := flag.Bool("gz", true, "generate .gz siblings")
+	br := flag.Bool("br", true, "generate .br siblings, if the brotli command is installed")
+	zst := flag.Bool("zst", true, "generate .zst siblings, if the zstd command is installed")
+
+	flag.Usage = usage
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		usage()
+	}
+	docroot := flag.Arg(0)
+
+	opts := options{minSize: *minSize, maxRatio: *maxRatio}
+	if *gz {
+		opts.encoders = append(opts.encoders, gzipEncoder)
+	}
+	if *br {
+		if enc := brotliEncoder(); enc != nil {
+			opts.encoders = append(opts.encoders, *enc)
+		} else {
+			log.Printf("brotli command not found, skipping .br siblings")
+		}
+	}
+	if *zst {
+		if enc := zstdEncoder(); enc != nil {
+			opts.encoders = append(opts.encoders, *enc)
+		} else {
+			log.Printf("zstd command not found, skipping .zst siblings")
+		}
+	}
+
+	manifest, err := pack(docroot, opts)
+	if err != nil {
+		log.Fatalf("Failed to pack %v: %v", docroot, err)
+	}
+	var saved, total int64
+	for _, entry := range manifest {
+		total += entry.Size
+		if size, ok := entry.Encodings["gzip"]; ok {
+			saved += entry.Size - size
+		}
+	}
+	log.Printf("Packed %d files of %d bytes in %v, gzip saves %d bytes", len(manifest), total, docroot, saved)
+}
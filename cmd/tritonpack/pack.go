@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"cse224/tritonhttp"
+)
+
+// manifestName is the name of the manifest written at the top of the
+// docroot.
+const manifestName = ".tritonpack.json"
+
+// compressibleTypes lists the MIME type prefixes worth compressing; images,
+// video and archives are compressed already.
+var compressibleTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+	"font/ttf",
+	"font/otf",
+}
+
+// encoder compresses data into the sibling file with suffix ext.
+type encoder struct {
+	name string
+	ext  string
+	// encode returns data compressed
+	encode func(data []byte) ([]byte, error)
+}
+
+var gzipEncoder = encoder{"gzip", ".gz", func(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}}
+
+// brotliEncoder runs the brotli command, which is not part of the Go
+// distribution; it is nil when the command is not installed.
+func brotliEncoder() *encoder {
+	path, err := exec.LookPath("brotli")
+	if err != nil {
+		return nil
+	}
+	return &encoder{"br", ".br", func(data []byte) ([]byte, error) {
+		cmd := exec.Command(path, "--best", "--stdout", "-")
+		cmd.Stdin = bytes.NewReader(data)
+		return cmd.Output()
+	}}
+}
+
+// zstdEncoder runs the zstd command, like brotliEncoder; it is nil when the
+// command is not installed.
+func zstdEncoder() *encoder {
+	path, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil
+	}
+	return &encoder{"zstd", ".zst", func(data []byte) ([]byte, error) {
+		cmd := exec.Command(path, "-19", "-q", "-c", "-")
+		cmd.Stdin = bytes.NewReader(data)
+		return cmd.Output()
+	}}
+}
+
+// manifestEntry describes a packed file in the manifest.
+type manifestEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Encodings maps the content codings generated, e.g. "gzip", to the
+	// size of the sibling file
+	Encodings map[string]int64 `json:"encodings"`
+}
+
+// options configure pack.
+type options struct {
+	// minSize is the size below which files are left alone
+	minSize int64
+	// maxRatio is the largest compressed to original size ratio for
+	// which a sibling is kept
+	maxRatio float64
+	encoders []encoder
+}
+
+// compressible reports whether the file at path is worth compressing.
+func compressible(path string) bool {
+	for _, ext := range []string{".gz", ".br", ".zst"} {
+		if strings.HasSuffix(path, ext) {
+			return false
+		}
+	}
+	mimeType := tritonhttp.MIMETypeByExtension(filepath.Ext(path))
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pack generates the compressed siblings of the compressible files under
+// docroot and writes the manifest. Siblings that are newer than their file
+// are kept as they are; siblings that do not save enough are removed.
+// It returns the manifest, keyed by slash-separated path.
+func pack(docroot string, opts options) (map[string]manifestEntry, error) {
+	manifest := make(map[string]manifestEntry)
+	err := filepath.WalkDir(docroot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() || d.Name() == manifestName || !compressible(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < opts.minSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		entry := manifestEntry{Size: info.Size(), SHA256: hex.EncodeToString(sum[:]), Encodings: make(map[string]int64)}
+		for _, enc := range opts.encoders {
+			size, err := packWith(enc, path, info, data, opts.maxRatio)
+			if err != nil {
+				return err
+			}
+			if size > 0 {
+				entry.Encodings[enc.name] = size
+			}
+		}
+		rel, err := filepath.Rel(docroot, path)
+		if err != nil {
+			return err
+		}
+		manifest["/"+filepath.ToSlash(rel)] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, writeManifest(filepath.Join(docroot, manifestName), manifest)
+}
+
+// packWith writes the sibling of the file at path, with the given info and
+// content data, compressed with enc, unless an up-to-date one exists. It
+// returns the size of the sibling, or 0 if compression does not pay off.
+func packWith(enc encoder, path string, info fs.FileInfo, data []byte, maxRatio float64) (int64, error) {
+	sibling := path + enc.ext
+	if sinfo, err := os.Stat(sibling); err == nil && !sinfo.ModTime().Before(info.ModTime()) {
+		return sinfo.Size(), nil
+	}
+	compressed, err := enc.encode(data)
+	if err != nil {
+		return 0, err
+	}
+	if float64(len(compressed)) > maxRatio*float64(len(data)) {
+		if err := os.Remove(sibling); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		return 0, nil
+	}
+	if err := os.WriteFile(sibling, compressed, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	// the sibling must not look older than the file it was made from
+	if err := os.Chtimes(sibling, info.ModTime(), info.ModTime()); err != nil {
+		return 0, err
+	}
+	return int64(len(compressed)), nil
+}
+
+// writeManifest writes manifest to path as JSON, sorted by path.
+func writeManifest(path string, manifest map[string]manifestEntry) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	docroot := t.TempDir()
+	page := strings.Repeat("<p>hello, world</p>\n", 100)
+	files := map[string]string{
+		"index.html":     page,
+		"small.css":      "a{}",
+		"photo.jpg":      page,
+		"sub/app.js":     strings.Repeat("console.log(1);\n", 100),
+		"sub/index.html": page,
+	}
+	for name, content := range files {
+		path := filepath.Join(docroot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating %v: %v\n", name, err.Error())
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing %v: %v\n", name, err.Error())
+		}
+	}
+
+	opts := options{minSize: 256, maxRatio: 0.9, encoders: []encoder{gzipEncoder}}
+	manifest, err := pack(docroot, opts)
+	if err != nil {
+		t.Fatalf("Error packing: %v\n", err.Error())
+	}
+	for _, name := range []string{"small.css.gz", "photo.jpg.gz"} {
+		if _, err := os.Stat(filepath.Join(docroot, name)); !os.IsNotExist(err) {
+			t.Fatalf("Expected no %v but got: %v\n", name, err)
+		}
+	}
+	compressed, err := os.ReadFile(filepath.Join(docroot, "index.html.gz"))
+	if err != nil {
+		t.Fatalf("Error reading index.html.gz: %v\n", err.Error())
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Error opening index.html.gz: %v\n", err.Error())
+	}
+	if data, _ := io.ReadAll(zr); string(data) != page {
+		t.Fatalf("Expected index.html.gz to decompress to index.html but got: %q\n", data)
+	}
+
+	data, err := os.ReadFile(filepath.Join(docroot, manifestName))
+	if err != nil {
+		t.Fatalf("Error reading the manifest: %v\n", err.Error())
+	}
+	var written map[string]manifestEntry
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Error parsing the manifest: %v\n", err.Error())
+	}
+	if len(written) != 3 || len(manifest) != 3 {
+		t.Fatalf("Expected 3 files in the manifest but got: %v\n", written)
+	}
+	if entry := written["/sub/app.js"]; entry.Encodings["gzip"] == 0 || entry.Encodings["gzip"] >= entry.Size {
+		t.Fatalf("Expected a gzip size for /sub/app.js but got: %+v\n", entry)
+	}
+
+	// a second run keeps the siblings that are up to date
+	opts.encoders[0].encode = func([]byte) ([]byte, error) {
+		t.Fatalf("Expected no file to be compressed again\n")
+		return nil, nil
+	}
+	if _, err := pack(docroot, opts); err != nil {
+		t.Fatalf("Error packing again: %v\n", err.Error())
+	}
+}
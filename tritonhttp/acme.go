@@ -0,0 +1,77 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"strings"
+)
+
+// ACMEChallengePath is the path prefix under which an ACME certificate
+// authority fetches the HTTP-01 challenges proving control of a host name.
+const ACMEChallengePath = "/.well-known/acme-challenge/"
+
+// ACMEManager obtains TLS certificates from an ACME certificate authority
+// and answers its challenges. *autocert.Manager, from
+// golang.org/x/crypto/acme/autocert, implements it; NewACMEManager
+// returns one configured for the virtual hosts of a server.
+type ACMEManager interface {
+	// GetCertificate returns the certificate for a TLS handshake,
+	// answering TLS-ALPN-01 challenges as well.
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	// HTTPHandler answers the HTTP-01 challenges, passing other requests
+	// to fallback.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// acmeALPNProto is the ALPN protocol of the TLS-ALPN-01 challenges of
+// ACME (RFC 8737).
+const acmeALPNProto = "acme-tls/1"
+
+// acmeChallenge reports whether req fetches an HTTP-01 challenge of ACME.
+// Challenges are only answered over plain HTTP, as the certificate
+// authority fetches them before the host has a certificate.
+func (s *Server) acmeChallenge(req *Request) bool {
+	return s.ACME != nil && req.TLS == nil &&
+		(req.Method == methodGet || req.Method == methodHead) &&
+		strings.HasPrefix(req.URL, ACMEChallengePath)
+}
+
+// serveACMEChallenge answers the challenge request req with the key
+// authorization the manager stored for its token.
+func (s *Server) serveACMEChallenge(req *Request) *Response {
+	r, err := req.httpRequest()
+	if err != nil {
+		return s.newResponse(statusBadRequest, responseOptions{req: req, detail: err.Error()})
+	}
+	w := &challengeWriter{header: make(http.Header)}
+	s.ACME.HTTPHandler(nil).ServeHTTP(w, r)
+	if w.code != 0 && w.code != http.StatusOK {
+		return s.newResponse(w.code, responseOptions{req: req, detail: strings.TrimSpace(w.body.String())})
+	}
+	res := s.newResponse(statusOK, responseOptions{req: req})
+	res.SetBody("text/plain", w.body.String())
+	res.Headers["Cache-Control"] = "no-store"
+	return res
+}
+
+// challengeWriter collects the response of the challenge handler of
+// autocert.
+type challengeWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *challengeWriter) Header() http.Header { return w.header }
+
+func (w *challengeWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *challengeWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
@@ -0,0 +1,41 @@
+//go:build acme
+
+package tritonhttp
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The Let's Encrypt manager is only compiled in with the "acme" build tag,
+// which pulls in autocert:
+//
+//	go build -tags acme ./...
+
+// NewACMEManager returns a manager for Server.ACME that obtains
+// certificates from Let's Encrypt for the virtual hosts of s, as they are
+// when a certificate is needed, and renews them before they expire.
+// Certificates and the account key are kept in cacheDir so restarts do
+// not request them again. email, if not empty, is where the certificate
+// authority sends notices about the certificates. Using the manager
+// accepts the terms of service of Let's Encrypt.
+func (s *Server) NewACMEManager(cacheDir, email string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+		HostPolicy: s.acmeHostPolicy,
+	}
+}
+
+// acmeHostPolicy lets the manager of NewACMEManager request certificates
+// for the virtual hosts only, so clients cannot make the server ask for
+// certificates for arbitrary names.
+func (s *Server) acmeHostPolicy(_ context.Context, host string) error {
+	if _, _, ok := lookupHost(s.virtualHosts(), normalizeHost(host)); !ok {
+		return fmt.Errorf("tritonhttp: %q is not a virtual host", host)
+	}
+	return nil
+}
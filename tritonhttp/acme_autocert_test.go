@@ -0,0 +1,82 @@
+//go:build acme
+
+package tritonhttp
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestNewACMEManagerChallenge(t *testing.T) {
+	cacheDir := t.TempDir()
+	// where autocert keeps the key authorization of a pending challenge
+	if err := os.WriteFile(filepath.Join(cacheDir, "token1+http-01"), []byte("token1.thumbprint"), 0600); err != nil {
+		t.Fatalf("Error writing challenge: %v\n", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		disable bool
+		host    string
+		url     string
+		code    int
+		body    string
+	}{
+		{"challenge", false, "website1", "/.well-known/acme-challenge/token1", 200, "token1.thumbprint"},
+		{"host with port", false, "website1:80", "/.well-known/acme-challenge/token1", 200, "token1.thumbprint"},
+		{"unknown token", false, "website1", "/.well-known/acme-challenge/token2", 404, ""},
+		{"not a virtual host", false, "example.com", "/.well-known/acme-challenge/token1", 403, ""},
+		{"without ACME", true, "website1", "/.well-known/acme-challenge/token1", 404, ""},
+		{"other paths", false, "website1", "/index.html", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			if !tt.disable {
+				s.ACME = s.NewACMEManager(cacheDir, "")
+			}
+			resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: "+tt.host+"\r\nConnection: close\r\n\r\n"))
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Fatalf("Expected body %q but got %q\n", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	s := newTestServer()
+	for _, host := range []string{"website1", "WEBSITE1", "website1:443"} {
+		if err := s.acmeHostPolicy(context.Background(), host); err != nil {
+			t.Fatalf("Expected a certificate to be allowed for %v: %v\n", host, err.Error())
+		}
+	}
+	if err := s.acmeHostPolicy(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "not a virtual host") {
+		t.Fatalf("Expected a certificate to be refused for example.com, got: %v\n", err)
+	}
+
+	// virtual hosts added later are covered too
+	s.SetVirtualHosts(map[string]string{"example.com": "../docroot_dirs/htdocs1"})
+	if err := s.acmeHostPolicy(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Expected a certificate to be allowed for example.com: %v\n", err.Error())
+	}
+}
+
+func TestACMEALPNProto(t *testing.T) {
+	if acmeALPNProto != acme.ALPNProto {
+		t.Fatalf("Expected the TLS-ALPN-01 protocol %q but got %q\n", acme.ALPNProto, acmeALPNProto)
+	}
+}
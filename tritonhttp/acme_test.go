@@ -0,0 +1,78 @@
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// fakeACME is an ACMEManager with no certificates, which knows the key
+// authorization of a single HTTP-01 token.
+type fakeACME struct{}
+
+func (fakeACME) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return nil, errors.New("no certificate")
+}
+
+func (fakeACME) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ACMEChallengePath+"token1" {
+			http.Error(w, "unknown token", http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, "token1.thumbprint")
+	})
+}
+
+func TestACMEChallenge(t *testing.T) {
+	tests := []struct {
+		name    string
+		disable bool
+		url     string
+		code    int
+		body    string
+	}{
+		{"challenge", false, "/.well-known/acme-challenge/token1", 200, "token1.thumbprint"},
+		{"unknown token", false, "/.well-known/acme-challenge/token2", 404, ""},
+		{"without ACME", true, "/.well-known/acme-challenge/token1", 404, ""},
+		{"other paths", false, "/index.html", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			if !tt.disable {
+				s.ACME = fakeACME{}
+			}
+			resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Fatalf("Expected body %q but got %q\n", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestTLSConfigACME(t *testing.T) {
+	s := newTestServer()
+	s.ACME = fakeACME{}
+	config, err := s.tlsConfig("", "")
+	if err != nil {
+		t.Fatalf("Error configuring TLS: %v\n", err.Error())
+	}
+	if config.GetCertificate == nil {
+		t.Fatalf("Expected certificates to be obtained with ACME\n")
+	}
+	if want := []string{"h2", "http/1.1", "acme-tls/1"}; !slices.Equal(config.NextProtos, want) {
+		t.Fatalf("Expected NextProtos %v but got %v\n", want, config.NextProtos)
+	}
+}
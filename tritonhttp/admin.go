@@ -0,0 +1,61 @@
+package tritonhttp
+
+import (
+	"encoding/json"
+	"log"
+)
+
+const jsonContentType = "application/json"
+
+// HandleAdmin registers the admin API below prefix, e.g. "/_admin/". It
+// reports on the server in JSON:
+//
+//	GET <prefix>upstreams  the health of the upstreams of proxied hosts
+//	GET <prefix>transfer   the bytes sent per virtual host
+//	GET <prefix>downloads  the download statistics of each URL served
+//	GET <prefix>ready      a readiness check, which fails with 503 once
+//	                       the server is shutting down, see DrainDelay
+//	GET <prefix>drain      the progress of the shutdown, see DrainStatus
+//
+// The API is served on every virtual host, so prefix should be hard to
+// guess or the server kept off untrusted networks.
+func (s *Server) HandleAdmin(prefix string) {
+	s.HandleFunc(prefix+"upstreams", func(req *Request) *Response {
+		return jsonResponse(s.UpstreamStatus())
+	})
+	s.HandleFunc(prefix+"transfer", func(req *Request) *Response {
+		return jsonResponse(s.TransferStats())
+	})
+	s.HandleFunc(prefix+"downloads", func(req *Request) *Response {
+		return jsonResponse(s.DownloadStats())
+	})
+	s.HandleFunc(prefix+"drain", func(req *Request) *Response {
+		return jsonResponse(s.DrainStatus())
+	})
+	s.HandleFunc(prefix+"ready", func(req *Request) *Response {
+		ready := s.Ready()
+		res := jsonResponse(map[string]bool{"ready": ready})
+		if !ready {
+			// only the status changes: the body still reports the check
+			res.StatusCode = statusServiceUnavailable
+			res.StatusText = statusText[statusServiceUnavailable]
+		}
+		return res
+	})
+}
+
+// jsonResponse returns a 200 response with v, encoded as JSON, as its body,
+// or a 500 response with a JSON error if v cannot be encoded.
+func jsonResponse(v any) *Response {
+	res := &Response{}
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode admin response: %v", err)
+		res.HandleError(statusInternalServerError)
+		res.SetBody(jsonContentType, `{"error": "failed to encode the response"}`+"\n")
+		return res
+	}
+	res.HandleOK()
+	res.SetBody(jsonContentType, string(body)+"\n")
+	return res
+}
@@ -0,0 +1,64 @@
+package tritonhttp
+
+import (
+	"hash/fnv"
+	"net"
+	"strconv"
+)
+
+// The values of VirtualHostSettings.Affinity.
+const (
+	AffinityCookie = "cookie"
+	AffinityIP     = "ip"
+)
+
+// affinityCookieName is the cookie that pins a client to an upstream.
+const affinityCookieName = "tritonhttp_upstream"
+
+// upstreamToken identifies addr in the affinity cookie without revealing
+// it, and independently of the order of the upstreams.
+func upstreamToken(addr string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(addr))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// pickUpstream chooses the upstream of the virtual host host, whose
+// settings are given, for req.
+func (s *Server) pickUpstream(req *Request, host string, settings VirtualHostSettings) (string, bool) {
+	now := s.now()
+	upstreams := settings.Upstreams
+	switch settings.Affinity {
+	case AffinityCookie:
+		if c, ok := req.Cookie(affinityCookieName); ok {
+			for i, addr := range upstreams {
+				if upstreamToken(addr) == c.Value {
+					if picked, ok := s.upstreams.pickFrom(host, upstreams, i, now); ok && picked == addr {
+						return addr, true
+					}
+				}
+			}
+		}
+	case AffinityIP:
+		ip := req.RemoteAddr
+		if addr, _, err := net.SplitHostPort(ip); err == nil {
+			ip = addr
+		}
+		if ip != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(ip))
+			return s.upstreams.pickFrom(host, upstreams, int(h.Sum32()%uint32(len(upstreams))), now)
+		}
+	}
+	return s.upstreams.pick(host, upstreams, now)
+}
+
+// setAffinityCookie pins the client of req to addr, the upstream that
+// answered res, unless its cookie already does.
+func setAffinityCookie(req *Request, res *Response, addr string) {
+	token := upstreamToken(addr)
+	if c, ok := req.Cookie(affinityCookieName); ok && c.Value == token {
+		return
+	}
+	_ = res.SetCookie(&Cookie{Name: affinityCookieName, Value: token, Path: "/", HttpOnly: true})
+}
@@ -0,0 +1,69 @@
+package tritonhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamAffinity(t *testing.T) {
+	var addrs []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+		defer upstream.Close()
+		addrs = append(addrs, strings.TrimPrefix(upstream.URL, "http://"))
+	}
+
+	get := func(s *Server, headers string) *http.Response {
+		conn := &scriptedConn{r: strings.NewReader("GET / HTTP/1.1\r\nHost: proxied\r\n" + headers + "Connection: close\r\n\r\n")}
+		s.HandleConnection(conn)
+		return parseResponse(t, conn.out.String())
+	}
+	body := func(resp *http.Response) string {
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Error reading response body: %v\n", err.Error())
+		}
+		return string(b)
+	}
+
+	t.Run("cookie", func(t *testing.T) {
+		s := newTestServer()
+		s.VirtualHostSettings = map[string]VirtualHostSettings{"proxied": {Upstreams: addrs, Affinity: AffinityCookie}}
+		first := get(s, "")
+		cookies := first.Cookies()
+		if len(cookies) != 1 || cookies[0].Name != affinityCookieName {
+			t.Fatalf("Expected an affinity cookie but got %v\n", first.Header["Set-Cookie"])
+		}
+		want := body(first)
+		for i := 0; i < 4; i++ {
+			resp := get(s, "Cookie: "+affinityCookieName+"="+cookies[0].Value+"\r\n")
+			if got := body(resp); got != want {
+				t.Fatalf("Expected sticky upstream %q but got %q\n", want, got)
+			}
+			if len(resp.Cookies()) != 0 {
+				t.Fatal("Cookie set again for a pinned client")
+			}
+		}
+		// an unknown token falls back to the rotation and pins anew
+		if resp := get(s, "Cookie: "+affinityCookieName+"=bogus\r\n"); len(resp.Cookies()) != 1 {
+			t.Fatal("Expected a new affinity cookie for an unknown token")
+		}
+	})
+
+	t.Run("ip", func(t *testing.T) {
+		s := newTestServer()
+		s.VirtualHostSettings = map[string]VirtualHostSettings{"proxied": {Upstreams: addrs, Affinity: AffinityIP}}
+		want := body(get(s, ""))
+		for i := 0; i < 4; i++ {
+			if got := body(get(s, "")); got != want {
+				t.Fatalf("Expected sticky upstream %q but got %q\n", want, got)
+			}
+		}
+	})
+}
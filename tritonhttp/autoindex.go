@@ -0,0 +1,85 @@
+package tritonhttp
+
+import (
+	"errors"
+	"html/template"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The values of VirtualHostSettings.MissingIndex.
+const (
+	MissingIndexNotFound  = "404"
+	MissingIndexForbidden = "403"
+	MissingIndexAutoIndex = "autoindex"
+)
+
+// errDirectoryForbidden is returned for directories without an index that
+// must not be listed.
+var errDirectoryForbidden = errors.New("directory has no index and must not be listed")
+
+// autoIndexPage lists the entries of a directory without index.html.
+var autoIndexPage = template.Must(template.New("autoindex").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Last modified</th><th>Size</th></tr>
+{{- if ne .Path "/"}}
+<tr><td><a href="../">../</a></td><td></td><td>-</td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td>{{.Modified}}</td><td>{{if .Dir}}-{{else}}{{.Size}}{{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// autoIndexEntry is a row of autoIndexPage.
+type autoIndexEntry struct {
+	Name     string
+	Href     string
+	Modified string
+	Size     int64
+	Dir      bool
+}
+
+// autoIndex makes the listing of dir, served at urlPath, the body of res.
+// Hidden entries, whose name starts with ".", are left out.
+func (res *Response) autoIndex(urlPath, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Path    string
+		Entries []autoIndexEntry
+	}{Path: urlPath}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		// "./" keeps names like "a:b" from reading as a URL scheme
+		row := autoIndexEntry{
+			Name:     name,
+			Href:     "./" + url.PathEscape(name),
+			Modified: FormatTime(info.ModTime()),
+			Size:     info.Size(),
+			Dir:      info.IsDir(),
+		}
+		if row.Dir {
+			row.Name += "/"
+			row.Href += "/"
+		}
+		data.Entries = append(data.Entries, row)
+	}
+	return res.RenderTemplate(autoIndexPage, data)
+}
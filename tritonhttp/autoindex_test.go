@@ -0,0 +1,42 @@
+package tritonhttp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMissingIndex(t *testing.T) {
+	tests := []struct {
+		policy string
+		code   int
+		body   []string
+	}{
+		{"", 404, nil},
+		{MissingIndexNotFound, 404, nil},
+		{MissingIndexForbidden, 403, nil},
+		{MissingIndexAutoIndex, 200, []string{"Index of /hidden/", `<a href="../">`, `<a href="./empty.html">empty.html</a>`, `<a href="./large.html">`}},
+	}
+	for _, tt := range tests {
+		s := newTestServer()
+		s.VirtualHostSettings = map[string]VirtualHostSettings{"website1": {MissingIndex: tt.policy}}
+		resp := parseResponse(t, serveRaw(t, s, "GET /hidden/ HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for policy %q but got: %v\n", tt.code, tt.policy, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		for _, want := range tt.body {
+			if !strings.Contains(string(body), want) {
+				t.Fatalf("Expected the listing to contain %q but got: %s\n", want, body)
+			}
+		}
+	}
+
+	// directories with an index are not affected
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{"website1": {MissingIndex: MissingIndexForbidden}}
+	resp := parseResponse(t, serveRaw(t, s, "GET /subdir/ HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 for a directory with an index but got: %v\n", resp.StatusCode)
+	}
+}
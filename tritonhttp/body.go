@@ -0,0 +1,235 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrBodyTooLarge is returned by the Body of a chunked request, or of one
+// of unknown length over HTTP/2 and HTTP/3, once it exceeds
+// Server.MaxBodyBytes. The length of such a body is not known in advance,
+// so it can only be capped while it is read.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// errMalformedChunk is returned by the Body of a chunked request whose
+// framing is broken.
+var errMalformedChunk = errors.New("malformed chunked encoding")
+
+// bodyReader streams the body of a request off the connection, without
+// buffering it: reads return at most the remaining bytes of the body, then
+// io.EOF. A body cut short by the client is reported as
+// io.ErrUnexpectedEOF, so handlers cannot mistake it for a complete one.
+type bodyReader struct {
+	r         io.Reader
+	remaining int64
+	// progress, if set, is called whenever body data arrives, to push the
+	// read deadline of the connection forward
+	progress func() error
+	err      error
+}
+
+// limitedBody caps a request body of unknown length that arrives over
+// HTTP/2 or HTTP/3, failing with ErrBodyTooLarge past max bytes, as
+// chunkedReader does for HTTP/1.1.
+type limitedBody struct {
+	r         io.Reader
+	read, max int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	if b.read > b.max {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func newBodyReader(r io.Reader, length int64) *bodyReader {
+	return &bodyReader{r: r, remaining: length}
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && n > 0 && b.progress != nil {
+		err = b.progress()
+	}
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// forbiddenTrailers are the fields a trailer must not carry, as they frame
+// or route the message (RFC 9110 section 6.5.1); they are dropped.
+var forbiddenTrailers = map[string]bool{
+	CONTENT_LENGTH:       true,
+	TRANSFER_ENCODING:    true,
+	HOST:                 true,
+	CONNECTION:           true,
+	"trailer":            true,
+	"content-encoding":   true,
+	"content-type":       true,
+	"content-range":      true,
+	"authorization":      true,
+	"cache-control":      true,
+	"expect":             true,
+	"max-forwards":       true,
+	"te":                 true,
+	"proxy-authenticate": true,
+}
+
+// chunkedReader decodes a request body sent with "Transfer-Encoding:
+// chunked" as it is read, like bodyReader streaming it off the connection.
+// The trailer fields after the last chunk are added to trailers, and the
+// body ends with io.EOF once they were read.
+type chunkedReader struct {
+	br     *bufio.Reader
+	limits requestLimits
+	// remaining is the number of bytes left in the current chunk
+	remaining int64
+	// read counts the bytes of the body so far, max caps them; zero
+	// means no limit
+	read     int64
+	max      int64
+	trailers map[string]string
+	// progress, if set, is called whenever body data arrives, as for
+	// bodyReader
+	progress func() error
+	err      error
+}
+
+func newChunkedReader(br *bufio.Reader, limits requestLimits, trailers map[string]string) *chunkedReader {
+	return &chunkedReader{br: br, limits: limits, trailers: trailers}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.remaining -= int64(n)
+	c.read += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && c.max > 0 && c.read > c.max {
+		err = ErrBodyTooLarge
+	}
+	if err == nil && c.remaining == 0 {
+		// the chunk data is followed by a line end
+		var line string
+		if line, err = c.readLine(); err == nil && line != "" {
+			err = errMalformedChunk
+		}
+	}
+	if err == nil && n > 0 && c.progress != nil {
+		err = c.progress()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads the size line of the next chunk, ignoring any chunk
+// extensions. After the last chunk, of size zero, it reads the trailer and
+// returns io.EOF.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.Trim(line, " \t")
+	if line == "" || len(line) > 15 || strings.Trim(line, "0123456789abcdefABCDEF") != "" {
+		return errMalformedChunk
+	}
+	size, err := strconv.ParseInt(line, 16, 64)
+	if err != nil {
+		return errMalformedChunk
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+	if err := c.readTrailer(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// readTrailer reads the trailer fields up to the empty line ending the
+// body.
+func (c *chunkedReader) readTrailer() error {
+	fields := 0
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+		fields++
+		if c.limits.maxHeaders > 0 && fields > c.limits.maxHeaders {
+			return ErrHeaderTooLarge
+		}
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return err
+		}
+		key = strings.ToLower(key)
+		if forbiddenTrailers[key] {
+			continue
+		}
+		if prev, ok := c.trailers[key]; ok {
+			value = prev + ", " + value
+		}
+		c.trailers[key] = value
+	}
+}
+
+// readLine reads a chunk size or trailer line, which the client must not
+// cut short.
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := readLineLimit(c.br, c.limits.maxLineBytes)
+	switch {
+	case errors.Is(err, errLineTooLong):
+		return "", errMalformedChunk
+	case errors.Is(err, io.EOF):
+		return "", io.ErrUnexpectedEOF
+	case err != nil:
+		return "", err
+	}
+	if c.progress != nil {
+		if err := c.progress(); err != nil {
+			return "", err
+		}
+	}
+	return line, nil
+}
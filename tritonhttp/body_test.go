@@ -0,0 +1,169 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bodyEchoServer returns a server whose "/echo" handler answers with the
+// request body it read, or with the error reading it failed with.
+func bodyEchoServer() *Server {
+	s := newTestServer()
+	s.HandleFunc("/echo", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			res.SetBody("text/plain", "error: "+err.Error())
+			return res
+		}
+		res.SetBody("text/plain", string(body))
+		return res
+	})
+	return s
+}
+
+func TestBodyTruncated(t *testing.T) {
+	s := bodyEchoServer()
+	conn := &scriptedConn{r: strings.NewReader("POST /echo HTTP/1.1\r\nHost: website1\r\nContent-Length: 10\r\n\r\nabcd")}
+	s.HandleConnection(conn)
+	resp := parseResponse(t, conn.out.String())
+	body, _ := io.ReadAll(resp.Body)
+	if want := "error: " + io.ErrUnexpectedEOF.Error(); string(body) != want {
+		t.Fatalf("Expected %q for a truncated body but got: %q\n", want, body)
+	}
+}
+
+func TestBodyStreamedPastIdleTimeout(t *testing.T) {
+	s := bodyEchoServer()
+	s.IdleTimeout = 200 * time.Millisecond
+	deadlines := newFakeDeadlines(s)
+
+	parts := []string{"slow", "ly ", "but ", "steadily"}
+	out := serveClient(t, s, func(client net.Conn) {
+		_, _ = io.WriteString(client, "POST /echo HTTP/1.1\r\nHost: website1\r\nConnection: close\r\nContent-Length: 19\r\n\r\n")
+		deadlines.wait(2)
+		// the whole body takes longer than the idle timeout, no pause does
+		for i, part := range parts {
+			if i > 0 {
+				deadlines.wait(1)
+			}
+			deadlines.advance(100 * time.Millisecond)
+			_, _ = io.WriteString(client, part)
+		}
+	})
+	resp := parseResponse(t, out)
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != strings.Join(parts, "") {
+		t.Fatalf("Expected the whole body to be streamed but got: %q\n", body)
+	}
+}
+
+func TestPostHandler(t *testing.T) {
+	s := bodyEchoServer()
+	request := "POST /contact HTTP/1.1\r\nHost: website1\r\nConnection: close\r\nContent-Length: 11\r\n\r\nname=triton"
+	if resp := parseResponse(t, serveRaw(t, s, request)); resp.StatusCode != 405 {
+		t.Fatalf("Expected response code of 405 without a POST handler but got: %v\n", resp.StatusCode)
+	}
+
+	s.PostHandler = func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		body, _ := io.ReadAll(req.Body)
+		res.SetBody("text/plain", req.URL+" "+string(body))
+		return res
+	}
+	resp := parseResponse(t, serveRaw(t, s, request))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "/contact name=triton" {
+		t.Fatalf("Expected the POST handler to read the body but got: %v %q\n", resp.StatusCode, body)
+	}
+	// registered patterns take precedence
+	resp = parseResponse(t, serveRaw(t, s, "POST /echo HTTP/1.1\r\nHost: website1\r\nConnection: close\r\nContent-Length: 2\r\n\r\nhi"))
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hi" {
+		t.Fatalf("Expected the /echo handler to answer but got: %q\n", body)
+	}
+}
+
+func TestChunkedBody(t *testing.T) {
+	s := bodyEchoServer()
+	s.HandleFunc("/trailers", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		body, _ := io.ReadAll(req.Body)
+		res.SetBody("text/plain", string(body)+" "+req.Trailers["x-checksum"]+" "+req.Trailers["content-length"])
+		return res
+	})
+
+	chunked := "POST /trailers HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Checksum: abc\r\nContent-Length: 3\r\n\r\n"
+	conn := &scriptedConn{r: strings.NewReader(chunked + "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")}
+	s.HandleConnection(conn)
+	br := bufio.NewReader(strings.NewReader(conn.out.String()))
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello, world abc " {
+		t.Fatalf("Expected the decoded body and trailer but got: %q\n", body)
+	}
+	// the trailer was consumed, the next request is read
+	if resp, err := http.ReadResponse(br, nil); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("Expected the next request to be answered but got: %v\n", err)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		code    int
+		body    string
+	}{
+		{"conflict", "POST /echo HTTP/1.1\r\nHost: website1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", 400, ""},
+		{"unsupported coding", "POST /echo HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", 400, ""},
+		{"malformed size", "POST /echo HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n", 200, "error: " + errMalformedChunk.Error()},
+		{"missing line end", "POST /echo HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello!\r\n0\r\n\r\n", 200, "error: " + errMalformedChunk.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &scriptedConn{r: strings.NewReader(tt.request + "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n")}
+			s.HandleConnection(conn)
+			br := bufio.NewReader(strings.NewReader(conn.out.String()))
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("Error reading response: %v\n", err.Error())
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.code || (tt.body != "" && string(body) != tt.body) {
+				t.Fatalf("Expected %v %q but got: %v %q\n", tt.code, tt.body, resp.StatusCode, body)
+			}
+			// the framing can't be trusted anymore
+			if _, err := http.ReadResponse(br, nil); err == nil {
+				t.Fatal("Expected the connection to be closed")
+			}
+		})
+	}
+}
+
+func TestChunkedBodyTruncated(t *testing.T) {
+	conn := &scriptedConn{r: strings.NewReader("POST /echo HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel")}
+	bodyEchoServer().HandleConnection(conn)
+	resp := parseResponse(t, conn.out.String())
+	if body, _ := io.ReadAll(resp.Body); string(body) != "error: "+io.ErrUnexpectedEOF.Error() {
+		t.Fatalf("Expected %q for a truncated body but got: %q\n", "error: "+io.ErrUnexpectedEOF.Error(), body)
+	}
+}
+
+func TestChunkedBodyTooLarge(t *testing.T) {
+	s := bodyEchoServer()
+	s.MaxBodyBytes = 4
+	resp := parseResponse(t, serveRaw(t, s, "POST /echo HTTP/1.1\r\nHost: website1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	if body, _ := io.ReadAll(resp.Body); string(body) != "error: "+ErrBodyTooLarge.Error() {
+		t.Fatalf("Expected the body to be capped but got: %q\n", body)
+	}
+}
@@ -0,0 +1,61 @@
+package tritonhttp
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyCachePolicy sets the Cache-Control header of res, a response for a
+// file served for req, to the value the cache policies assign it: those of
+// the virtual host first, then Server.CachePolicy. A max-age is mirrored
+// in an Expires header for HTTP/1.0 caches.
+func (s *Server) applyCachePolicy(req *Request, res *Response) {
+	if res.FilePath == "" {
+		return
+	}
+	urlPath, err := cleanURLPath(req.URL)
+	if err != nil {
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(res.FilePath))
+	_, settings, _ := lookupHost(s.hostSettings(), req.Host)
+	value, ok := matchCachePolicy(settings.CachePolicy, urlPath, ext)
+	if !ok {
+		value, ok = matchCachePolicy(s.CachePolicy, urlPath, ext)
+	}
+	if !ok {
+		return
+	}
+	res.Headers["Cache-Control"] = value
+	for _, directive := range parseTokenList(value) {
+		if age, found := strings.CutPrefix(directive, "max-age="); found {
+			if seconds, err := strconv.Atoi(age); err == nil && seconds >= 0 {
+				res.Headers["Expires"] = FormatTime(s.now().Add(time.Duration(seconds) * time.Second))
+			}
+		}
+	}
+}
+
+// matchCachePolicy looks up the Cache-Control value of a file with the
+// extension ext, served at urlPath, in policy. Keys starting with "/" are
+// path prefixes, of which the longest matching one wins; they take
+// precedence over the keys starting with ".", which are extensions.
+func matchCachePolicy(policy map[string]string, urlPath, ext string) (string, bool) {
+	best := ""
+	for key := range policy {
+		if strings.HasPrefix(key, "/") && strings.HasPrefix(urlPath, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best != "" {
+		return policy[best], true
+	}
+	for key, value := range policy {
+		if strings.HasPrefix(key, ".") && strings.EqualFold(key, ext) {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,77 @@
+package tritonhttp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveScripted is serveRaw over a scriptedConn, which ignores deadlines, for
+// servers with a frozen clock.
+func serveScripted(s *Server, raw string) string {
+	conn := &scriptedConn{r: strings.NewReader(raw)}
+	s.HandleConnection(conn)
+	return conn.out.String()
+}
+
+func TestCachePolicy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "static"), 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v\n", err.Error())
+	}
+	for _, name := range []string{"style.CSS", "page.html", "notes.txt", "static/app.js", "static/app.css", "main.3f9a1c2b.css"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("asset"), 0o644); err != nil {
+			t.Fatalf("Error writing %v: %v\n", name, err.Error())
+		}
+	}
+	now := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	s := &Server{
+		DocRoot:      dir,
+		VirtualHosts: map[string]string{"website1": dir, "website2": dir},
+		Now:          func() time.Time { return now },
+		CachePolicy: map[string]string{
+			".css":     "public, max-age=600",
+			".html":    "no-cache",
+			"/":        "public, max-age=5",
+			"/static/": "public, max-age=86400",
+		},
+		VirtualHostSettings: map[string]VirtualHostSettings{
+			"website2": {CachePolicy: map[string]string{".html": "no-store"}},
+		},
+		ImmutableAssets: DefaultImmutableAssets,
+	}
+	tests := []struct {
+		host, url    string
+		cacheControl string
+		expires      string
+	}{
+		// the "/" prefix is the longest match, and wins over extensions
+		{"website1", "/page.html", "public, max-age=5", FormatTime(now.Add(5 * time.Second))},
+		{"website1", "/static/app.css", "public, max-age=86400", FormatTime(now.Add(24 * time.Hour))},
+		{"website2", "/page.html", "no-store", ""},
+		{"website2", "/notes.txt", "public, max-age=5", FormatTime(now.Add(5 * time.Second))},
+		{"website1", "/main.3f9a1c2b.css", immutableCacheControl, ""},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveScripted(s, "GET "+tt.url+" HTTP/1.1\r\nHost: "+tt.host+"\r\nConnection: close\r\n\r\n"))
+		if got := resp.Header.Get("Cache-Control"); got != tt.cacheControl {
+			t.Fatalf("Expected Cache-Control %q for %v%v but got %q\n", tt.cacheControl, tt.host, tt.url, got)
+		}
+		if got := resp.Header.Get("Expires"); got != tt.expires {
+			t.Fatalf("Expected Expires %q for %v%v but got %q\n", tt.expires, tt.host, tt.url, got)
+		}
+	}
+
+	// without a prefix, extensions apply, whatever their case
+	delete(s.CachePolicy, "/")
+	resp := parseResponse(t, serveScripted(s, "GET /style.CSS HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if got := resp.Header.Get("Cache-Control"); got != "public, max-age=600" {
+		t.Fatalf("Expected the .css policy but got %q\n", got)
+	}
+	resp = parseResponse(t, serveScripted(s, "GET /notes.txt HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if got := resp.Header.Get("Cache-Control"); got != "" {
+		t.Fatalf("Expected no policy but got %q\n", got)
+	}
+}
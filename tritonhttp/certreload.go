@@ -0,0 +1,112 @@
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCertCheckInterval is how often the certificate files of
+// ListenAndServeTLS are checked for changes when Server.CertCheckInterval
+// is not set.
+const DefaultCertCheckInterval = time.Minute
+
+// CertReloader serves the certificate of a pair of PEM files and loads it
+// again once the files change, so a renewed certificate is used without
+// restarting the server. New connections get the new certificate; the
+// established ones keep the one they were set up with.
+type CertReloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+	// mu serializes reloads, and stamp identifies the version of the
+	// files loaded
+	mu    sync.Mutex
+	stamp string
+	// checks runs Reload while the certificate is in use
+	checks periodicTask
+}
+
+// NewCertReloader loads the certificate in certFile, with its private key
+// in keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate again if its files changed since they were
+// last loaded. If the new pair cannot be loaded, e.g. because only one of
+// the files was replaced so far and the key does not match, the
+// certificate in use is kept and the error returned.
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stamp, err := filesStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	r.stamp = stamp
+	return nil
+}
+
+// GetCertificate returns the current certificate, as
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Watch calls Reload every interval, logging failures, until the returned
+// function has been called as many times as Watch.
+func (r *CertReloader) Watch(interval time.Duration) (stop func()) {
+	return r.checks.start(interval, func() {
+		if err := r.Reload(); err != nil {
+			log.Printf("Failed to reload certificate %v: %v", r.certFile, err)
+		}
+	})
+}
+
+// filesStamp identifies the version of the files at paths by their size
+// and modification time. Symbolic links are followed, so a link switched
+// to a new file, as certbot does, is a change.
+func filesStamp(paths ...string) (string, error) {
+	stamp := ""
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d-%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+func (s *Server) certCheckInterval() time.Duration {
+	if s.CertCheckInterval == 0 {
+		return DefaultCertCheckInterval
+	}
+	return s.CertCheckInterval
+}
+
+// startCertChecks watches the certificate files of ListenAndServeTLS or
+// ServeTLS, if any, until the returned function is called.
+func (s *Server) startCertChecks() (stop func()) {
+	certs := s.certs.Load()
+	if certs == nil {
+		return func() {}
+	}
+	return certs.Watch(s.certCheckInterval())
+}
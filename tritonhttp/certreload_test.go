@@ -0,0 +1,114 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// rewriteCertFiles writes cert over the files of writeCertFiles, with a
+// modification time of at.
+func rewriteCertFiles(t *testing.T, certFile, keyFile string, cert tls.Certificate, at time.Time) {
+	newCert, newKey := writeCertFiles(t, cert)
+	for _, f := range [][2]string{{newCert, certFile}, {newKey, keyFile}} {
+		if err := os.Rename(f[0], f[1]); err != nil {
+			t.Fatalf("Error replacing %v: %v\n", f[1], err.Error())
+		}
+		if err := os.Chtimes(f[1], at, at); err != nil {
+			t.Fatalf("Error setting times: %v\n", err.Error())
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	first, second := testCertificate(t), testCertificate(t)
+	certFile, keyFile := writeCertFiles(t, first)
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Error loading certificate: %v\n", err.Error())
+	}
+	current := func() []byte {
+		cert, _ := r.GetCertificate(nil)
+		return cert.Certificate[0]
+	}
+	if !bytes.Equal(current(), first.Certificate[0]) {
+		t.Fatalf("Expected the first certificate\n")
+	}
+
+	rewriteCertFiles(t, certFile, keyFile, second, time.Now().Add(time.Minute))
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Error reloading certificate: %v\n", err.Error())
+	}
+	if !bytes.Equal(current(), second.Certificate[0]) {
+		t.Fatalf("Expected the second certificate after a reload\n")
+	}
+
+	// a certificate written without its key yet is not picked up
+	newCert, _ := writeCertFiles(t, first)
+	if err := os.Rename(newCert, certFile); err != nil {
+		t.Fatalf("Error replacing %v: %v\n", certFile, err.Error())
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatalf("Expected an error for a certificate not matching its key\n")
+	}
+	if !bytes.Equal(current(), second.Certificate[0]) {
+		t.Fatalf("Expected the second certificate to be kept\n")
+	}
+}
+
+func TestServeTLSReload(t *testing.T) {
+	first, second := testCertificate(t), testCertificate(t)
+	certFile, keyFile := writeCertFiles(t, first)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	defer ln.Close()
+	s := newTestServer()
+	s.CertCheckInterval = 10 * time.Millisecond
+	go func() { _ = s.ServeTLS(ln, certFile, keyFile) }()
+
+	dial := func() *tls.Conn {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("Error dialing: %v\n", err.Error())
+		}
+		return conn
+	}
+	old := dial()
+	defer old.Close()
+	if !bytes.Equal(old.ConnectionState().PeerCertificates[0].Raw, first.Certificate[0]) {
+		t.Fatalf("Expected the first certificate\n")
+	}
+
+	rewriteCertFiles(t, certFile, keyFile, second, time.Now().Add(time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn := dial()
+		renewed := bytes.Equal(conn.ConnectionState().PeerCertificates[0].Raw, second.Certificate[0])
+		conn.Close()
+		if renewed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the renewed certificate to be served\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the connection set up before the renewal still works
+	_, _ = io.WriteString(old, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(old), nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+}
@@ -0,0 +1,81 @@
+package tritonhttp
+
+import (
+	"log"
+	"mime"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+const ACCEPT_CHARSET = "accept-charset"
+
+// negotiateCharset applies the "Accept-Charset" header of req to res, a 200
+// response for a text file stored in UTF-8. If the client doesn't accept
+// UTF-8, the file is transcoded to the charset it prefers among those that
+// can represent it, provided Server.TranscodeCharsets is set; failing that,
+// the response is replaced by a 406.
+func (s *Server) negotiateCharset(req *Request, res *Response) *Response {
+	mediaType, params, err := mime.ParseMediaType(res.Headers["Content-Type"])
+	if err != nil || !strings.HasPrefix(mediaType, "text/") {
+		return res
+	}
+	// most clients never send the header; their responses stay as they are
+	if _, ok := req.Headers[ACCEPT_CHARSET]; !ok {
+		return res
+	}
+	header := req.VaryOn(ACCEPT_CHARSET)
+	accepted := parseWeightedList(header)
+	if weightOf(accepted, "utf-8") > 0 {
+		return res
+	}
+	if s.TranscodeCharsets {
+		if transcode(res, accepted, mediaType, params) {
+			return res
+		}
+	}
+	return s.newResponse(statusNotAcceptable, responseOptions{req: req, detail: "the resource is not available in any charset of " + header})
+}
+
+// transcode converts the body of res to the most preferred charset of
+// accepted able to represent it, and reports whether it succeeded.
+func transcode(res *Response, accepted []weightedValue, mediaType string, params map[string]string) bool {
+	body, err := os.ReadFile(res.FilePath)
+	if err != nil {
+		log.Printf("Failed to read %v for transcoding: %v", res.FilePath, err)
+		return false
+	}
+	if !utf8.Valid(body) {
+		return false
+	}
+	candidates := make([]weightedValue, 0, len(accepted))
+	for _, wv := range accepted {
+		if wv.q > 0 && wv.value != "*" {
+			candidates = append(candidates, wv)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, wv := range candidates {
+		enc, err := ianaindex.IANA.Encoding(wv.value)
+		if err != nil || enc == nil {
+			continue
+		}
+		// the encoder fails on characters the charset cannot represent
+		encoded, err := enc.NewEncoder().Bytes(body)
+		if err != nil {
+			continue
+		}
+		params["charset"] = wv.value
+		if etag, ok := res.Headers["ETag"]; ok {
+			// the transcoded bytes are a representation of their own
+			res.Headers["ETag"] = strings.TrimSuffix(etag, `"`) + "-" + wv.value + `"`
+		}
+		res.SetBody(mime.FormatMediaType(mediaType, params), string(encoded))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcceptCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		transcode   bool
+		code        int
+		contentType string
+		vary        string
+	}{
+		{"no header", "", false, 200, "text/html; charset=utf-8", ""},
+		{"utf-8 accepted", "iso-8859-1, utf-8;q=0.5", false, 200, "text/html; charset=utf-8", "Accept-Charset"},
+		{"wildcard", "*", false, 200, "text/html; charset=utf-8", "Accept-Charset"},
+		{"legacy only", "iso-8859-1", false, 406, "text/html; charset=utf-8", "Accept-Charset"},
+		{"transcoded", "iso-8859-1", true, 200, "text/html; charset=iso-8859-1", "Accept-Charset"},
+		{"preferred charset", "us-ascii;q=0.9, windows-1252, utf-8;q=0", true, 200, "text/html; charset=windows-1252", "Accept-Charset"},
+		{"unknown charset", "x-unknown", true, 406, "text/html; charset=utf-8", "Accept-Charset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.TranscodeCharsets = tt.transcode
+			raw := "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n"
+			if tt.accept != "" {
+				raw += "Accept-Charset: " + tt.accept + "\r\n"
+			}
+			resp := parseResponse(t, serveRaw(t, s, raw+"\r\n"))
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != tt.contentType {
+				t.Fatalf("Expected Content-Type of %v but got %v\n", tt.contentType, ct)
+			}
+			if vary := resp.Header.Get("Vary"); vary != tt.vary {
+				t.Fatalf("Expected Vary of %q but got %q\n", tt.vary, vary)
+			}
+			if int64(len(body)) != resp.ContentLength {
+				t.Fatalf("Body of %d bytes does not match Content-Length %v\n", len(body), resp.ContentLength)
+			}
+		})
+	}
+}
+
+func TestVaryNotModified(t *testing.T) {
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	// a 304 must list the same Vary as the 200 it stands for
+	resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\nAccept-Charset: utf-8\r\n"+
+		"If-None-Match: "+fileETag(info)+"\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 304 {
+		t.Fatalf("Expected response code of 304 but got: %v\n", resp.StatusCode)
+	}
+	if vary := resp.Header.Get("Vary"); vary != "Accept-Charset" {
+		t.Fatalf("Expected Vary of %q but got %q\n", "Accept-Charset", vary)
+	}
+}
+
+func TestTranscodeUnrepresentable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "price.txt")
+	if err := os.WriteFile(path, []byte("10 \u20ac"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	tests := []struct {
+		accept string
+		ok     bool
+		body   string
+	}{
+		// ISO-8859-1 has no euro sign, Windows-1252 has it at 0x80
+		{"iso-8859-1", false, ""},
+		{"iso-8859-1, windows-1252;q=0.5", true, "10 \x80"},
+	}
+	for _, tt := range tests {
+		res := &Response{}
+		res.init()
+		res.FilePath = path
+		params := map[string]string{}
+		if ok := transcode(res, parseWeightedList(tt.accept), "text/plain", params); ok != tt.ok || res.Body != tt.body {
+			t.Fatalf("Transcoding for %q: got %v %q, want %v %q\n", tt.accept, ok, res.Body, tt.ok, tt.body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Client sends requests to a single TritonHTTP server, reusing the
+// connection between requests until either side asks to close it.
+// A Client is not safe for concurrent use.
+type Client struct {
+	// Addr ("host:port") : specifies the TCP address of the server
+	Addr string
+	// MaxBodyBytes caps the size of response bodies; Do fails with
+	// ErrResponseTooLarge for larger ones. Zero means no limit.
+	MaxBodyBytes int64
+
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// NewRequest returns a GET request for url on the virtual host host.
+func NewRequest(host, url string) *Request {
+	req := &Request{Method: "GET", URL: url, Proto: responseProto, Host: host}
+	req.init()
+	return req
+}
+
+// Do sends req and reads its response. A request on a reused connection
+// that the server already closed is retried once on a new connection. The
+// response to a HEAD request has no Body, but the ContentLength the server
+// announced.
+func (c *Client) Do(req *Request) (*Response, error) {
+	reused := c.conn != nil
+	res, err := c.roundTrip(req)
+	if err != nil && reused && isStaleConnError(err) {
+		res, err = c.roundTrip(req)
+	}
+	return res, err
+}
+
+func (c *Client) roundTrip(req *Request) (*Response, error) {
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.Addr, CONNECT_TIMEOUT)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		c.br = bufio.NewReader(conn)
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(SEND_TIMEOUT)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := req.Write(c.conn); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.conn.SetReadDeadline(time.Now().Add(RECV_TIMEOUT)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	res, err := readResponse(c.br, req.Method, c.MaxBodyBytes)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	res.Request = req
+
+	if req.Close || strings.EqualFold(res.Headers["Connection"], "close") {
+		c.Close()
+	}
+	return res, nil
+}
+
+// Close closes the connection to the server, if any.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.br = nil
+	return err
+}
+
+// isStaleConnError reports whether err means the server closed an idle
+// keep-alive connection before the request was processed.
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,47 @@
+package tritonhttp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClientKeepAlive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ln.Close()
+	go newTestServer().Serve(ln)
+
+	c := &Client{Addr: ln.Addr().String()}
+	defer c.Close()
+
+	res, err := c.Do(NewRequest("website1", "/"))
+	if err != nil {
+		t.Fatalf("Error fetching request: %v\n", err.Error())
+	}
+	if res.StatusCode != 200 || len(res.Body) != 377 {
+		t.Fatalf("Expected 200 with 377 bytes but got %v with %v bytes\n", res.StatusCode, len(res.Body))
+	}
+	first := c.conn
+
+	res, err = c.Do(NewRequest("website1", "/missing.html"))
+	if err != nil {
+		t.Fatalf("Error fetching request: %v\n", err.Error())
+	}
+	if res.StatusCode != 404 {
+		t.Fatalf("Expected 404 but got %v\n", res.StatusCode)
+	}
+	if c.conn != first {
+		t.Fatal("Client did not reuse the keep-alive connection")
+	}
+
+	req := NewRequest("website1", "/subdir/")
+	req.Close = true
+	if res, err = c.Do(req); err != nil || res.StatusCode != 200 {
+		t.Fatalf("Expected 200 but got %v (err %v)\n", res, err)
+	}
+	if c.conn != nil {
+		t.Fatal("Client kept a connection the server closed")
+	}
+}
@@ -0,0 +1,216 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ACCEPT_ENCODING = "accept-encoding"
+
+	// maxCompressBytes is the size of the largest file compressed on the
+	// fly: the compressed body is built in memory before it is sent.
+	maxCompressBytes = 8 << 20
+)
+
+// Encoder returns a writer compressing what is written to it into w, in
+// one content coding. The output is complete once the writer is closed.
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	encodersMu sync.RWMutex
+	// encoders maps the content codings responses can be compressed in,
+	// e.g. "gzip", to their encoder
+	encoders = map[string]Encoder{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		},
+	}
+)
+
+// codingPreference breaks the ties between the codings a client weighs
+// equally: the one compressing best first. Registered codings not listed
+// come last, by name.
+var codingPreference = []string{"br", "zstd", "gzip"}
+
+// RegisterEncoder makes responses compressible in coding, e.g. "br", with
+// enc, replacing any encoder of that name. Codings that depend on another
+// module register themselves from a file built with a build tag, as
+// "brotli" does for "br", so the dependency stays optional.
+func RegisterEncoder(coding string, enc Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[strings.ToLower(coding)] = enc
+}
+
+// encoderFor returns the encoder of coding, or nil if there is none.
+func encoderFor(coding string) Encoder {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return encoders[coding]
+}
+
+// encodings returns the registered codings in the order of preference.
+func encodings() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	var codings, others []string
+	for _, coding := range codingPreference {
+		if _, ok := encoders[coding]; ok {
+			codings = append(codings, coding)
+		}
+	}
+	for coding := range encoders {
+		if !containsToken(codingPreference, coding) {
+			others = append(others, coding)
+		}
+	}
+	sort.Strings(others)
+	return append(codings, others...)
+}
+
+// DefaultCompressMinSize is the size of the smallest file compressed when
+// CompressionPolicy.MinSize is not set.
+const DefaultCompressMinSize = 256
+
+// DefaultCompressTypes are the types compressed when
+// CompressionPolicy.Types is not set: text-like ones. Images, video and
+// archives are compressed already.
+var DefaultCompressTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+	"font/ttf",
+	"font/otf",
+}
+
+// CompressionPolicy decides which files are worth compressing on the fly.
+type CompressionPolicy struct {
+	// MinSize is the size of the smallest file compressed, as compressing
+	// a smaller one saves less than it costs. Zero means
+	// DefaultCompressMinSize.
+	MinSize int64
+	// Types lists the MIME types, or type prefixes such as "text/", of
+	// the files compressed. Nil means DefaultCompressTypes.
+	Types []string
+	// ExcludeTypes lists types never compressed, even if Types matches
+	// them, e.g. "application/wasm" to compress text but no binaries.
+	ExcludeTypes []string
+}
+
+// allows reports whether the policy compresses res, a 200 response for a
+// file. Files over maxCompressBytes never are.
+func (p CompressionPolicy) allows(res *Response) bool {
+	minSize := p.MinSize
+	if minSize == 0 {
+		minSize = DefaultCompressMinSize
+	}
+	if res.ContentLength <= 0 || res.ContentLength < minSize || res.ContentLength > maxCompressBytes {
+		return false
+	}
+	types := p.Types
+	if types == nil {
+		types = DefaultCompressTypes
+	}
+	contentType := res.Headers["Content-Type"]
+	for _, t := range p.ExcludeTypes {
+		if mediaTypeMatches(contentType, t) {
+			return false
+		}
+	}
+	for _, t := range types {
+		if mediaTypeMatches(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseEncoding returns the coding of codings, in the order of
+// preference, the weights of accepted, the parsed "Accept-Encoding" header,
+// favor, or "" to send the body as it is: when no coding is acceptable, or
+// "identity" is weighed higher.
+func chooseEncoding(accepted []weightedValue, codings []string) string {
+	best, bestQ := "", 0.0
+	for _, coding := range codings {
+		if q := weightOf(accepted, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	for _, wv := range accepted {
+		if wv.value == "identity" && wv.q > bestQ {
+			return ""
+		}
+	}
+	return best
+}
+
+// negotiateEncoding picks the content coding res, a 200 response for a
+// file, is sent in, by the weights of the "Accept-Encoding" header of req,
+// provided Server.Compress is set and its CompressionPolicy allows it. The
+// response then carries the coding in
+// "Content-Encoding" and an ETag of its own, but its body is only
+// compressed by encodeBody, once it is known to be sent. Every response
+// that could have been compressed varies on Accept-Encoding, whether or
+// not req carries the header.
+func (s *Server) negotiateEncoding(req *Request, res *Response) {
+	if _, ok := res.Headers["Content-Encoding"]; ok || !s.Compress || !s.CompressionPolicy.allows(res) {
+		return
+	}
+	coding := chooseEncoding(parseWeightedList(req.VaryOn(ACCEPT_ENCODING)), encodings())
+	if coding == "" {
+		return
+	}
+	res.encodeIn = coding
+	setContentEncoding(res, coding)
+}
+
+// setContentEncoding marks res as sent in coding.
+func setContentEncoding(res *Response, coding string) {
+	res.Headers["Content-Encoding"] = coding
+	if etag, ok := res.Headers["ETag"]; ok {
+		// the compressed bytes are a representation of their own
+		res.Headers["ETag"] = strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+	}
+}
+
+// encodeBody compresses the body of res in the coding negotiateEncoding
+// picked, if any.
+func encodeBody(res *Response) error {
+	if res.encodeIn == "" {
+		return nil
+	}
+	enc := encoderFor(res.encodeIn)
+	if enc == nil {
+		return fmt.Errorf("no encoder for %v", res.encodeIn)
+	}
+	body := []byte(res.Body)
+	if res.Body == "" {
+		var err error
+		if body, err = os.ReadFile(res.FilePath); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	zw, err := enc(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	res.SetBody(res.Headers["Content-Type"], buf.String())
+	return nil
+}
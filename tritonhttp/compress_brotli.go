@@ -0,0 +1,19 @@
+//go:build brotli
+
+package tritonhttp
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Brotli is only compiled in with the "brotli" build tag, which pulls in
+// the encoder module:
+//
+//	go build -tags brotli ./...
+func init() {
+	RegisterEncoder("br", func(w io.Writer) (io.WriteCloser, error) {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	})
+}
@@ -0,0 +1,32 @@
+//go:build brotli
+
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestBrotli(t *testing.T) {
+	s := newTestServer()
+	s.Compress = true
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nAccept-Encoding: gzip, deflate, br\r\nConnection: close\r\n\r\n"))
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Expected Content-Encoding br but got %q\n", got)
+	}
+	body, err := io.ReadAll(brotli.NewReader(resp.Body))
+	if err != nil {
+		t.Fatalf("Error reading brotli body: %v\n", err.Error())
+	}
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	if string(body) != string(data) {
+		t.Fatalf("Expected the body to decode to index.html but got: %q\n", body)
+	}
+}
@@ -0,0 +1,170 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChooseEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip;q=0", ""},
+		{"*", encodings()[0]},
+		{"x-unknown", ""},
+		{"gzip;q=0.5, identity", ""},
+		{"gzip, identity;q=0.5", "gzip"},
+		{"GZIP;q=0.8, *;q=0.1", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := chooseEncoding(parseWeightedList(tt.accept), encodings()); got != tt.want {
+			t.Fatalf("Expected coding %q for %q but got %q\n", tt.want, tt.accept, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	gzipETag := fileETag(info)[:len(fileETag(info))-1] + `-gzip"`
+	tests := []struct {
+		name     string
+		compress bool
+		headers  string
+		code     int
+		encoding string
+		vary     string
+	}{
+		{"disabled", false, "Accept-Encoding: gzip\r\n", 200, "", ""},
+		{"gzip", true, "Accept-Encoding: gzip, deflate\r\n", 200, "gzip", "Accept-Encoding"},
+		{"no header", true, "", 200, "", "Accept-Encoding"},
+		{"identity preferred", true, "Accept-Encoding: gzip;q=0.5, identity\r\n", 200, "", "Accept-Encoding"},
+		{"not modified", true, "Accept-Encoding: gzip\r\nIf-None-Match: " + gzipETag + "\r\n", 304, "gzip", "Accept-Encoding"},
+		{"identity tag", true, "Accept-Encoding: gzip\r\nIf-None-Match: " + fileETag(info) + "\r\n", 200, "gzip", "Accept-Encoding"},
+		{"range ignored", true, "Accept-Encoding: gzip\r\nRange: bytes=0-9\r\n", 200, "gzip", "Accept-Encoding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.Compress = tt.compress
+			resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\n"+tt.headers+"Connection: close\r\n\r\n"))
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected Content-Encoding %q but got %q\n", tt.encoding, got)
+			}
+			if got := resp.Header.Get("Vary"); got != tt.vary {
+				t.Fatalf("Expected Vary %q but got %q\n", tt.vary, got)
+			}
+			if tt.code != 200 {
+				return
+			}
+			var body io.Reader = resp.Body
+			if tt.encoding == "gzip" {
+				if got := resp.Header.Get("ETag"); got != gzipETag {
+					t.Fatalf("Expected ETag %v but got: %v\n", gzipETag, got)
+				}
+				if resp.Header.Get("Accept-Ranges") != "" {
+					t.Fatalf("Unexpected Accept-Ranges on a compressed response\n")
+				}
+				zr, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("Error reading gzip body: %v\n", err.Error())
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if string(got) != string(data) {
+				t.Fatalf("Expected the body to decode to index.html but got: %q\n", got)
+			}
+		})
+	}
+}
+
+func TestCompressionPolicy(t *testing.T) {
+	docroot := t.TempDir()
+	files := map[string]int{"small.css": 100, "large.css": 1000, "logo.png": 1000, "app.wasm": 1000}
+	for name, size := range files {
+		if err := os.WriteFile(filepath.Join(docroot, name), bytes.Repeat([]byte("a"), size), 0644); err != nil {
+			t.Fatalf("Error writing file: %v\n", err.Error())
+		}
+	}
+	tests := []struct {
+		name     string
+		policy   CompressionPolicy
+		url      string
+		encoding string
+	}{
+		{"default", CompressionPolicy{}, "/large.css", "gzip"},
+		{"too small", CompressionPolicy{}, "/small.css", ""},
+		{"lower minimum", CompressionPolicy{MinSize: 10}, "/small.css", "gzip"},
+		{"higher minimum", CompressionPolicy{MinSize: 2000}, "/large.css", ""},
+		{"image", CompressionPolicy{}, "/logo.png", ""},
+		{"allowed type", CompressionPolicy{Types: []string{"image/png"}}, "/logo.png", "gzip"},
+		{"other types", CompressionPolicy{Types: []string{"image/"}}, "/large.css", ""},
+		{"default type", CompressionPolicy{}, "/app.wasm", "gzip"},
+		{"excluded type", CompressionPolicy{ExcludeTypes: []string{"application/wasm"}}, "/app.wasm", ""},
+		{"excluded prefix", CompressionPolicy{Types: []string{"*/*"}, ExcludeTypes: []string{"image/"}}, "/logo.png", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"website1": docroot}, Compress: true, CompressionPolicy: tt.policy}
+			resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\nAccept-Encoding: gzip\r\nConnection: close\r\n\r\n"))
+			if got := resp.Header.Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected Content-Encoding %q but got %q\n", tt.encoding, got)
+			}
+			// only responses that could have been compressed vary
+			if vary := resp.Header.Get("Vary"); (vary != "") != (tt.encoding != "") {
+				t.Fatalf("Unexpected Vary %q\n", vary)
+			}
+		})
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("deflate", func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	})
+	defer func() {
+		encodersMu.Lock()
+		delete(encoders, "deflate")
+		encodersMu.Unlock()
+	}()
+	s := newTestServer()
+	s.Compress = true
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nAccept-Encoding: gzip;q=0.5, deflate\r\nConnection: close\r\n\r\n"))
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "deflate" {
+		t.Fatalf("Expected Content-Encoding deflate but got %q\n", got)
+	}
+	body, err := io.ReadAll(flate.NewReader(resp.Body))
+	if err != nil {
+		t.Fatalf("Error reading deflate body: %v\n", err.Error())
+	}
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	if string(body) != string(data) {
+		t.Fatalf("Expected the body to decode to index.html but got: %q\n", body)
+	}
+}
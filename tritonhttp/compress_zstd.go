@@ -0,0 +1,20 @@
+//go:build zstd
+
+package tritonhttp
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstd is only compiled in with the "zstd" build tag, which pulls in the
+// encoder module:
+//
+//	go build -tags zstd ./...
+func init() {
+	RegisterEncoder("zstd", func(w io.Writer) (io.WriteCloser, error) {
+		// a single goroutine per response; the server compresses many at once
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	})
+}
@@ -0,0 +1,37 @@
+//go:build zstd
+
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZstd(t *testing.T) {
+	s := newTestServer()
+	s.Compress = true
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nAccept-Encoding: gzip, zstd\r\nConnection: close\r\n\r\n"))
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "zstd" {
+		t.Fatalf("Expected Content-Encoding zstd but got %q\n", got)
+	}
+	zr, err := zstd.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading zstd body: %v\n", err.Error())
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Error reading zstd body: %v\n", err.Error())
+	}
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	if string(body) != string(data) {
+		t.Fatalf("Expected the body to decode to index.html but got: %q\n", body)
+	}
+}
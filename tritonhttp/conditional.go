@@ -0,0 +1,186 @@
+package tritonhttp
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	IF_MATCH            = "if-match"
+	IF_UNMODIFIED_SINCE = "if-unmodified-since"
+	IF_MODIFIED_SINCE   = "if-modified-since"
+	IF_NONE_MATCH       = "if-none-match"
+	IF_RANGE            = "if-range"
+)
+
+// ifMatch evaluates the "If-Match" precondition of req (RFC 9110 section
+// 13.1.1) against the entity tag of the current resource, "" when it does
+// not exist. It holds when the header is absent, when it is "*" and the
+// resource exists, or when one of its tags strongly matches etag.
+func ifMatch(req *Request, etag string) bool {
+	value, ok := req.Headers[IF_MATCH]
+	if !ok {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	for _, tag := range parseETagList(value) {
+		if tag == "*" || strongMatch(tag, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmodifiedSince evaluates the "If-Unmodified-Since" precondition of req
+// (RFC 9110 section 13.1.4) against a resource last modified at modTime, the
+// zero time for a resource that does not exist. It holds when the header is
+// absent or not a valid date, and fails for a missing resource.
+func unmodifiedSince(req *Request, modTime time.Time) bool {
+	value, ok := req.Headers[IF_UNMODIFIED_SINCE]
+	if !ok {
+		return true
+	}
+	since, err := ParseTime(value)
+	if err != nil {
+		return true
+	}
+	if modTime.IsZero() {
+		return false
+	}
+	// Last-Modified only has a resolution of one second
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// ifNoneMatch evaluates the "If-None-Match" precondition of req (RFC 9110
+// section 13.1.2) against the entity tag of the current resource, "" when
+// it has none. It fails, meaning the client's copy is current, when one of
+// its tags weakly matches etag, or when it is "*" and there is a tag.
+func ifNoneMatch(req *Request, etag string) bool {
+	value, ok := req.Headers[IF_NONE_MATCH]
+	if !ok || etag == "" {
+		return true
+	}
+	for _, tag := range parseETagList(value) {
+		if tag == "*" || weakMatch(tag, etag) {
+			return false
+		}
+	}
+	return true
+}
+
+// modifiedSince evaluates the "If-Modified-Since" condition of req (RFC
+// 9110 section 13.1.3) against a resource last modified at modTime. It
+// fails, meaning the client's copy is current, when the resource was not
+// modified after the date. The header is ignored for methods other than
+// GET and HEAD, when it is not a valid date, or when it is later than now,
+// the server's current time, as such a date cannot come from the server.
+func modifiedSince(req *Request, modTime, now time.Time) bool {
+	value, ok := req.Headers[IF_MODIFIED_SINCE]
+	if !ok || (req.Method != methodGet && req.Method != methodHead) || modTime.IsZero() {
+		return true
+	}
+	since, err := ParseTime(value)
+	if err != nil || since.After(now) {
+		return true
+	}
+	// Last-Modified only has a resolution of one second
+	return modTime.Truncate(time.Second).After(since)
+}
+
+// precondition is the outcome of the conditional headers of a request.
+type precondition int
+
+const (
+	// preconditionsHold lets the request proceed
+	preconditionsHold precondition = iota
+	// preconditionNotModified answers it with 304, the client's copy
+	// being current
+	preconditionNotModified
+	// preconditionFailed answers it with 412
+	preconditionFailed
+)
+
+// evalPreconditions evaluates the conditional headers of req against the
+// target resource, which has the entity tag etag and was last modified at
+// modTime, both zero if it does not exist, in the order of RFC 9110 section
+// 13.2.2: If-Match, or else If-Unmodified-Since, may fail the request;
+// then If-None-Match, or else If-Modified-Since, may find the client's copy
+// current, which is a 304 for GET and HEAD and a failure otherwise. now is
+// the server's current time. If-Range is left to the range handling. On
+// failure it returns the reason.
+func evalPreconditions(req *Request, etag string, modTime, now time.Time) (precondition, string) {
+	if _, ok := req.Headers[IF_MATCH]; ok {
+		if !ifMatch(req, etag) {
+			return preconditionFailed, req.URL + " does not match " + req.Headers[IF_MATCH]
+		}
+	} else if !unmodifiedSince(req, modTime) {
+		return preconditionFailed, req.URL + " was modified since " + req.Headers[IF_UNMODIFIED_SINCE]
+	}
+
+	safe := req.Method == methodGet || req.Method == methodHead
+	if _, ok := req.Headers[IF_NONE_MATCH]; ok {
+		// entity tags are the more accurate validator, If-Modified-Since
+		// is ignored
+		if ifNoneMatch(req, etag) {
+			return preconditionsHold, ""
+		}
+		if safe {
+			return preconditionNotModified, ""
+		}
+		return preconditionFailed, req.URL + " matches " + req.Headers[IF_NONE_MATCH]
+	}
+	if !modifiedSince(req, modTime, now) {
+		return preconditionNotModified, ""
+	}
+	return preconditionsHold, ""
+}
+
+// ifRange evaluates the "If-Range" condition of req (RFC 9110 section
+// 13.1.5) against the entity tag and modification time of the current
+// representation: it reports whether the "Range" header applies, or the
+// whole representation must be sent since the client's partial copy is of
+// another version. An entity tag must match strongly; a date must be the
+// exact Last-Modified time, which only changes once per second.
+func ifRange(req *Request, etag string, modTime time.Time) bool {
+	value, ok := req.Headers[IF_RANGE]
+	if !ok {
+		return true
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		return etag != "" && strongMatch(value, etag)
+	}
+	since, err := ParseTime(value)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return modTime.Truncate(time.Second).Equal(since)
+}
+
+// notModified turns res, a 200 response for a file, into a 304 Not
+// Modified response. The headers the 200 would have carried are kept, so
+// caches can update what they stored, but not the body nor its type.
+func notModified(res *Response) *Response {
+	res.StatusCode = statusNotModified
+	res.StatusText = statusText[statusNotModified]
+	res.FilePath = ""
+	res.Body = ""
+	res.ContentLength = 0
+	delete(res.Headers, "Content-Type")
+	return res
+}
+
+// uploadPreconditions evaluates the preconditions of an upload to the file
+// at path. On failure it returns the reason.
+func (s *Server) uploadPreconditions(req *Request, path string) (string, bool) {
+	etag, modTime := "", time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		etag, modTime = s.fileETagFor(req, path, info), info.ModTime()
+	}
+	if outcome, reason := evalPreconditions(req, etag, modTime, s.now()); outcome != preconditionsHold {
+		return reason, false
+	}
+	return "", true
+}
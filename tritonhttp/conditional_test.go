@@ -0,0 +1,388 @@
+package tritonhttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	tests := []struct {
+		name string
+		text string
+		ok   bool
+	}{
+		{"IMF-fixdate", "Sun, 06 Nov 1994 08:49:37 GMT", true},
+		{"RFC 850", "Sunday, 06-Nov-94 08:49:37 GMT", true},
+		{"asctime", "Sun Nov  6 08:49:37 1994", true},
+		{"other zone", "Sun, 06 Nov 1994 08:49:37 PST", false},
+		{"invalid", "yesterday", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTime(tt.text)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("Expected an error but got: %v\n", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing time: %v\n", err.Error())
+			}
+			if !got.Equal(want) || got.Location() != time.UTC {
+				t.Fatalf("Expected %v but got: %v\n", want, got)
+			}
+			if FormatTime(got) != "Sun, 06 Nov 1994 08:49:37 GMT" {
+				t.Fatalf("Expected the time to round-trip but got: %v\n", FormatTime(got))
+			}
+		})
+	}
+}
+
+func TestIfUnmodifiedSince(t *testing.T) {
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	lastModified := FormatTime(info.ModTime())
+	tests := []struct {
+		name  string
+		since string
+		code  int
+	}{
+		{"last modified", lastModified, 200},
+		{"later", FormatTime(info.ModTime().Add(time.Hour)), 200},
+		{"earlier", FormatTime(info.ModTime().Add(-time.Hour)), 412},
+		{"earlier, RFC 850", info.ModTime().Add(-time.Hour).UTC().Format("Monday, 02-Jan-06 15:04:05 GMT"), 412},
+		{"invalid date", "yesterday", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\n"+
+				"If-Unmodified-Since: "+tt.since+"\r\nConnection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestPutIfUnmodifiedSince(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+	modTime := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	path := filepath.Join(docroot, "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Error setting times: %v\n", err.Error())
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		code int
+		want string
+	}{
+		{"changed since", putRequest("/notes.txt", "lost", "If-Unmodified-Since: "+FormatTime(modTime.Add(-time.Second))), 412, "hello"},
+		{"missing file", putRequest("/other.txt", "lost", "If-Unmodified-Since: "+FormatTime(modTime)), 412, "hello"},
+		{"unchanged", putRequest("/notes.txt", "bye", "If-Unmodified-Since: "+FormatTime(modTime)), 204, "bye"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, s, tt.raw+"GET / HTTP/1.1\r\nHost: uploads\r\nConnection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("Expected notes.txt to hold %q but got %q (%v)\n", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestParseETagList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`*`, []string{"*"}},
+		{`"a"`, []string{`"a"`}},
+		{`"a", W/"b",  "c,d"`, []string{`"a"`, `W/"b"`, `"c,d"`}},
+		{`bogus, "a"`, []string{`"a"`}},
+		{`"unterminated`, nil},
+	}
+	for _, tt := range tests {
+		got := parseETagList(tt.value)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Fatalf("parseETagList(%q) = %q, want %q\n", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPutIfMatch(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+	path := filepath.Join(docroot, "notes.txt")
+
+	resp := parseResponse(t, serveRaw(t, s, putRequest("/notes.txt", "hello", "If-Match: *", "Connection: close")))
+	if resp.StatusCode != 412 {
+		t.Fatalf("Expected If-Match: * to fail for a missing file but got: %v\n", resp.StatusCode)
+	}
+	resp = parseResponse(t, serveRaw(t, s, putRequest("/notes.txt", "hello", "Connection: close")))
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 201 || etag == "" {
+		t.Fatalf("Expected 201 with an ETag but got: %v %q\n", resp.StatusCode, etag)
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		code int
+		want string
+	}{
+		{"stale tag", putRequest("/notes.txt", "lost", `If-Match: "stale"`), 412, "hello"},
+		{"weak tag", putRequest("/notes.txt", "lost", "If-Match: W/"+etag), 412, "hello"},
+		// If-Match wins over a failing If-Unmodified-Since
+		{"current tag", putRequest("/notes.txt", "bye", "If-Match: "+`"stale", `+etag, "If-Unmodified-Since: "+FormatTime(time.Unix(0, 0))), 204, "bye"},
+		{"old tag", putRequest("/notes.txt", "lost", "If-Match: "+etag), 412, "bye"},
+		{"any", putRequest("/notes.txt", "any", "If-Match: *"), 204, "any"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, s, tt.raw+"GET / HTTP/1.1\r\nHost: uploads\r\nConnection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("Expected notes.txt to hold %q but got %q (%v)\n", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	tests := []struct {
+		name  string
+		since string
+		code  int
+	}{
+		{"last modified", FormatTime(info.ModTime()), 304},
+		{"later", FormatTime(info.ModTime().Add(time.Second)), 304},
+		{"earlier", FormatTime(info.ModTime().Add(-time.Hour)), 200},
+		{"in the future", FormatTime(time.Now().Add(time.Hour)), 200},
+		{"invalid date", "yesterday", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\n"+
+				"If-Modified-Since: "+tt.since+"\r\nConnection: close\r\n\r\n"))
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.code == 304 && (len(body) > 0 || resp.Header.Get("Content-Length") != "" || resp.Header.Get("Last-Modified") == "") {
+				t.Fatalf("Expected a 304 with Last-Modified and no body but got: %v %q\n", resp.Header, body)
+			}
+		})
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected the response to carry an ETag")
+	}
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	tests := []struct {
+		name    string
+		headers string
+		code    int
+	}{
+		{"match", "If-None-Match: " + etag, 304},
+		{"weak match", `If-None-Match: "nope", W/` + etag, 304},
+		{"star", "If-None-Match: *", 304},
+		{"no match", `If-None-Match: "nope"`, 200},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"no match but not modified", "If-None-Match: \"nope\"\r\nIf-Modified-Since: " + FormatTime(info.ModTime()), 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\n"+tt.headers+"\r\nConnection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.code == 304 && resp.Header.Get("ETag") != etag {
+				t.Fatalf("Expected the 304 to carry ETag %v but got: %v\n", etag, resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestETagStrategies(t *testing.T) {
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	sum := sha256.Sum256(data)
+	tests := []struct {
+		strategy string
+		etag     string
+	}{
+		{ETagContentHash, `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`},
+		{"size", `"size-` + strconv.Itoa(len(data)) + `"`},
+	}
+	for _, tt := range tests {
+		s := newTestServer()
+		s.VirtualHostSettings = map[string]VirtualHostSettings{"website1": {ETag: tt.strategy}}
+		s.ETagFuncs = map[string]ETagFunc{"size": func(_ string, info os.FileInfo) (string, error) {
+			return `"size-` + strconv.FormatInt(info.Size(), 10) + `"`, nil
+		}}
+		resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if got := resp.Header.Get("ETag"); got != tt.etag {
+			t.Fatalf("Expected ETag %v with strategy %v but got: %v\n", tt.etag, tt.strategy, got)
+		}
+		resp = parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nIf-None-Match: "+tt.etag+"\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != 304 {
+			t.Fatalf("Expected response code of 304 with strategy %v but got: %v\n", tt.strategy, resp.StatusCode)
+		}
+	}
+}
+
+func TestETagStrength(t *testing.T) {
+	info, err := os.Stat("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error stating index.html: %v\n", err.Error())
+	}
+	data, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	sum := sha256.Sum256(data)
+	weak, strong := "W/"+fileETag(info), `"`+base64.RawURLEncoding.EncodeToString(sum[:])+`"`
+	tests := []struct {
+		name     string
+		strength string
+		header   string
+		code     int
+	}{
+		{"weak tag", ETagWeak, "", 200},
+		{"weak if-none-match", ETagWeak, "If-None-Match: " + weak, 304},
+		{"weak if-none-match strong form", ETagWeak, "If-None-Match: " + fileETag(info), 304},
+		{"weak if-match", ETagWeak, "If-Match: " + weak, 412},
+		{"weak if-range", ETagWeak, "Range: bytes=0-0\r\nIf-Range: " + weak, 200},
+		{"strong tag", ETagStrong, "", 200},
+		{"strong if-none-match", ETagStrong, "If-None-Match: W/" + strong, 304},
+		{"strong if-match", ETagStrong, "If-Match: " + strong, 200},
+		{"strong if-range", ETagStrong, "Range: bytes=0-0\r\nIf-Range: " + strong, 206},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.VirtualHostSettings = map[string]VirtualHostSettings{"website1": {ETag: tt.strength}}
+			raw := "GET /index.html HTTP/1.1\r\nHost: website1\r\n"
+			if tt.header != "" {
+				raw += tt.header + "\r\n"
+			}
+			resp := parseResponse(t, serveRaw(t, s, raw+"Connection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			want := weak
+			if tt.strength == ETagStrong {
+				want = strong
+			}
+			if tt.code != 412 && resp.Header.Get("ETag") != want {
+				t.Fatalf("Expected ETag %v but got: %v\n", want, resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestEvalPreconditions(t *testing.T) {
+	modTime := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	now := modTime.Add(time.Hour)
+	const etag = `"v1"`
+	before, at := FormatTime(modTime.Add(-time.Minute)), FormatTime(modTime)
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		etag    string
+		outcome precondition
+	}{
+		{"none", "GET", nil, etag, preconditionsHold},
+		{"if-match", "GET", map[string]string{IF_MATCH: etag}, etag, preconditionsHold},
+		{"if-match fails", "GET", map[string]string{IF_MATCH: `"v0"`}, etag, preconditionFailed},
+		{"if-match missing resource", "PUT", map[string]string{IF_MATCH: "*"}, "", preconditionFailed},
+		{"if-unmodified-since fails", "GET", map[string]string{IF_UNMODIFIED_SINCE: before}, etag, preconditionFailed},
+		{"if-match wins", "GET", map[string]string{IF_MATCH: etag, IF_UNMODIFIED_SINCE: before}, etag, preconditionsHold},
+		{"if-none-match", "GET", map[string]string{IF_NONE_MATCH: etag}, etag, preconditionNotModified},
+		{"if-none-match unsafe", "PUT", map[string]string{IF_NONE_MATCH: "*"}, etag, preconditionFailed},
+		{"if-none-match creates", "PUT", map[string]string{IF_NONE_MATCH: "*"}, "", preconditionsHold},
+		{"if-none-match wins", "GET", map[string]string{IF_NONE_MATCH: `"v0"`, IF_MODIFIED_SINCE: at}, etag, preconditionsHold},
+		{"if-modified-since", "GET", map[string]string{IF_MODIFIED_SINCE: at}, etag, preconditionNotModified},
+		{"if-modified-since unsafe", "PUT", map[string]string{IF_MODIFIED_SINCE: at}, etag, preconditionsHold},
+		// a failing If-Match is checked first
+		{"order", "GET", map[string]string{IF_MATCH: `"v0"`, IF_NONE_MATCH: etag}, etag, preconditionFailed},
+	}
+	for _, tt := range tests {
+		req := &Request{Method: tt.method, URL: "/notes.txt", Headers: map[string]string{}}
+		for k, v := range tt.headers {
+			req.Headers[k] = v
+		}
+		resourceTime := modTime
+		if tt.etag == "" {
+			resourceTime = time.Time{}
+		}
+		if outcome, reason := evalPreconditions(req, tt.etag, resourceTime, now); outcome != tt.outcome {
+			t.Fatalf("%v: expected outcome %v but got %v (%v)\n", tt.name, tt.outcome, outcome, reason)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	etag := resp.Header.Get("ETag")
+	for _, tt := range []struct {
+		ifMatch string
+		code    int
+	}{{etag, 200}, {"*", 200}, {`"stale"`, 412}} {
+		resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\nIf-Match: "+tt.ifMatch+"\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for If-Match %v but got: %v\n", tt.code, tt.ifMatch, resp.StatusCode)
+		}
+	}
+}
+
+func TestPutIfNoneMatch(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+
+	// "If-None-Match: *" only creates the file, never replaces it
+	for _, code := range []int{201, 412} {
+		resp := parseResponse(t, serveRaw(t, s, putRequest("/notes.txt", "hello", "If-None-Match: *", "Connection: close")))
+		if resp.StatusCode != code {
+			t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// conformanceCase is one edge case from RFC 7230/7231 together with the
+// responses the server must produce for it.
+type conformanceCase struct {
+	rfc   string // section the case is derived from
+	name  string
+	raw   string
+	codes []int
+	// check, if set, runs on every response
+	check func(t *testing.T, resp *http.Response)
+}
+
+func requireHeader(key string) func(t *testing.T, resp *http.Response) {
+	return func(t *testing.T, resp *http.Response) {
+		if resp.Header.Get(key) == "" {
+			t.Fatalf("Response is missing the %v header\n", key)
+		}
+	}
+}
+
+var conformanceCases = []conformanceCase{
+	{"7230 3.5", "leading empty lines are ignored", "\r\n\r\nGET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200}, nil},
+	{"7230 3.2", "header names are case-insensitive", "GET / HTTP/1.1\r\nhOsT: website1\r\ncOnNeCtIoN: close\r\n\r\n", []int{200}, nil},
+	{"7230 3.2.4", "whitespace before the colon is rejected", "GET / HTTP/1.1\r\nHost : website1\r\n\r\n", []int{400}, nil},
+	{"7230 3.2.4", "obsolete line folding is rejected", "GET / HTTP/1.1\r\nHost: website1\r\nX-Folded: a\r\n b\r\n\r\n", []int{400}, nil},
+	{"7230 3.2.6", "values may contain whitespace", "GET / HTTP/1.1\r\nHost: website1\r\nUser-Agent: a b (c)\r\nConnection: close\r\n\r\n", []int{200}, nil},
+	{"7230 3.1.1", "methods are case-sensitive", "get / HTTP/1.1\r\nHost: website1\r\n\r\n", []int{400}, nil},
+	{"7230 2.6", "the version is case-sensitive", "GET / http/1.1\r\nHost: website1\r\n\r\n", []int{400}, nil},
+	{"7230 3.1.1", "extra spaces in the request line are rejected", "GET  / HTTP/1.1\r\nHost: website1\r\n\r\n", []int{400}, nil},
+	{"7230 5.3.2", "absolute-form targets are accepted", "GET http://website1/index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200}, nil},
+	{"7230 5.4", "a missing Host is rejected", "GET / HTTP/1.1\r\nConnection: close\r\n\r\n", []int{400}, nil},
+	{"7230 5.4", "the body of a request without Host is not taken for a request",
+		"POST /x HTTP/1.1\r\nContent-Length: 63\r\n\r\nGET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n" +
+			"GET /missing HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{400, 404}, nil},
+	{"7230 5.4", "the chunked body of a request without Host is not taken for a request",
+		"POST /x HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3f\r\nGET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n\r\n0\r\n\r\n" +
+			"GET /missing HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{400, 404}, nil},
+	{"7230 5.4", "multiple Hosts are rejected", "GET / HTTP/1.1\r\nHost: website1\r\nHost: website1\r\n\r\n", []int{400}, nil},
+	{"7230 6.3", "connections persist by default",
+		"GET / HTTP/1.1\r\nHost: website1\r\n\r\nGET /subdir/ HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200, 200}, nil},
+	{"7230 6.6", "Connection: close is echoed", "GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200},
+		func(t *testing.T, resp *http.Response) {
+			if !resp.Close {
+				t.Fatal("Response to a Connection: close request did not close")
+			}
+		}},
+	{"7230 6.1", "Connection options are a token list", "GET / HTTP/1.1\r\nHost: website1\r\nConnection: TE, close\r\n\r\n", []int{200}, nil},
+	{"7230 3.3.2", "200 responses carry Content-Length", "GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200}, requireHeader("Content-Length")},
+	{"7231 7.1.1.2", "responses carry Date", "GET /missing HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{404}, requireHeader("Date")},
+	{"7231 3.1.1.5", "200 responses carry Content-Type", "GET /kitten.jpg HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200}, requireHeader("Content-Type")},
+	{"7232 2.2", "200 responses carry Last-Modified", "GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", []int{200}, requireHeader("Last-Modified")},
+}
+
+func TestConformance(t *testing.T) {
+	for _, tc := range conformanceCases {
+		t.Run(tc.rfc+" "+tc.name, func(t *testing.T) {
+			conn := &scriptedConn{r: strings.NewReader(tc.raw)}
+			newTestServer().HandleConnection(conn)
+
+			br := bufio.NewReader(&conn.out)
+			for _, code := range tc.codes {
+				resp, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatalf("got an error parsing the response: %v\n", err.Error())
+				}
+				if resp.StatusCode != code {
+					t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+				}
+				if tc.check != nil {
+					tc.check(t, resp)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if br.Buffered() > 0 || conn.out.Len() > 0 {
+				t.Fatalf("Unexpected trailing output after %d responses\n", len(tc.codes))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package tritonhttp
+
+import (
+	"io"
+	"net"
+	"strings"
+)
+
+// expectContinue is the only expectation (RFC 9110 section 10.1.1) the
+// server knows how to meet.
+const expectContinue = "100-continue"
+
+// continueReader is the body of a request sent with "Expect: 100-continue".
+// The client holds the body back until told to go on, so the interim 100
+// Continue response is sent when the handler first reads the body: a
+// handler that answers without reading it, e.g. to refuse the upload,
+// spares the client sending it.
+type continueReader struct {
+	body io.Reader
+	// send writes the 100 Continue response
+	send func() error
+	sent bool
+	err  error
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if !c.sent {
+		c.sent = true
+		c.err = c.send()
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.body.Read(p)
+}
+
+// checkExpect handles the "Expect" header of req, read from conn. It
+// returns the 417 Expectation Failed response for an expectation other than
+// 100-continue, or one that ExpectContinue turned down; the body is never
+// read then, so the connection is closed. Otherwise the body of req is set
+// up to ask for the body once it is read.
+func (s *Server) checkExpect(conn net.Conn, req *Request) *Response {
+	value, ok := req.Headers[EXPECT]
+	if !ok {
+		return nil
+	}
+	if !strings.EqualFold(value, expectContinue) {
+		return s.newResponse(statusExpectationFailed, responseOptions{req: req, close: true, detail: "unsupported expectation " + value})
+	}
+	if s.ExpectContinue != nil && !s.ExpectContinue(req) {
+		return s.newResponse(statusExpectationFailed, responseOptions{req: req, close: true, detail: "the request body is not wanted"})
+	}
+	if req.ContentLength == 0 {
+		return nil
+	}
+	req.Body = &continueReader{body: req.Body, send: func() error {
+		res := &Response{}
+		res.HandleInformational(statusContinue)
+		return s.writeResponse(conn, res)
+	}}
+	return nil
+}
+
+// awaitsContinue reports whether the client of req still holds its body
+// back, waiting for a 100 Continue that was never sent.
+func awaitsContinue(req *Request) bool {
+	c, ok := req.Body.(*continueReader)
+	return ok && !c.sent
+}
@@ -0,0 +1,79 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExpectContinue(t *testing.T) {
+	s := bodyEchoServer()
+	client, server := net.Pipe()
+	go s.HandleConnection(server)
+	defer client.Close()
+
+	go func() {
+		_, _ = io.WriteString(client, "POST /echo HTTP/1.1\r\nHost: website1\r\nConnection: close\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	}()
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 100 {
+		t.Fatalf("Expected response code of 100 before the body but got: %v\n", resp.StatusCode)
+	}
+	go func() {
+		_, _ = io.WriteString(client, "hello")
+	}()
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != 200 || string(body) != "hello" {
+		t.Fatalf("Expected the body to be echoed but got: %v %q\n", resp.StatusCode, body)
+	}
+}
+
+func TestExpectationFailed(t *testing.T) {
+	s := bodyEchoServer()
+	s.ExpectContinue = func(req *Request) bool {
+		return req.ContentLength <= 4
+	}
+	s.HandleFunc("/ignore", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		return res
+	})
+	tests := []struct {
+		name    string
+		request string
+		code    int
+	}{
+		{"turned down", "POST /echo HTTP/1.1\r\nHost: website1\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n", 417},
+		{"unknown expectation", "POST /echo HTTP/1.1\r\nHost: website1\r\nExpect: 200-ok\r\nContent-Length: 2\r\n\r\n", 417},
+		// answered without reading the body, which never comes
+		{"body not read", "POST /ignore HTTP/1.1\r\nHost: website1\r\nExpect: 100-continue\r\nContent-Length: 2\r\n\r\n", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &scriptedConn{r: strings.NewReader(tt.request + "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n")}
+			s.HandleConnection(conn)
+			br := bufio.NewReader(strings.NewReader(conn.out.String()))
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("Error reading response: %v\n", err.Error())
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			if resp.StatusCode != tt.code || !resp.Close {
+				t.Fatalf("Expected response code of %v closing the connection but got: %v %v\n", tt.code, resp.StatusCode, resp.Close)
+			}
+			if _, err := http.ReadResponse(br, nil); err == nil {
+				t.Fatal("Expected no 100 Continue nor further response")
+			}
+		})
+	}
+}
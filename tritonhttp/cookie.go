@@ -0,0 +1,195 @@
+package tritonhttp
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite is the SameSite attribute of a cookie.
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// A Cookie is a name-value pair, received in the "Cookie" request header or
+// sent in a "Set-Cookie" response header (RFC 6265). The attributes are
+// only meaningful for Set-Cookie.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge > 0 sets Max-Age in seconds, MaxAge < 0 deletes the cookie
+	// right away (Max-Age=0), and 0 leaves Max-Age out
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSite
+}
+
+var errInvalidCookie = errors.New("invalid cookie name or value")
+
+// String returns the serialization of c for a Set-Cookie header.
+func (c *Cookie) String() string {
+	var sb strings.Builder
+	sb.WriteString(c.Name + "=" + c.Value)
+	if c.Path != "" {
+		sb.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		sb.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		sb.WriteString("; Expires=" + FormatTime(c.Expires))
+	}
+	switch {
+	case c.MaxAge > 0:
+		sb.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	case c.MaxAge < 0:
+		sb.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		sb.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		sb.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		sb.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		sb.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		sb.WriteString("; SameSite=None")
+	}
+	return sb.String()
+}
+
+// valid reports whether c can be sent without breaking the header syntax.
+func (c *Cookie) valid() bool {
+	if !isToken(c.Name) {
+		return false
+	}
+	value := c.Value
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return false
+		}
+	}
+	for _, attr := range []string{c.Path, c.Domain} {
+		if strings.ContainsAny(attr, ";") || hasCTL(attr, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// isToken reports whether s is a non-empty RFC 7230 token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieOctet reports whether c may appear in a cookie value
+// (RFC 6265 section 4.1.1).
+func isCookieOctet(c byte) bool {
+	return c == 0x21 || (c >= 0x23 && c <= 0x2b) || (c >= 0x2d && c <= 0x3a) ||
+		(c >= 0x3c && c <= 0x5b) || (c >= 0x5d && c <= 0x7e)
+}
+
+// parseCookies parses the value of a "Cookie" request header. Malformed
+// pairs are skipped, so one bad cookie doesn't hide the others.
+func parseCookies(header string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(header, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			continue
+		}
+		c := &Cookie{Name: name, Value: value}
+		if !c.valid() {
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
+
+// Cookie returns the cookie called name sent with req, if any.
+func (req *Request) Cookie(name string) (*Cookie, bool) {
+	for _, c := range req.Cookies {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// SetCookie adds a "Set-Cookie" header for c to res. It fails if the name
+// or value of c is malformed.
+func (res *Response) SetCookie(c *Cookie) error {
+	if !c.valid() {
+		return errInvalidCookie
+	}
+	res.Cookies = append(res.Cookies, c)
+	return nil
+}
+
+// parseSetCookie parses the value of a "Set-Cookie" response header.
+// Unknown or malformed attributes are ignored.
+func parseSetCookie(header string) *Cookie {
+	parts := strings.Split(header, ";")
+	name, value, _ := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	c := &Cookie{Name: name, Value: value}
+	for _, part := range parts[1:] {
+		attr, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(attr) {
+		case "path":
+			c.Path = val
+		case "domain":
+			c.Domain = val
+		case "expires":
+			c.Expires, _ = ParseTime(val)
+		case "max-age":
+			if n, err := strconv.Atoi(val); err == nil {
+				c.MaxAge = n
+				if n <= 0 {
+					c.MaxAge = -1
+				}
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HttpOnly = true
+		case "samesite":
+			switch strings.ToLower(val) {
+			case "lax":
+				c.SameSite = SameSiteLax
+			case "strict":
+				c.SameSite = SameSiteStrict
+			case "none":
+				c.SameSite = SameSiteNone
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRequestCookies(t *testing.T) {
+	req, err := readRequestString("GET / HTTP/1.1\r\nHost: website1\r\nCookie: a=1; bad name=2\r\nCookie: b=\"two\"; c=x,y\r\n\r\n")
+	if err != nil {
+		t.Fatalf("Error reading request: %v\n", err.Error())
+	}
+	if err := req.processHeader(); err != nil {
+		t.Fatalf("Error processing headers: %v\n", err.Error())
+	}
+	if len(req.Cookies) != 2 {
+		t.Fatalf("Expected 2 well-formed cookies but got %v\n", len(req.Cookies))
+	}
+	if c, ok := req.Cookie("b"); !ok || c.Value != `"two"` {
+		t.Fatalf("Unexpected cookie b: %+v\n", c)
+	}
+	if _, ok := req.Cookie("c"); ok {
+		t.Fatal("A cookie with a comma in its value was accepted")
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	res := &Response{}
+	res.HandleOK()
+	expires := time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cookies := []*Cookie{
+		{Name: "session", Value: "abc", Path: "/", HttpOnly: true, Secure: true, SameSite: SameSiteLax},
+		{Name: "theme", Value: "dark", Expires: expires, MaxAge: 3600},
+		{Name: "old", Value: "", MaxAge: -1},
+	}
+	for _, c := range cookies {
+		if err := res.SetCookie(c); err != nil {
+			t.Fatalf("Error setting cookie %v: %v\n", c.Name, err.Error())
+		}
+	}
+	for _, c := range []*Cookie{{Name: "bad;name", Value: "x"}, {Name: "a", Value: "b c"}} {
+		if err := res.SetCookie(c); err == nil {
+			t.Fatalf("Malformed cookie %+v was accepted\n", c)
+		}
+	}
+
+	want := []string{
+		"session=abc; Path=/; HttpOnly; Secure; SameSite=Lax",
+		"theme=dark; Expires=Wed, 01 Mar 2023 00:00:00 GMT; Max-Age=3600",
+		"old=; Max-Age=0",
+	}
+	var buf bytes.Buffer
+	if _, err := res.WriteTo(&buf); err != nil {
+		t.Fatalf("Error writing response: %v\n", err.Error())
+	}
+	for _, line := range want {
+		if !bytes.Contains(buf.Bytes(), []byte("Set-Cookie: "+line+"\r\n")) {
+			t.Fatalf("Missing Set-Cookie %q in:\n%v\n", line, buf.String())
+		}
+	}
+
+	parsed, err := ReadResponse(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if len(parsed.Cookies) != len(cookies) {
+		t.Fatalf("Expected %d cookies but got %d\n", len(cookies), len(parsed.Cookies))
+	}
+	for i, c := range parsed.Cookies {
+		if c.String() != want[i] {
+			t.Fatalf("Cookie %d did not round-trip: %q\n", i, c.String())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tritonhttp
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// devCacheControl keeps browsers and proxies from storing responses in
+// development mode, so every reload fetches the file as it is on disk.
+const devCacheControl = "no-store"
+
+// startDevWatch watches DocRoot and the docroots of the virtual hosts in
+// development mode, forgetting what the server cached about a file as soon
+// as it changes, until the returned function is called. Directories created
+// while watching are watched as well.
+func (s *Server) startDevWatch() (stop func()) {
+	if !s.Dev {
+		return func() {}
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Failed to watch the docroots: %v", err)
+		return func() {}
+	}
+	roots := []string{}
+	if s.DocRoot != "" {
+		roots = append(roots, s.DocRoot)
+	}
+	for _, docroot := range s.virtualHosts() {
+		roots = append(roots, docroot)
+	}
+	for _, root := range roots {
+		watchTree(watcher, root)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					watchTree(watcher, event.Name)
+				}
+				s.invalidate(event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Failed to watch the docroots: %v", err)
+			}
+		}
+	}()
+	return func() {
+		watcher.Close()
+		<-done
+	}
+}
+
+// watchTree adds root and the directories under it to watcher; fsnotify
+// does not watch subdirectories on its own. root may be a regular file, in
+// which case nothing is added.
+func watchTree(watcher *fsnotify.Watcher, root string) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Printf("Failed to watch %v: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// invalidate drops the cached data about path, and about the files under it
+// if it is a directory, and tells the pages waiting for live reloads.
+func (s *Server) invalidate(path string) {
+	s.digests.forget(path)
+	s.reloads.notify()
+}
+
+// forget drops the sums of path and of the files under it.
+func (c *digestCache) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.entries {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(c.entries, p)
+		}
+	}
+}
+
+// disableCaching strips the validators from res, a response for a file,
+// and forbids storing it, for development mode.
+func disableCaching(res *Response) {
+	delete(res.Headers, "ETag")
+	res.LastModified = time.Time{}
+	res.Headers["Cache-Control"] = devCacheControl
+}
@@ -0,0 +1,57 @@
+package tritonhttp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDevMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.3f9a1c2b.js")
+	if err := os.WriteFile(path, []byte("version 1"), 0o644); err != nil {
+		t.Fatalf("Error writing %v: %v\n", path, err.Error())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error stating %v: %v\n", path, err.Error())
+	}
+	s := &Server{DocRoot: dir, VirtualHosts: map[string]string{"website1": dir}, ContentDigests: true, ImmutableAssets: DefaultImmutableAssets, Dev: true}
+	defer s.startDevWatch()()
+
+	get := func() (string, string) {
+		resp := parseResponse(t, serveRaw(t, s, "GET /main.3f9a1c2b.js HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+		}
+		for _, h := range []string{"ETag", "Last-Modified"} {
+			if v := resp.Header.Get(h); v != "" {
+				t.Fatalf("Expected no %v in development mode but got: %q\n", h, v)
+			}
+		}
+		return resp.Header.Get("Cache-Control"), resp.Header.Get("Repr-Digest")
+	}
+	cacheControl, digest := get()
+	if cacheControl != devCacheControl {
+		t.Fatalf("Expected Cache-Control %q but got: %q\n", devCacheControl, cacheControl)
+	}
+
+	// an edit keeping the size and modification time goes unnoticed by
+	// the digest cache, unless the watcher drops the entry
+	if err := os.WriteFile(path, []byte("version 2"), 0o644); err != nil {
+		t.Fatalf("Error writing %v: %v\n", path, err.Error())
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("Error setting the times of %v: %v\n", path, err.Error())
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if _, got := get(); got != digest {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the digest to change after an edit but it stayed: %q\n", digest)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,82 @@
+package tritonhttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileDigest is the SHA-256 sum of a file, valid as long as the file keeps
+// the recorded size and modification time.
+type fileDigest struct {
+	size    int64
+	modTime time.Time
+	sum     []byte
+}
+
+// digestCache remembers the digests of served files so each file is only
+// hashed once per change.
+type digestCache struct {
+	mu      sync.Mutex
+	entries map[string]fileDigest
+}
+
+// sum returns the SHA-256 sum of the file at path, which has the given size
+// and modification time, hashing it only if the cache holds no current sum.
+func (c *digestCache) sum(path string, size int64, modTime time.Time) ([]byte, error) {
+	c.mu.Lock()
+	d, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && d.size == size && d.modTime.Equal(modTime) {
+		return d.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	d = fileDigest{size: size, modTime: modTime, sum: h.Sum(nil)}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]fileDigest)
+	}
+	c.entries[path] = d
+	c.mu.Unlock()
+	return d.sum, nil
+}
+
+// addDigest sets the "Repr-Digest" (RFC 9530) and legacy "Digest" (RFC
+// 3230) headers of res, a 200 response, to the SHA-256 sum of the whole
+// representation. A range response served from res keeps them, as both
+// describe the full representation rather than the bytes sent.
+func (s *Server) addDigest(res *Response) {
+	var sum []byte
+	if res.Body != "" {
+		// transcoded content, only hashed for this response
+		h := sha256.Sum256([]byte(res.Body))
+		sum = h[:]
+	} else if res.encodeIn != "" {
+		// the compressed body of a 304 is never built
+		return
+	} else {
+		var err error
+		sum, err = s.digests.sum(res.FilePath, res.ContentLength, res.LastModified)
+		if err != nil {
+			log.Printf("Failed to compute digest of %v: %v", res.FilePath, err)
+			return
+		}
+	}
+	encoded := base64.StdEncoding.EncodeToString(sum)
+	res.Headers["Repr-Digest"] = "sha-256=:" + encoded + ":"
+	res.Headers["Digest"] = "SHA-256=" + encoded
+}
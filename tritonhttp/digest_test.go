@@ -0,0 +1,74 @@
+package tritonhttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContentDigests(t *testing.T) {
+	content, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index.html: %v\n", err.Error())
+	}
+	sum := sha256.Sum256(content)
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+
+	s := newTestServer()
+	s.ContentDigests = true
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if got := resp.Header.Get("Repr-Digest"); got != "sha-256=:"+encoded+":" {
+		t.Fatalf("Unexpected Repr-Digest %q\n", got)
+	}
+	if got := resp.Header.Get("Digest"); got != "SHA-256="+encoded {
+		t.Fatalf("Unexpected Digest %q\n", got)
+	}
+
+	resp = parseResponse(t, serveRaw(t, newTestServer(), "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if got := resp.Header.Get("Repr-Digest"); got != "" {
+		t.Fatalf("Unexpected Repr-Digest %q with digests disabled\n", got)
+	}
+}
+
+func TestDigestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	write := func(content string, modTime time.Time) os.FileInfo {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing file: %v\n", err.Error())
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Error setting times: %v\n", err.Error())
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Error stating file: %v\n", err.Error())
+		}
+		return info
+	}
+
+	var c digestCache
+	modTime := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		content string
+		modTime time.Time
+		want    string
+	}{
+		{"first", modTime, "first"},
+		// same size and time: the cached sum is reused
+		{"fresh", modTime, "first"},
+		{"fresh", modTime.Add(time.Second), "fresh"},
+	}
+	for _, tt := range tests {
+		info := write(tt.content, tt.modTime)
+		got, err := c.sum(path, info.Size(), info.ModTime())
+		if err != nil {
+			t.Fatalf("Error computing digest: %v\n", err.Error())
+		}
+		if want := sha256.Sum256([]byte(tt.want)); string(got) != string(want[:]) {
+			t.Fatalf("Digest after writing %q does not match the content %q\n", tt.content, tt.want)
+		}
+	}
+}
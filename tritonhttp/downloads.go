@@ -0,0 +1,97 @@
+package tritonhttp
+
+import (
+	"sync"
+	"time"
+)
+
+// DownloadStats describes the downloads of one URL.
+type DownloadStats struct {
+	// Requests counts the successful GET requests
+	Requests int64 `json:"requests"`
+	// Bytes counts the bytes sent for them, headers included
+	Bytes int64 `json:"bytes"`
+	// RangeResumes counts the requests that resumed a download, i.e.
+	// asked for a range that does not start at the beginning
+	RangeResumes int64 `json:"rangeResumes"`
+	// BytesPerSecond is the average throughput of the downloads
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+
+	// elapsed is the time spent sending Bytes
+	elapsed time.Duration
+}
+
+// downloadStats collects DownloadStats per virtual host and path. Only
+// URLs that were served successfully are counted, so the number of
+// entries is bounded by the number of files served.
+type downloadStats struct {
+	mu    sync.Mutex
+	hosts map[string]map[string]*DownloadStats
+}
+
+func (ds *downloadStats) record(host, path string, n int64, elapsed time.Duration, resumed bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.hosts == nil {
+		ds.hosts = make(map[string]map[string]*DownloadStats)
+	}
+	paths := ds.hosts[host]
+	if paths == nil {
+		paths = make(map[string]*DownloadStats)
+		ds.hosts[host] = paths
+	}
+	stats := paths[path]
+	if stats == nil {
+		stats = &DownloadStats{}
+		paths[path] = stats
+	}
+	stats.Requests++
+	stats.Bytes += n
+	stats.elapsed += elapsed
+	if resumed {
+		stats.RangeResumes++
+	}
+	if stats.elapsed > 0 {
+		stats.BytesPerSecond = float64(stats.Bytes) / stats.elapsed.Seconds()
+	}
+}
+
+// snapshot returns a copy of the stats.
+func (ds *downloadStats) snapshot() map[string]map[string]DownloadStats {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	snapshot := make(map[string]map[string]DownloadStats, len(ds.hosts))
+	for host, paths := range ds.hosts {
+		copied := make(map[string]DownloadStats, len(paths))
+		for path, stats := range paths {
+			copied[path] = *stats
+		}
+		snapshot[host] = copied
+	}
+	return snapshot
+}
+
+// DownloadStats returns the download statistics of the URLs served, keyed
+// by virtual host and then by path.
+func (s *Server) DownloadStats() map[string]map[string]DownloadStats {
+	return s.downloads.snapshot()
+}
+
+// recordDownload counts res, whose n bytes took elapsed to send, in the
+// download statistics if it answered a GET request successfully.
+func (s *Server) recordDownload(res *Response, n int64, elapsed time.Duration) {
+	req := res.Request
+	if req == nil || req.Method != methodGet || (res.StatusCode != statusOK && res.StatusCode != statusPartialContent) {
+		return
+	}
+	host := s.transferHost(req.Host)
+	if host == "" {
+		return
+	}
+	path, err := cleanURLPath(req.URL)
+	if err != nil {
+		return
+	}
+	resumed := res.StatusCode == statusPartialContent && res.Offset > 0
+	s.downloads.record(host, path, n, elapsed, resumed)
+}
@@ -0,0 +1,38 @@
+package tritonhttp
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestDownloadStats(t *testing.T) {
+	s := newTestServer()
+	s.RangeTypes = []string{"text/html"}
+	s.HandleAdmin("/_admin/")
+	for _, raw := range []string{
+		"GET /index.html?v=1 HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n",
+		"GET /index.html HTTP/1.1\r\nHost: website1\r\nRange: bytes=0-4\r\nConnection: close\r\n\r\n",
+		"GET /index.html HTTP/1.1\r\nHost: website1\r\nRange: bytes=5-\r\nConnection: close\r\n\r\n",
+		"GET /missing.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n",
+	} {
+		serveRaw(t, s, raw)
+	}
+
+	resp := parseResponse(t, serveRaw(t, s, "GET /_admin/downloads HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v\n", err.Error())
+	}
+	var stats map[string]map[string]DownloadStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Fatalf("Error decoding download stats: %v\n", err.Error())
+	}
+	got := stats["website1"]["/index.html"]
+	if got.Requests != 3 || got.RangeResumes != 1 || got.Bytes == 0 {
+		t.Fatalf("Expected 3 requests with 1 resume for /index.html but got: %+v\n", got)
+	}
+	if _, ok := stats["website1"]["/missing.html"]; ok {
+		t.Fatalf("Expected failed requests not to be counted but got: %v\n", stats)
+	}
+}
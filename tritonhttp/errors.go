@@ -0,0 +1,95 @@
+package tritonhttp
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrRequestTimeout is returned by ReadRequest when the read deadline expired
+// after part of a request had already been received.
+var ErrRequestTimeout = errors.New("request timed out")
+
+// ErrURITooLong and ErrHeaderTooLarge are returned by ReadRequest when the
+// request line or a header line exceeds the configured length limit, or
+// when a request has too many header lines.
+var (
+	ErrURITooLong     = errors.New("request line too long")
+	ErrHeaderTooLarge = errors.New("request header fields too large")
+)
+
+// ErrResponseTooLarge is returned by Client.Do when the body of a response
+// exceeds Client.MaxBodyBytes.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// badRequestClass describes how the server reacts to one kind of request it
+// can't serve: which status it answers with, if any, and whether the
+// connection survives. The connection is only kept when the whole request
+// was read and its framing can still be trusted, and once its body has
+// been discarded, so the body is never taken for the next request.
+type badRequestClass struct {
+	name       string
+	statusCode int  // 0 means the connection is closed without a response
+	keepAlive  bool // whether the next request on the connection is read
+}
+
+var (
+	// the first line contains binary data, e.g. a TLS handshake sent to
+	// the plain text port
+	classNotHTTP = &badRequestClass{"not an HTTP request", 0, false}
+	// the request line can't be split into method, target and version,
+	// or the method or target is invalid
+	classRequestLine = &badRequestClass{"malformed request line", statusBadRequest, false}
+	// the version is well-formed, but not HTTP/1.1, e.g. HTTP/2.0, or an
+	// HTTP/0.9 request line without a version
+	classVersion = &badRequestClass{"unsupported version", statusHTTPVersionNotSupported, false}
+	// a header line is malformed, or headers conflict with each other
+	classHeader = &badRequestClass{"malformed header", statusBadRequest, false}
+	// the headers were read completely but there is no Host header
+	classMissingHost = &badRequestClass{"missing host", statusBadRequest, true}
+	// the request line or the header section is over its size limit
+	classURITooLong     = &badRequestClass{"request line too long", statusURITooLong, false}
+	classHeaderTooLarge = &badRequestClass{"header section too large", statusHeaderTooLarge, false}
+	// the client stalled in the middle of a request
+	classTimeout = &badRequestClass{"request timeout", statusRequestTimeout, false}
+	// the client closed the connection in the middle of a request, so
+	// there is nobody left to answer
+	classTruncated = &badRequestClass{"truncated request", 0, false}
+)
+
+// requestError is a parse error tagged with its badRequestClass.
+type requestError struct {
+	class *badRequestClass
+	err   error
+}
+
+func (e *requestError) Error() string {
+	return e.class.name + ": " + e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(class *badRequestClass, err error) error {
+	return &requestError{class: class, err: err}
+}
+
+// classOf returns the badRequestClass of an error returned by ReadRequest or
+// processHeader.
+func classOf(err error) *badRequestClass {
+	var rerr *requestError
+	switch {
+	case errors.As(err, &rerr):
+		return rerr.class
+	case errors.Is(err, ErrRequestTimeout):
+		return classTimeout
+	case errors.Is(err, ErrURITooLong):
+		return classURITooLong
+	case errors.Is(err, ErrHeaderTooLarge):
+		return classHeaderTooLarge
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return classTruncated
+	default:
+		return classRequestLine
+	}
+}
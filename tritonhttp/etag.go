@@ -0,0 +1,134 @@
+package tritonhttp
+
+import (
+	"encoding/base64"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The built-in values of VirtualHostSettings.ETag.
+const (
+	// ETagModTime derives the entity tag of a file from its modification
+	// time and size, which costs a stat; the default
+	ETagModTime = "mtime"
+	// ETagContentHash derives it from a SHA-256 hash of the content, so
+	// copies of a file on several servers, or a file rewritten unchanged,
+	// keep their tag; files are only hashed again once they change
+	ETagContentHash = "hash"
+	// ETagWeak is ETagModTime marked weak (W/): as two writes within one
+	// tick of the file system clock, leaving the size alone, keep the tag,
+	// it only tells that the content is equivalent. Weak tags still make
+	// If-None-Match revalidation work, but never satisfy If-Match or
+	// If-Range, which compare strongly
+	ETagWeak = "weak"
+	// ETagStrong is ETagContentHash: a strong tag changes with every byte
+	// of the content
+	ETagStrong = "strong"
+)
+
+// ETagFunc computes the entity tag of the file at path, described by info,
+// as sent in the ETag header: quoted, with a W/ prefix if weak.
+type ETagFunc func(path string, info os.FileInfo) (string, error)
+
+// etagFunc returns the ETag strategy of the virtual host of req. Unknown
+// strategies fall back to ETagModTime.
+func (s *Server) etagFunc(req *Request) ETagFunc {
+	_, settings, _ := lookupHost(s.hostSettings(), req.Host)
+	switch settings.ETag {
+	case ETagContentHash, ETagStrong:
+		return s.contentETag
+	case ETagWeak:
+		return weakModTimeETag
+	}
+	if f, ok := s.ETagFuncs[settings.ETag]; ok {
+		return f
+	}
+	return modTimeETag
+}
+
+// fileETagFor returns the entity tag of the file at path served for req,
+// or "" if it cannot be computed.
+func (s *Server) fileETagFor(req *Request, path string, info os.FileInfo) string {
+	etag, err := s.etagFunc(req)(path, info)
+	if err != nil {
+		log.Printf("Failed to compute ETag of %v: %v", path, err)
+		return ""
+	}
+	return etag
+}
+
+// modTimeETag is the ETagModTime strategy.
+func modTimeETag(_ string, info os.FileInfo) (string, error) {
+	return fileETag(info), nil
+}
+
+// weakModTimeETag is the ETagWeak strategy.
+func weakModTimeETag(_ string, info os.FileInfo) (string, error) {
+	return "W/" + fileETag(info), nil
+}
+
+// contentETag is the ETagContentHash strategy.
+func (s *Server) contentETag(path string, info os.FileInfo) (string, error) {
+	sum, err := s.digests.sum(path, info.Size(), info.ModTime())
+	if err != nil {
+		return "", err
+	}
+	return `"` + base64.RawURLEncoding.EncodeToString(sum) + `"`, nil
+}
+
+// fileETag returns the strong entity tag of a file, derived from its
+// modification time and size. Any write that changes either yields a new
+// tag.
+func fileETag(info os.FileInfo) string {
+	return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16) + `"`
+}
+
+// parseETagList splits the value of an "If-Match" or "If-None-Match"
+// header into its entity tags, keeping the quotes and any W/ prefix. The
+// value "*" yields a list holding only "*". Malformed elements are dropped.
+func parseETagList(value string) []string {
+	var tags []string
+	value = strings.Trim(value, " \t")
+	if value == "*" {
+		return []string{"*"}
+	}
+	for value != "" {
+		value = strings.TrimLeft(value, " \t,")
+		start := 0
+		if strings.HasPrefix(value, "W/") {
+			start = 2
+		}
+		if len(value) <= start || value[start] != '"' {
+			// skip to the next element
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value = value[i+1:]
+				continue
+			}
+			break
+		}
+		end := strings.IndexByte(value[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		tags = append(tags, value[:end])
+		value = value[end:]
+	}
+	return tags
+}
+
+// strongMatch reports whether the entity tags a and b match under the
+// strong comparison of RFC 9110 section 8.8.3.2: both must be strong and
+// identical.
+func strongMatch(a, b string) bool {
+	return a == b && !strings.HasPrefix(a, "W/")
+}
+
+// weakMatch reports whether the entity tags a and b match under the weak
+// comparison of RFC 9110 section 8.8.3.2: they are identical once any W/
+// prefix is dropped.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
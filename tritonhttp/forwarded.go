@@ -0,0 +1,94 @@
+package tritonhttp
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The values of Server.Forwarded.
+const (
+	ForwardedAppend  = "append"
+	ForwardedReplace = "replace"
+	ForwardedOff     = "off"
+)
+
+// Headers identifying the client to upstream servers.
+const (
+	FORWARDED         = "forwarded"
+	X_FORWARDED_FOR   = "x-forwarded-for"
+	X_FORWARDED_PROTO = "x-forwarded-proto"
+	X_FORWARDED_HOST  = "x-forwarded-host"
+	X_REAL_IP         = "x-real-ip"
+)
+
+// addForwarded tells the upstream request upstream who the client of req
+// is, with the "Forwarded" header of RFC 7239 and the legacy X-Forwarded-*
+// and X-Real-IP headers, as Server.Forwarded says.
+func (s *Server) addForwarded(upstream, req *Request) {
+	mode := s.Forwarded
+	if mode == ForwardedOff {
+		return
+	}
+	if mode == ForwardedReplace {
+		for _, k := range []string{FORWARDED, X_FORWARDED_FOR, X_FORWARDED_PROTO, X_FORWARDED_HOST, X_REAL_IP} {
+			delete(upstream.Headers, k)
+		}
+	}
+	client := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	host := req.Headers[HOST]
+
+	element := make([]string, 0, 3)
+	if client != "" {
+		node := client
+		if strings.Contains(node, ":") {
+			node = "[" + node + "]"
+		}
+		element = append(element, "for="+forwardedValue(node))
+	}
+	if host != "" {
+		element = append(element, "host="+forwardedValue(host))
+	}
+	element = append(element, "proto="+proto)
+	upstream.Headers[FORWARDED] = appendList(upstream.Headers[FORWARDED], strings.Join(element, ";"))
+
+	if client != "" {
+		upstream.Headers[X_FORWARDED_FOR] = appendList(upstream.Headers[X_FORWARDED_FOR], client)
+	}
+	// the original scheme, host and client are those seen by the first
+	// proxy, so the values of earlier proxies are kept
+	setDefault(upstream.Headers, X_FORWARDED_PROTO, proto)
+	setDefault(upstream.Headers, X_FORWARDED_HOST, host)
+	setDefault(upstream.Headers, X_REAL_IP, client)
+}
+
+// forwardedValue returns v as a value of the Forwarded header: as is if it
+// is a token, otherwise quoted.
+func forwardedValue(v string) string {
+	if isToken(v) {
+		return v
+	}
+	return strconv.Quote(v)
+}
+
+// appendList appends v to the comma-separated list value list.
+func appendList(list, v string) string {
+	if list == "" {
+		return v
+	}
+	return list + ", " + v
+}
+
+// setDefault sets headers[k] to v, unless it is already set or v is empty.
+func setDefault(headers map[string]string, k, v string) {
+	if _, ok := headers[k]; !ok && v != "" {
+		headers[k] = v
+	}
+}
@@ -0,0 +1,72 @@
+package tritonhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		mode    string
+		headers string
+		want    map[string]string
+	}{
+		{"", "", map[string]string{
+			"Forwarded":         `for=127.0.0.1;host=proxied;proto=http`,
+			"X-Forwarded-For":   "127.0.0.1",
+			"X-Forwarded-Proto": "http",
+			"X-Forwarded-Host":  "proxied",
+			"X-Real-Ip":         "127.0.0.1",
+		}},
+		{ForwardedAppend, "Forwarded: for=192.0.2.1\r\nX-Forwarded-For: 192.0.2.1\r\nX-Forwarded-Proto: https\r\nX-Real-IP: 192.0.2.1\r\n", map[string]string{
+			"Forwarded":         `for=192.0.2.1, for=127.0.0.1;host=proxied;proto=http`,
+			"X-Forwarded-For":   "192.0.2.1, 127.0.0.1",
+			"X-Forwarded-Proto": "https",
+			"X-Real-Ip":         "192.0.2.1",
+		}},
+		{ForwardedReplace, "Forwarded: for=192.0.2.1\r\nX-Forwarded-For: 192.0.2.1\r\nX-Forwarded-Proto: https\r\n", map[string]string{
+			"Forwarded":         `for=127.0.0.1;host=proxied;proto=http`,
+			"X-Forwarded-For":   "127.0.0.1",
+			"X-Forwarded-Proto": "http",
+		}},
+		{ForwardedOff, "X-Forwarded-For: 192.0.2.1\r\n", map[string]string{
+			"Forwarded":       "",
+			"X-Forwarded-For": "192.0.2.1",
+			"X-Real-Ip":       "",
+		}},
+	}
+	for _, tt := range tests {
+		s := newTestServer()
+		s.VirtualHostSettings = map[string]VirtualHostSettings{
+			"proxied": {Upstreams: []string{strings.TrimPrefix(upstream.URL, "http://")}},
+		}
+		s.Forwarded = tt.mode
+		conn := &scriptedConn{r: strings.NewReader("GET / HTTP/1.1\r\nHost: proxied\r\n" + tt.headers + "Connection: close\r\n\r\n")}
+		s.HandleConnection(conn)
+		if resp := parseResponse(t, conn.out.String()); resp.StatusCode != 200 {
+			t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+		}
+		for k, v := range tt.want {
+			if got.Get(k) != v {
+				t.Fatalf("Expected %v %q with mode %q but got: %q\n", k, v, tt.mode, got.Get(k))
+			}
+		}
+	}
+}
+
+func TestForwardedValue(t *testing.T) {
+	req := &Request{Headers: map[string]string{HOST: "website1:8080"}, RemoteAddr: "[2001:db8::1]:5000"}
+	upstream := &Request{Headers: map[string]string{}}
+	(&Server{}).addForwarded(upstream, req)
+	if want := `for="[2001:db8::1]";host="website1:8080";proto=http`; upstream.Headers[FORWARDED] != want {
+		t.Fatalf("Expected Forwarded %q but got: %q\n", want, upstream.Headers[FORWARDED])
+	}
+}
@@ -0,0 +1,94 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+var fuzzSeeds = []string{
+	// valid
+	"GET / HTTP/1.1\r\nHost: website1\r\n\r\n",
+	"GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\nUser-Agent: gotest\r\n\r\n",
+	"\r\n\r\nGET / HTTP/1.1\r\nHost: website1\r\n\r\nGET /a HTTP/1.1\r\nHost: website1\r\n\r\n",
+	"GET http://website1/a.html HTTP/1.1\r\nHost: website1\r\n\r\n",
+	"CONNECT a:80 HTTP/1.1\r\nHost: a:80\r\n\r\n",
+	// truncated
+	"",
+	"GET",
+	"GET / HTTP/1.1\r",
+	"GET / HTTP/1.1\r\nHost: web",
+	"GET / HTTP/1.1\r\nHost: website1\r\n",
+	// hostile
+	"foobar\r\n\r\n",
+	"GET / HTTP/1.1\nHost: website1\n\n",
+	"GET / HTTP/1.1\r\nHost: website1\r\nHost: website2\r\n\r\n",
+	"GET / HTTP/1.1\r\n: empty\r\nHost : x\r\n\r\n",
+	"GET /\x00 HTTP/1.1\r\nHost: \x7f\r\n\r\n",
+	"GET http:// HTTP/1.1\r\nHost: \r\n\r\n",
+	"\x16\x03\x01\x00\xa5\x01\x00\x00\xa1\x03\x03",
+	"GET / HTTP/1.1\r\n" + strings.Repeat("X-A: 1\r\n", 200) + "\r\n",
+	"GET /" + strings.Repeat("a", 10000) + " HTTP/1.1\r\n\r\n",
+}
+
+func FuzzReadRequest(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		br := bufio.NewReader(strings.NewReader(raw))
+		limits := requestLimits{maxLineBytes: DefaultMaxHeaderLineBytes, maxHeaders: DefaultMaxHeaderCount}
+		// Every iteration consumes input, so a finite input must end the
+		// loop with an error
+		for i := 0; ; i++ {
+			if i > len(raw) {
+				t.Fatalf("ReadRequest did not terminate on %q\n", raw)
+			}
+			req, n, err := readRequest(br, limits)
+			if n > len(raw) {
+				t.Fatalf("ReadRequest reports %d bytes consumed from %d bytes of input\n", n, len(raw))
+			}
+			if err != nil {
+				return
+			}
+			if err := req.processHeader(); err != nil {
+				continue
+			}
+			// CONNECT names a "host:port" authority, every other method a path
+			if req.Method == methodConnect {
+				if _, port, err := net.SplitHostPort(req.URL); err != nil || port == "" {
+					t.Fatalf("processHeader accepted CONNECT target %q\n", req.URL)
+				}
+			} else if req.URL[0] != '/' {
+				t.Fatalf("processHeader accepted URL %q\n", req.URL)
+			}
+		}
+	})
+}
+
+func FuzzReadLine(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, 64)
+	}
+	f.Fuzz(func(t *testing.T, raw string, max int) {
+		if max < 0 {
+			max = -max
+		}
+		br := bufio.NewReaderSize(strings.NewReader(raw), 16)
+		consumed := 0
+		for {
+			line, err := readLineLimit(br, max)
+			if max > 0 && len(line) > max {
+				t.Fatalf("readLineLimit returned %d bytes with a limit of %d\n", len(line), max)
+			}
+			if err != nil {
+				return
+			}
+			consumed += len(line) + 2
+			if consumed > len(raw) {
+				t.Fatalf("readLineLimit returned more lines than the input holds\n")
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package tritonhttp
+
+import (
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// volatileHeaders matches the header lines whose values depend on the time
+// the test runs or the repository was checked out.
+var volatileHeaders = regexp.MustCompile(`(?mi)^(Date|Last-Modified|ETag): .*\r$`)
+
+func maskVolatileHeaders(raw string) string {
+	return volatileHeaders.ReplaceAllString(raw, "$1: <masked>\r")
+}
+
+// TestGoldenResponses sends every testdata/golden/*.request to the server
+// over a net.Pipe and compares the raw responses with the matching .golden
+// file. Run "go test -run TestGoldenResponses -update" to accept changes.
+func TestGoldenResponses(t *testing.T) {
+	requests, err := filepath.Glob(filepath.Join("testdata", "golden", "*.request"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, path := range requests {
+		name := strings.TrimSuffix(filepath.Base(path), ".request")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			client, server := net.Pipe()
+			go newTestServer().HandleConnection(server)
+			go func() {
+				_, _ = client.Write(raw)
+			}()
+			out, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("Error reading response: %v\n", err.Error())
+			}
+			client.Close()
+			got := maskVolatileHeaders(string(out))
+
+			golden := strings.TrimSuffix(path, ".request") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err.Error())
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Error reading golden file (run with -update to create it): %v\n", err.Error())
+			}
+			if got != string(want) {
+				t.Fatalf("Response does not match %v\ngot:\n%q\nwant:\n%q\n", golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	// http2Preface is the client connection preface of RFC 7540 section
+	// 3.5, sent by clients speaking HTTP/2 with prior knowledge.
+	http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	UPGRADE        = "upgrade"
+	HTTP2_SETTINGS = "http2-settings"
+)
+
+// hasHTTP2Preface reports whether the connection read by br starts with the
+// HTTP/2 connection preface, without consuming any input. It only blocks for
+// more input while what was received so far still matches the preface.
+func hasHTTP2Preface(br *bufio.Reader) bool {
+	for n := 1; n <= len(http2Preface); n++ {
+		b, err := br.Peek(n)
+		if err != nil || b[n-1] != http2Preface[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// isH2CUpgrade reports whether req asks to switch the connection to
+// cleartext HTTP/2 (RFC 7540 section 3.2). Requests with a body are
+// answered over HTTP/1.1, as stream 1 of the upgraded connection cannot
+// carry it; the client upgrades on a later request.
+func isH2CUpgrade(req *Request) bool {
+	if _, ok := req.Headers[HTTP2_SETTINGS]; !ok || req.ContentLength != 0 {
+		return false
+	}
+	return containsToken(parseTokenList(req.Headers[UPGRADE]), "h2c") &&
+		containsToken(req.ConnectionTokens, UPGRADE) &&
+		containsToken(req.ConnectionTokens, HTTP2_SETTINGS)
+}
+
+// decodeHTTP2Settings decodes the SETTINGS payload carried by the
+// HTTP2-Settings header of an h2c upgrade request.
+func decodeHTTP2Settings(req *Request) ([]byte, error) {
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Headers[HTTP2_SETTINGS], "="))
+	if err != nil {
+		return nil, err
+	}
+	// every setting is a 16 bit identifier followed by a 32 bit value
+	if len(settings)%6 != 0 {
+		return nil, errors.New("malformed HTTP2-Settings header")
+	}
+	return settings, nil
+}
+
+// negotiatedHTTP2 completes the TLS handshake of conn, if it is a TLS
+// connection, and reports whether the client picked "h2" through ALPN.
+func negotiatedHTTP2(conn net.Conn) (bool, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return false, nil
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return false, err
+	}
+	return tlsConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS, nil
+}
+
+// upgradeHTTP2 accepts the h2c upgrade request req and serves the rest of
+// conn over HTTP/2. The response to req is sent on stream 1.
+func (s *Server) upgradeHTTP2(conn net.Conn, br *bufio.Reader, req *Request, settings []byte) {
+	upgrade, err := req.httpRequest()
+	if err != nil {
+		log.Printf("Failed to upgrade connection to %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+	res := s.newResponse(statusSwitchingProtocols, responseOptions{req: req})
+	res.Headers["Connection"] = "Upgrade"
+	res.Headers["Upgrade"] = "h2c"
+	if err := s.writeResponse(conn, res); err != nil {
+		return
+	}
+	s.serveHTTP2(conn, req.ConnID, br, upgrade, settings)
+}
+
+// serveHTTP2 serves conn, whose Request.ConnID is connID, over HTTP/2 until
+// the client goes away. br, if not nil, holds whatever was already read
+// from conn. upgrade and settings are only set for a connection upgraded
+// from HTTP/1.1.
+func (s *Server) serveHTTP2(conn net.Conn, connID uint64, br *bufio.Reader, upgrade *http.Request, settings []byte) {
+	// HTTP/2 keeps track of idle connections by itself
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear timeout for connection %v", conn.RemoteAddr())
+		return
+	}
+	c := conn
+	if br != nil {
+		c = &bufferedConn{Conn: conn, br: br}
+	}
+	h2 := &http2.Server{IdleTimeout: s.idleTimeout()}
+	h2.ServeConn(c, &http2.ServeConnOpts{
+		Context:        context.WithValue(context.Background(), connIDKey{}, connID),
+		Handler:        http.HandlerFunc(s.serveHTTP),
+		UpgradeRequest: upgrade,
+		Settings:       settings,
+	})
+}
+
+// serveHTTP answers a request that arrived over a transport other than
+// HTTP/1.1, using the same request handling as HandleConnection.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req := requestFromHTTP(r)
+	if req.ContentLength < 0 && s.MaxBodyBytes > 0 {
+		req.Body = &limitedBody{r: req.Body, max: s.MaxBodyBytes}
+	}
+	var res *Response
+	if !validMethod(req.Method) {
+		res = s.newResponse(statusBadRequest, responseOptions{req: req, detail: badStringError("invalid method", req.Method).Error()})
+	} else if err := req.processHeader(); err != nil {
+		res = s.newResponse(statusBadRequest, responseOptions{req: req, detail: err.Error()})
+	} else {
+		if hints := s.earlyHints(req); hints != nil {
+			w.Header().Set("Link", hints.Headers["Link"])
+			w.WriteHeader(hints.StatusCode)
+			w.Header().Del("Link")
+		}
+		res = s.handleRequest(req)
+	}
+	res.Date = s.now()
+	s.addHSTS(res)
+
+	for k, v := range res.headerFields() {
+		// connection management is up to the transport
+		if strings.EqualFold(k, CONNECTION) {
+			continue
+		}
+		w.Header().Set(k, v)
+	}
+	for _, c := range res.Cookies {
+		w.Header().Add("Set-Cookie", c.String())
+	}
+	w.WriteHeader(res.StatusCode)
+	// only the body is accounted, the headers are compressed
+	cw := &countingWriter{w: w}
+	start := time.Now()
+	if err := res.writeBody(cw); err != nil {
+		log.Printf("Failed to write response to %v: %v", r.RemoteAddr, err)
+	}
+	s.accountTransfer(req, cw.n)
+	s.recordDownload(res, cw.n, time.Since(start))
+}
+
+// connIDKey is the context key of the Request.ConnID of the connection an
+// HTTP/2 or HTTP/3 request arrived on.
+type connIDKey struct{}
+
+// requestFromHTTP converts r into a Request, with the same lower-case
+// header keys ReadRequest produces.
+func requestFromHTTP(r *http.Request) *Request {
+	req := &Request{}
+	req.init()
+	req.Method = r.Method
+	req.URL = r.RequestURI
+	if req.URL == "" {
+		req.URL = r.URL.RequestURI()
+	}
+	req.Proto = r.Proto
+	for k, values := range r.Header {
+		for _, v := range values {
+			req.addHeader(strings.ToLower(k), v)
+		}
+	}
+	req.Headers[HOST] = r.Host
+	req.Body = r.Body
+	req.RemoteAddr = r.RemoteAddr
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		req.LocalAddr = addr.String()
+	}
+	req.ConnID, _ = r.Context().Value(connIDKey{}).(uint64)
+	req.TLS = r.TLS
+	// -1, a body of unknown length, is kept as for a chunked one
+	req.ContentLength = r.ContentLength
+	return req
+}
+
+// httpRequest converts req into the equivalent net/http request, leaving
+// out the hop-by-hop headers.
+func (req *Request) httpRequest() (*http.Request, error) {
+	u, err := url.ParseRequestURI(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header, len(req.Headers))
+	for k, v := range req.Headers {
+		header.Set(k, v)
+	}
+	for _, k := range hopByHopHeaders {
+		header.Del(k)
+	}
+	header.Del(HOST)
+	header.Del(HTTP2_SETTINGS)
+	return &http.Request{
+		Method:     req.Method,
+		URL:        u,
+		Proto:      responseProto,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       req.Host,
+		RequestURI: req.URL,
+	}, nil
+}
+
+// bufferedConn is a net.Conn whose reads go through br, so input buffered
+// while sniffing the protocol is not lost.
+type bufferedConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.br.Read(p)
+}
@@ -0,0 +1,336 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func startH2CServer(t *testing.T) net.Listener {
+	s := newTestServer()
+	s.H2C = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	ln := startH2CServer(t)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/index.html", 200},
+		{"/missing.html", 404},
+		{"/", 200},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "http://"+ln.Addr().String()+tt.url, nil)
+		if err != nil {
+			t.Fatalf("Error building request: %v\n", err.Error())
+		}
+		req.Host = "website1"
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Error getting %v: %v\n", tt.url, err.Error())
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Error reading body: %v\n", err.Error())
+		}
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("Expected HTTP/2 but got %v\n", resp.Proto)
+		}
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for %v but got: %v\n", tt.code, tt.url, resp.StatusCode)
+		}
+		if int64(len(body)) != resp.ContentLength {
+			t.Fatalf("Body of %d bytes does not match Content-Length %v\n", len(body), resp.ContentLength)
+		}
+	}
+}
+
+func TestH2CStreamedUpload(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true, H2C: true, MaxBodyBytes: 10}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	defer ln.Close()
+	go func() { _ = s.Serve(ln) }()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"streamed", "hello", 201},
+		{"too large", "0123456789abcdef", 413},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a reader of unknown length is sent without Content-Length
+			req, err := http.NewRequest("PUT", "http://"+ln.Addr().String()+"/"+tt.name+".txt", io.MultiReader(strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatalf("Error building request: %v\n", err.Error())
+			}
+			req.Host = "uploads"
+			req.ContentLength = -1
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Error uploading: %v\n", err.Error())
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			got, err := os.ReadFile(filepath.Join(docroot, tt.name+".txt"))
+			if tt.code == 201 && string(got) != tt.body {
+				t.Fatalf("Expected %q to be stored but got %q (%v)\n", tt.body, got, err)
+			}
+			if tt.code != 201 && err == nil {
+				t.Fatalf("Expected nothing to be stored but got %q\n", got)
+			}
+		})
+	}
+}
+
+func TestH2CEarlyHintsBeforeHandler(t *testing.T) {
+	s := newTestServer()
+	s.H2C = true
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"website1": {EarlyHints: []string{"</style.css>; rel=preload; as=style"}},
+	}
+	hinted := make(chan struct{})
+	s.HandleFunc("/slow", func(req *Request) *Response {
+		<-hinted
+		res := &Response{}
+		res.HandleOK()
+		res.SetBody("text/plain", "done")
+		return res
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	defer ln.Close()
+	go func() { _ = s.Serve(ln) }()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	var link string
+	trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+		if code == 103 {
+			link = header.Get("Link")
+			close(hinted)
+		}
+		return nil
+	}}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", "http://"+ln.Addr().String()+"/slow", nil)
+	if err != nil {
+		t.Fatalf("Error building request: %v\n", err.Error())
+	}
+	req.Host = "website1"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Error requesting: %v\n", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || link != "</style.css>; rel=preload; as=style" {
+		t.Fatalf("Expected a 200 after the hints but got %v with Link %q\n", resp.StatusCode, link)
+	}
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	ln := startH2CServer(t)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v\n", err.Error())
+	}
+	defer conn.Close()
+
+	var settings bytes.Buffer
+	if err := http2.NewFramer(&settings, nil).WriteSettings(); err != nil {
+		t.Fatalf("Error encoding settings: %v\n", err.Error())
+	}
+	// the header carries the SETTINGS payload, without the frame header
+	payload := base64.RawURLEncoding.EncodeToString(settings.Bytes()[9:])
+	_, _ = io.WriteString(conn, "GET /index.html HTTP/1.1\r\n"+
+		"Host: website1\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: "+payload+"\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading upgrade response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 101 || resp.Header.Get("Upgrade") != "h2c" {
+		t.Fatalf("Expected 101 upgrade to h2c but got %v %v\n", resp.StatusCode, resp.Header)
+	}
+
+	_, _ = io.WriteString(conn, http2Preface)
+	framer := http2.NewFramer(conn, br)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatalf("Error writing settings: %v\n", err.Error())
+	}
+	decoder := hpack.NewDecoder(4096, nil)
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("Error reading frame: %v\n", err.Error())
+		}
+		headers, ok := f.(*http2.HeadersFrame)
+		if !ok || headers.StreamID != 1 {
+			continue
+		}
+		fields, err := decoder.DecodeFull(headers.HeaderBlockFragment())
+		if err != nil {
+			t.Fatalf("Error decoding headers: %v\n", err.Error())
+		}
+		for _, f := range fields {
+			if f.Name == ":status" && f.Value != "200" {
+				t.Fatalf("Expected status 200 on stream 1 but got %v\n", f.Value)
+			}
+		}
+		return
+	}
+}
+
+func TestH2CUpgradeWithBody(t *testing.T) {
+	s := newTestServer()
+	s.H2C = true
+	s.HandleFunc("/echo", func(req *Request) *Response {
+		body, _ := io.ReadAll(req.Body)
+		res := &Response{}
+		res.HandleOK()
+		res.SetBody("text/plain", string(body))
+		return res
+	})
+	resp := parseResponse(t, serveRaw(t, s, "POST /echo HTTP/1.1\r\n"+
+		"Host: website1\r\n"+
+		"Connection: Upgrade, HTTP2-Settings, close\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: \r\n"+
+		"Content-Length: 5\r\n\r\nhello"))
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected the request to be answered over HTTP/1.1 but got: %v\n", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" {
+		t.Fatalf("Expected the body to be echoed but got: %q\n", body)
+	}
+}
+
+func TestH2CDisabled(t *testing.T) {
+	resp := parseResponse(t, serveRaw(t, newTestServer(), http2Preface))
+	if resp.StatusCode != 400 {
+		t.Fatalf("Expected response code of 400 but got: %v\n", resp.StatusCode)
+	}
+}
+
+// testCertificate returns a self-signed certificate for website1.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v\n", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"website1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v\n", err.Error())
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	ln = tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	go func() { _ = newTestServer().Serve(ln) }()
+	defer ln.Close()
+
+	tests := []struct {
+		nextProto string
+		proto     string
+	}{
+		{"h2", "HTTP/2.0"},
+		{"http/1.1", "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nextProto, func(t *testing.T) {
+			cfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{tt.nextProto}}
+			var transport http.RoundTripper = &http.Transport{TLSClientConfig: cfg}
+			if tt.nextProto == "h2" {
+				transport = &http2.Transport{TLSClientConfig: cfg}
+			}
+			req, err := http.NewRequest("GET", "https://"+ln.Addr().String()+"/index.html", nil)
+			if err != nil {
+				t.Fatalf("Error building request: %v\n", err.Error())
+			}
+			req.Host = "website1"
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("Error getting /index.html: %v\n", err.Error())
+			}
+			defer resp.Body.Close()
+			if resp.Proto != tt.proto || resp.StatusCode != 200 {
+				t.Fatalf("Expected %v 200 but got %v %v\n", tt.proto, resp.Proto, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package tritonhttp
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+const methodPost = "POST"
+
+// A HandlerFunc answers the requests for the paths it is registered for with
+// Server.HandleFunc, instead of the file serving. It returns the response to
+// send, prepared with one of the Response.Handle* methods; the server takes
+// care of the connection handling and of the body of error responses.
+type HandlerFunc func(req *Request) *Response
+
+// handlers maps registered patterns to their HandlerFunc.
+type handlers struct {
+	mu       sync.RWMutex
+	patterns map[string]HandlerFunc
+}
+
+// HandleFunc registers h for GET and POST requests to pattern. A pattern
+// ending in "/" matches every path below it, any other pattern matches
+// that exact path. The longest matching pattern wins.
+func (s *Server) HandleFunc(pattern string, h HandlerFunc) {
+	s.handlers.mu.Lock()
+	defer s.handlers.mu.Unlock()
+	if s.handlers.patterns == nil {
+		s.handlers.patterns = make(map[string]HandlerFunc)
+	}
+	s.handlers.patterns[pattern] = h
+}
+
+// handlerFor returns the HandlerFunc registered for the path of req, if any.
+func (s *Server) handlerFor(req *Request) HandlerFunc {
+	path := req.URL
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	s.handlers.mu.RLock()
+	defer s.handlers.mu.RUnlock()
+	var best string
+	var h HandlerFunc
+	for pattern, ph := range s.handlers.patterns {
+		match := pattern == path || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern))
+		if match && len(pattern) > len(best) {
+			best, h = pattern, ph
+		}
+	}
+	return h
+}
+
+// runHandler calls h for req and completes the response it returns.
+func (s *Server) runHandler(h HandlerFunc, req *Request) *Response {
+	res := h(req)
+	if res == nil {
+		log.Printf("Handler for %v returned no response", req.URL)
+		return s.newResponse(statusInternalServerError, responseOptions{req: req, detail: "the handler failed"})
+	}
+	if res.Headers == nil {
+		res.Headers = make(map[string]string)
+	}
+	if res.Proto == "" {
+		res.Proto = responseProto
+	}
+	res.Request = req
+	if req.Close {
+		res.Headers["Connection"] = "close"
+	}
+	if res.Body == "" && res.FilePath == "" {
+		s.handleErrorBody(res, req, "")
+	}
+	return res
+}
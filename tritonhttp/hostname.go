@@ -0,0 +1,128 @@
+package tritonhttp
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// splitHost splits a "Host" header value into the host name and the port,
+// which is empty if there is none. IPv6 literals are bracketed in Host
+// values, e.g. "[2001:db8::1]:8080"; the brackets are removed from name.
+// An unbracketed IPv6 address, as written in configs, is taken whole. ok
+// is false for malformed values, e.g. unbalanced brackets or a port that
+// is not a number.
+func splitHost(host string) (name, port string, ok bool) {
+	if strings.HasPrefix(host, "[") {
+		end := strings.IndexByte(host, ']')
+		if end < 0 {
+			return "", "", false
+		}
+		name, rest := host[1:end], host[end+1:]
+		if net.ParseIP(name) == nil || !strings.Contains(name, ":") {
+			return "", "", false
+		}
+		if rest == "" {
+			return name, "", true
+		}
+		if rest[0] != ':' || !isPort(rest[1:]) {
+			return "", "", false
+		}
+		return name, rest[1:], true
+	}
+	switch strings.Count(host, ":") {
+	case 0:
+		return host, "", true
+	case 1:
+		i := strings.IndexByte(host, ':')
+		if !isPort(host[i+1:]) {
+			return "", "", false
+		}
+		return host[:i], host[i+1:], true
+	}
+	if net.ParseIP(host) == nil {
+		return "", "", false
+	}
+	return host, "", true
+}
+
+// isPort reports whether s is a decimal port number, or empty, which
+// RFC 3986 allows and means the default port.
+func isPort(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) <= 5
+}
+
+// normalizeHost returns the form host names are looked up in: lower case,
+// with internationalized labels NFC-normalized and converted to punycode,
+// so that "Bücher.example", its decomposed spelling and
+// "xn--bcher-kva.example" all name the same virtual host. IPv6 literals
+// are bracketed and written in their canonical form. A ":port" suffix is
+// kept. Malformed values are only lowercased.
+func normalizeHost(host string) string {
+	name, port, ok := splitHost(host)
+	if !ok {
+		return strings.ToLower(host)
+	}
+	if ip := net.ParseIP(name); ip != nil && strings.Contains(name, ":") {
+		name = "[" + ip.String() + "]"
+	} else {
+		name = strings.ToLower(name)
+		if ascii, err := idna.Lookup.ToASCII(norm.NFC.String(name)); err == nil {
+			name = ascii
+		}
+	}
+	if port != "" {
+		return name + ":" + port
+	}
+	return name
+}
+
+// normalizeHostKeys returns a copy of m whose keys are normalized with
+// normalizeHost.
+func normalizeHostKeys[V any](m map[string]V) map[string]V {
+	normalized := make(map[string]V, len(m))
+	for host, v := range m {
+		normalized[normalizeHost(host)] = v
+	}
+	return normalized
+}
+
+// lookupHost finds the virtual host of host, a normalized "Host" value, in
+// m, whose keys are normalized host names: a key with the port matches
+// first, then one without it. key is the key that matched.
+func lookupHost[V any](m map[string]V, host string) (key string, v V, ok bool) {
+	if v, ok := m[host]; ok {
+		return host, v, true
+	}
+	if name, port, split := splitHost(host); split && port != "" {
+		if strings.Contains(name, ":") {
+			name = "[" + name + "]"
+		}
+		if v, ok := m[name]; ok {
+			return name, v, true
+		}
+	}
+	return "", v, false
+}
+
+// useDefaultHost sends req, whose Host matches no virtual host, to
+// DefaultHost, if set.
+func (s *Server) useDefaultHost(req *Request) {
+	if s.DefaultHost == "" {
+		return
+	}
+	if _, _, ok := lookupHost(s.virtualHosts(), req.Host); ok {
+		return
+	}
+	if _, _, ok := lookupHost(s.hostSettings(), req.Host); ok {
+		return
+	}
+	req.Host = normalizeHost(s.DefaultHost)
+}
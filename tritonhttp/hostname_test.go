@@ -0,0 +1,99 @@
+package tritonhttp
+
+import "testing"
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"website1", "website1"},
+		{"WebSite1:8080", "website1:8080"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"BÜCHER.example", "xn--bcher-kva.example"},
+		{"bu\u0308cher.example", "xn--bcher-kva.example"},
+		{"bücher.example:8080", "xn--bcher-kva.example:8080"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"[::1]:8080", "[::1]:8080"},
+		{"[2001:DB8:0::1]:8080", "[2001:db8::1]:8080"},
+		{"[2001:db8::1]", "[2001:db8::1]"},
+		{"2001:db8::1", "[2001:db8::1]"},
+		{"website1:", "website1"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHost(tt.host); got != tt.want {
+			t.Fatalf("Expected %q to normalize to %q but got: %q\n", tt.host, tt.want, got)
+		}
+	}
+}
+
+func TestServeInternationalizedHost(t *testing.T) {
+	s := newTestServer()
+	s.VirtualHosts["bücher.example"] = "../docroot_dirs/htdocs1"
+	for _, host := range []string{"bücher.example", "xn--bcher-kva.example", "bücher.example"} {
+		resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: "+host+"\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected response code of 200 for host %q but got: %v\n", host, resp.StatusCode)
+		}
+	}
+}
+
+func TestSplitHost(t *testing.T) {
+	tests := []struct {
+		host string
+		name string
+		port string
+		ok   bool
+	}{
+		{"website1", "website1", "", true},
+		{"website1:8080", "website1", "8080", true},
+		{"[2001:db8::1]:8080", "2001:db8::1", "8080", true},
+		{"[2001:db8::1]", "2001:db8::1", "", true},
+		{"2001:db8::1", "2001:db8::1", "", true},
+		{"[2001:db8::1", "", "", false},
+		{"[2001:db8::1]8080", "", "", false},
+		{"[website1]:8080", "", "", false},
+		{"website1:http", "", "", false},
+		{"a:b:c", "", "", false},
+	}
+	for _, tt := range tests {
+		name, port, ok := splitHost(tt.host)
+		if name != tt.name || port != tt.port || ok != tt.ok {
+			t.Fatalf("Expected %q to split into %q, %q, %v but got: %q, %q, %v\n", tt.host, tt.name, tt.port, tt.ok, name, port, ok)
+		}
+	}
+}
+
+func TestServeHostWithPort(t *testing.T) {
+	s := newTestServer()
+	s.VirtualHosts["2001:db8::1"] = "../docroot_dirs/htdocs1"
+	s.VirtualHosts["website2:8080"] = "../docroot_dirs/htdocs2"
+	tests := []struct {
+		host string
+		code int
+	}{
+		{"website1:8080", 200},
+		{"[2001:db8::1]:8080", 200},
+		{"[2001:0db8::1]", 200},
+		{"website2:8080", 200},
+		{"website2:8081", 404},
+		{"[2001:db8::1", 400},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: "+tt.host+"\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for host %q but got: %v\n", tt.code, tt.host, resp.StatusCode)
+		}
+	}
+}
+
+func TestDefaultHost(t *testing.T) {
+	for _, defaultHost := range []string{"", "Website1"} {
+		s := newTestServer()
+		s.DefaultHost = defaultHost
+		resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: 192.0.2.1:8080\r\nConnection: close\r\n\r\n"))
+		if want := map[string]int{"": 404, "Website1": 200}[defaultHost]; resp.StatusCode != want {
+			t.Fatalf("Expected response code of %v with default host %q but got: %v\n", want, defaultHost, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package tritonhttp
+
+import (
+	"strconv"
+	"time"
+)
+
+// HSTSPolicy is the HTTP Strict Transport Security policy of a virtual
+// host (RFC 6797): browsers that got it over HTTPS only use HTTPS for the
+// host until MaxAge has passed.
+type HSTSPolicy struct {
+	// MaxAge is how long browsers remember the policy, in whole seconds.
+	// Zero sends no policy; a negative value sends "max-age=0", which
+	// makes browsers forget it.
+	MaxAge time.Duration
+	// IncludeSubDomains extends the policy to every subdomain of the host.
+	IncludeSubDomains bool
+	// Preload asks for the host to be built into browsers' preload lists,
+	// which expect a MaxAge of at least a year and IncludeSubDomains.
+	Preload bool
+}
+
+// header returns the "Strict-Transport-Security" value of p, or "" if p
+// sends no policy.
+func (p HSTSPolicy) header() string {
+	if p.MaxAge == 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(int64(max(p.MaxAge, 0)/time.Second), 10)
+	if p.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if p.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// addHSTS adds the HSTS policy of the host of res, if it has one, to res,
+// a final response to a request that arrived over TLS. Browsers ignore the
+// header on plain HTTP, so it is not sent there. A policy set by a handler
+// or an upstream is kept.
+func (s *Server) addHSTS(res *Response) {
+	req := res.Request
+	if res.StatusCode < statusOK || req == nil || req.TLS == nil {
+		return
+	}
+	if _, ok := res.Headers["Strict-Transport-Security"]; ok {
+		return
+	}
+	_, settings, _ := lookupHost(s.hostSettings(), req.Host)
+	if value := settings.HSTS.header(); value != "" {
+		res.Headers["Strict-Transport-Security"] = value
+	}
+}
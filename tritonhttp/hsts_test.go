@@ -0,0 +1,89 @@
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHSTSPolicyHeader(t *testing.T) {
+	tests := []struct {
+		policy HSTSPolicy
+		header string
+	}{
+		{HSTSPolicy{}, ""},
+		{HSTSPolicy{MaxAge: 24 * time.Hour}, "max-age=86400"},
+		{HSTSPolicy{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload"},
+		{HSTSPolicy{MaxAge: -1, IncludeSubDomains: true}, "max-age=0; includeSubDomains"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.header(); got != tt.header {
+			t.Fatalf("Expected %q for %+v but got %q\n", tt.header, tt.policy, got)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	defer ln.Close()
+	s := newTestServer()
+	s.VirtualHosts["website2"] = "../docroot_dirs/htdocs1"
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"website1": {HSTS: HSTSPolicy{MaxAge: time.Hour, IncludeSubDomains: true}},
+	}
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}
+	go func() { _ = s.ServeTLS(ln, "", "") }()
+
+	tests := []struct {
+		name  string
+		proto string
+		host  string
+		url   string
+		code  int
+		hsts  string
+	}{
+		{"HTTP/2", "HTTP/2.0", "website1", "/index.html", 200, "max-age=3600; includeSubDomains"},
+		{"HTTP/1.1", "HTTP/1.1", "website1", "/index.html", 200, "max-age=3600; includeSubDomains"},
+		{"error response", "HTTP/2.0", "website1", "/missing.html", 404, "max-age=3600; includeSubDomains"},
+		{"host without policy", "HTTP/2.0", "website2", "/index.html", 200, ""},
+		{"plain HTTP", "", "website1", "/index.html", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			switch tt.proto {
+			case "":
+				resp = parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: "+tt.host+"\r\nConnection: close\r\n\r\n"))
+			default:
+				transport := &http.Transport{
+					TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+					ForceAttemptHTTP2: tt.proto == "HTTP/2.0",
+				}
+				defer transport.CloseIdleConnections()
+				req, err := http.NewRequest("GET", "https://"+ln.Addr().String()+tt.url, nil)
+				if err != nil {
+					t.Fatalf("Error building request: %v\n", err.Error())
+				}
+				req.Host = tt.host
+				if resp, err = transport.RoundTrip(req); err != nil {
+					t.Fatalf("Error getting %v: %v\n", tt.url, err.Error())
+				}
+				if resp.Proto != tt.proto {
+					t.Fatalf("Expected %v but got %v\n", tt.proto, resp.Proto)
+				}
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Strict-Transport-Security"); got != tt.hsts {
+				t.Fatalf("Expected Strict-Transport-Security %q but got %q\n", tt.hsts, got)
+			}
+		})
+	}
+}
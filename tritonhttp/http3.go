@@ -0,0 +1,131 @@
+//go:build http3
+
+package tritonhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP/3 is only compiled in with the "http3" build tag, which pulls in
+// quic-go:
+//
+//	go build -tags http3 ./...
+
+// http3State holds the HTTP/3 server started by ServeHTTP3, if any.
+type http3State struct {
+	server atomic.Pointer[http3.Server]
+}
+
+// http3Server returns the running HTTP/3 server, or nil.
+func (s *Server) http3Server() *http3.Server {
+	return s.h3.server.Load()
+}
+
+// ListenAndServeHTTP3 listens on the UDP address addr and serves HTTP/3 on
+// it, see ServeHTTP3. Set HTTP3 instead to serve it next to
+// ListenAndServeTLS with the same certificates.
+func (s *Server) ListenAndServeHTTP3(addr string, tlsConfig *tls.Config) error {
+	s.init()
+	if err := s.ValidateServerSetup(); err != nil {
+		return err
+	}
+	conn, err := net.ListenPacket(s.udpNetwork(), addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.ServeHTTP3(conn, tlsConfig)
+}
+
+// ServeHTTP3 serves HTTP/3 (QUIC) on conn until conn is closed. Requests go
+// through the same virtual hosts and file serving as on the TCP listener,
+// which advertises the HTTP/3 endpoint with an Alt-Svc header for as long as
+// ServeHTTP3 runs. Support for HTTP/3 is experimental.
+func (s *Server) ServeHTTP3(conn net.PacketConn, tlsConfig *tls.Config) error {
+	h3 := &http3.Server{
+		TLSConfig:   tlsConfig,
+		Handler:     http.HandlerFunc(s.serveHTTP),
+		IdleTimeout: s.idleTimeout(),
+		ConnContext: func(ctx context.Context, _ quic.Connection) context.Context {
+			return context.WithValue(ctx, connIDKey{}, s.connIDs.Add(1))
+		},
+	}
+	if !s.h3.server.CompareAndSwap(nil, h3) {
+		return errors.New("tritonhttp: HTTP/3 is already being served")
+	}
+	defer s.h3.server.CompareAndSwap(h3, nil)
+	return h3.Serve(conn)
+}
+
+// listenHTTP3 serves HTTP/3 with config on the UDP port of Addr, for
+// ListenAndServeTLS with HTTP3 set, until the returned socket is closed.
+func (s *Server) listenHTTP3(config *tls.Config) (io.Closer, error) {
+	conn, err := net.ListenPacket(s.udpNetwork(), s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		err := s.ServeHTTP3(conn, config)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to serve HTTP/3: %v", err)
+		}
+	}()
+	return conn, nil
+}
+
+// closeHTTP3 stops the HTTP/3 server, if any, aborting its requests.
+func (s *Server) closeHTTP3() {
+	if h3 := s.http3Server(); h3 != nil {
+		_ = h3.Close()
+	}
+}
+
+// shutdownHTTP3 starts a graceful shutdown of the HTTP/3 server, if any,
+// in which requests get grace to finish. The returned function waits for
+// it to complete.
+func (s *Server) shutdownHTTP3(grace time.Duration) (wait func()) {
+	h3 := s.http3Server()
+	if h3 == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		_ = h3.Shutdown(ctx)
+	}()
+	return func() { <-done }
+}
+
+// udpNetwork is the UDP counterpart of the TCP network the server listens
+// on, for HTTP/3.
+func (s *Server) udpNetwork() string {
+	return "udp" + strings.TrimPrefix(s.network(), "tcp")
+}
+
+// altSvc returns the Alt-Svc header value advertising the running HTTP/3
+// listener, or "" when there is none.
+func (s *Server) altSvc() string {
+	h3 := s.http3Server()
+	if h3 == nil {
+		return ""
+	}
+	header := make(http.Header)
+	if err := h3.SetQUICHeaders(header); err != nil {
+		return ""
+	}
+	return header.Get("Alt-Svc")
+}
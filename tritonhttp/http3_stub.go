@@ -0,0 +1,44 @@
+//go:build !http3
+
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// errHTTP3NotBuilt is returned when HTTP/3 is asked for in a build without
+// the "http3" tag.
+var errHTTP3NotBuilt = errors.New("tritonhttp: HTTP/3 support needs the http3 build tag")
+
+// http3State is empty, as no HTTP/3 server can run.
+type http3State struct{}
+
+// ListenAndServeHTTP3 serves HTTP/3 with the "http3" build tag only, and
+// otherwise fails.
+func (s *Server) ListenAndServeHTTP3(addr string, tlsConfig *tls.Config) error {
+	return errHTTP3NotBuilt
+}
+
+// ServeHTTP3 serves HTTP/3 with the "http3" build tag only, and otherwise
+// fails.
+func (s *Server) ServeHTTP3(conn net.PacketConn, tlsConfig *tls.Config) error {
+	return errHTTP3NotBuilt
+}
+
+func (s *Server) listenHTTP3(config *tls.Config) (io.Closer, error) {
+	return nil, errHTTP3NotBuilt
+}
+
+func (s *Server) closeHTTP3() {}
+
+func (s *Server) shutdownHTTP3(grace time.Duration) (wait func()) {
+	return func() {}
+}
+
+func (s *Server) altSvc() string {
+	return ""
+}
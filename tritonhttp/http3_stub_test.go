@@ -0,0 +1,21 @@
+//go:build !http3
+
+package tritonhttp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHTTP3NotBuilt(t *testing.T) {
+	certFile, keyFile := writeCertFiles(t, testCertificate(t))
+	s := newTestServer()
+	s.Addr = freeAddr(t)
+	s.HTTP3 = true
+	if err := s.ListenAndServeTLS(certFile, keyFile); !errors.Is(err, errHTTP3NotBuilt) {
+		t.Fatalf("Expected %v without the http3 tag but got: %v\n", errHTTP3NotBuilt, err)
+	}
+	if err := s.ServeHTTP3(nil, nil); !errors.Is(err, errHTTP3NotBuilt) {
+		t.Fatalf("Expected %v without the http3 tag but got: %v\n", errHTTP3NotBuilt, err)
+	}
+}
@@ -0,0 +1,115 @@
+//go:build http3
+
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3(t *testing.T) {
+	s := newTestServer()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ServeHTTP3(conn, &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	}()
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	req, err := http.NewRequest("GET", "https://"+conn.LocalAddr().String()+"/index.html", nil)
+	if err != nil {
+		t.Fatalf("Error building request: %v\n", err.Error())
+	}
+	req.Host = "website1"
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Error getting /index.html: %v\n", err.Error())
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Error reading body: %v\n", err.Error())
+	}
+	if resp.ProtoMajor != 3 || resp.StatusCode != 200 || int64(len(body)) != resp.ContentLength {
+		t.Fatalf("Unexpected response %v %v with %d bytes\n", resp.Proto, resp.StatusCode, len(body))
+	}
+
+	// the TCP listener advertises the HTTP/3 endpoint while it is running
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	tcp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if altSvc := tcp.Header.Get("Alt-Svc"); !strings.Contains(altSvc, `h3=":`+port+`"`) {
+		t.Fatalf("Expected Alt-Svc advertising port %v but got %q\n", port, altSvc)
+	}
+
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeHTTP3 did not return after its connection was closed")
+	}
+	tcp = parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if altSvc := tcp.Header.Get("Alt-Svc"); altSvc != "" {
+		t.Fatalf("Expected no Alt-Svc once HTTP/3 stopped but got %q\n", altSvc)
+	}
+}
+
+func TestListenAndServeTLSHTTP3(t *testing.T) {
+	certFile, keyFile := writeCertFiles(t, testCertificate(t))
+	s := newTestServer()
+	s.Addr = freeAddr(t)
+	s.HTTP3 = true
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServeTLS(certFile, keyFile) }()
+
+	// the TCP listener advertises the HTTP/3 endpoint on the same port
+	_, port, _ := net.SplitHostPort(s.Addr)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, _ := getTLS(t, s.Addr)
+		if strings.Contains(resp.Header.Get("Alt-Svc"), `h3=":`+port+`"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected Alt-Svc advertising port %v but got %q\n", port, resp.Header.Get("Alt-Svc"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	req, err := http.NewRequest("GET", "https://"+s.Addr+"/index.html", nil)
+	if err != nil {
+		t.Fatalf("Error building request: %v\n", err.Error())
+	}
+	req.Host = "website1"
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Error getting /index.html: %v\n", err.Error())
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 3 || resp.StatusCode != 200 {
+		t.Fatalf("Expected HTTP/3 200 but got %v %v\n", resp.Proto, resp.StatusCode)
+	}
+
+	// Close stops HTTP/3 along with the TCP listeners
+	s.Close()
+	<-served
+	deadline = time.Now().Add(5 * time.Second)
+	for s.http3Server() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("HTTP/3 kept running after Close\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,56 @@
+package tritonhttp
+
+import (
+	"net"
+	"strings"
+)
+
+// httpsRedirectListener is a plain HTTP listener of ListenAndRedirectHTTPS.
+type httpsRedirectListener struct {
+	net.Listener
+	// httpsPort is the port of the HTTPS URLs redirected to, "" for 443
+	httpsPort string
+}
+
+// ListenAndRedirectHTTPS listens on the plain HTTP address addr, e.g.
+// ":80", and answers every GET and HEAD request for a virtual host with a
+// 301 redirect to the same URL over HTTPS, on httpsPort, so a server
+// running ListenAndServeTLS needs no second server to move its clients
+// over. An empty httpsPort, or "443", leaves the port out of the URLs.
+// Other methods get 405, as redirecting them would repeat the request in
+// the clear. The HTTP-01 challenges of ACME are still answered. It returns
+// once the listener is closed by Close or Shutdown.
+func (s *Server) ListenAndRedirectHTTPS(addr, httpsPort string) error {
+	ln, err := net.Listen(s.network(), addr)
+	if err != nil {
+		return err
+	}
+	if httpsPort == "443" {
+		httpsPort = ""
+	}
+	return s.Serve(&httpsRedirectListener{Listener: ln, httpsPort: httpsPort})
+}
+
+// redirectHTTPS answers req, which arrived on ln, with the redirect of
+// ListenAndRedirectHTTPS.
+func (s *Server) redirectHTTPS(req *Request, ln *httpsRedirectListener) *Response {
+	if req.Method != methodGet && req.Method != methodHead {
+		res := s.newResponse(statusMethodNotAllowed, responseOptions{req: req, detail: req.Method + " is only served over HTTPS"})
+		res.Headers["Allow"] = "GET, HEAD"
+		return res
+	}
+	s.useDefaultHost(req)
+	_, _, vhost := lookupHost(s.virtualHosts(), req.Host)
+	_, _, settings := lookupHost(s.hostSettings(), req.Host)
+	if !vhost && !settings {
+		return s.newResponse(statusNotFound, responseOptions{req: req, detail: "no virtual host " + req.Host})
+	}
+	host, _, _ := splitHost(req.Host)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if ln.httpsPort != "" {
+		host += ":" + ln.httpsPort
+	}
+	return s.runHandler(RedirectHandler(statusMovedPermanently, "https://"+host+req.URL), req)
+}
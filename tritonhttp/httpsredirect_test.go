@@ -0,0 +1,93 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialRaw sends raw to addr, retrying while the server starts, and returns
+// a reader of the responses.
+func dialRaw(t *testing.T, addr, raw string) *bufio.Reader {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Error dialing %v: %v\n", addr, err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+	_, _ = io.WriteString(conn, raw)
+	return bufio.NewReader(conn)
+}
+
+func TestListenAndRedirectHTTPS(t *testing.T) {
+	s := newTestServer()
+	addr, defaultPortAddr := freeAddr(t), freeAddr(t)
+	served := make(chan error, 2)
+	go func() { served <- s.ListenAndRedirectHTTPS(addr, "8443") }()
+	go func() { served <- s.ListenAndRedirectHTTPS(defaultPortAddr, "443") }()
+	defer func() {
+		s.Close()
+		<-served
+		<-served
+	}()
+
+	tests := []struct {
+		name     string
+		addr     string
+		request  string
+		code     int
+		location string
+	}{
+		{"get", addr, "GET /index.html?lang=en HTTP/1.1\r\nHost: website1\r\n", 301, "https://website1:8443/index.html?lang=en"},
+		{"head", addr, "HEAD /subdir/ HTTP/1.1\r\nHost: website1\r\n", 301, "https://website1:8443/subdir/"},
+		{"host with port", addr, "GET / HTTP/1.1\r\nHost: WEBSITE1:80\r\n", 301, "https://website1:8443/"},
+		{"default port", defaultPortAddr, "GET /index.html HTTP/1.1\r\nHost: website1\r\n", 301, "https://website1/index.html"},
+		{"post", addr, "POST /form HTTP/1.1\r\nHost: website1\r\nContent-Length: 0\r\n", 405, ""},
+		{"unknown host", addr, "GET / HTTP/1.1\r\nHost: example.com\r\n", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a second request on the connection checks the framing of
+			// the first response
+			next := "GET /next HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"
+			br := dialRaw(t, tt.addr, tt.request+"\r\n"+next)
+			method, _, _ := strings.Cut(tt.request, " ")
+			resp, err := http.ReadResponse(br, &http.Request{Method: method})
+			if err != nil {
+				t.Fatalf("Error reading response: %v\n", err.Error())
+			}
+			if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Location"); got != tt.location {
+				t.Fatalf("Expected Location %q but got %q\n", tt.location, got)
+			}
+			if tt.code == 405 && resp.Header.Get("Allow") != "GET, HEAD" {
+				t.Fatalf("Expected Allow: GET, HEAD but got %q\n", resp.Header.Get("Allow"))
+			}
+
+			resp, err = http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("Error reading the second response: %v\n", err.Error())
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Location"); resp.StatusCode != 301 || !strings.HasSuffix(got, "/next") {
+				t.Fatalf("Expected a redirect to /next but got %v %q\n", resp.StatusCode, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package tritonhttp
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultImmutableAssets matches the file names that common bundlers give
+// fingerprinted assets, e.g. "main.3f9a1c2b.js" or "logo-3f9a1c2b.png":
+// a hash of at least 8 hex digits before the extension.
+var DefaultImmutableAssets = regexp.MustCompile(`^.+[.-][0-9a-f]{8,}\.(js|mjs|css|map|json|wasm|woff2?|ttf|png|jpe?g|gif|svg|webp|avif|ico)$`)
+
+// immutableCacheControl lets caches keep a response for a year without
+// ever revalidating it.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// markImmutable sets the Cache-Control header of res, a response for a
+// file, to immutableCacheControl if the name of the file matches
+// ImmutableAssets. Fingerprinted names change whenever the content does,
+// so a cached copy never goes stale.
+func (s *Server) markImmutable(res *Response) {
+	if s.ImmutableAssets == nil || res.FilePath == "" {
+		return
+	}
+	if s.ImmutableAssets.MatchString(filepath.Base(res.FilePath)) {
+		res.Headers["Cache-Control"] = immutableCacheControl
+		// left by a CachePolicy, which this overrides
+		delete(res.Headers, "Expires")
+	}
+}
@@ -0,0 +1,35 @@
+package tritonhttp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImmutableAssets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.3f9a1c2b.js", "logo-0123456789abcdef.png", "main.js", "notes.3f9a1c2b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("asset"), 0o644); err != nil {
+			t.Fatalf("Error writing %v: %v\n", name, err.Error())
+		}
+	}
+	s := &Server{DocRoot: dir, VirtualHosts: map[string]string{"website1": dir}, ImmutableAssets: DefaultImmutableAssets}
+	tests := []struct {
+		url       string
+		immutable bool
+	}{
+		{"/main.3f9a1c2b.js", true},
+		{"/logo-0123456789abcdef.png", true},
+		{"/main.js", false},
+		{"/notes.3f9a1c2b.txt", false},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected response code of 200 for %v but got: %v\n", tt.url, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Cache-Control") == immutableCacheControl; got != tt.immutable {
+			t.Fatalf("Expected %v to be immutable: %v, but got Cache-Control %q\n", tt.url, tt.immutable, resp.Header.Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package tritonhttp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// The values of Server.Network.
+const (
+	NetworkDualStack = "tcp"
+	NetworkIPv4      = "tcp4"
+	NetworkIPv6      = "tcp6"
+)
+
+func (s *Server) network() string {
+	if s.Network == "" {
+		return NetworkDualStack
+	}
+	return s.Network
+}
+
+// validateListen checks the listening configuration of the server.
+func (s *Server) validateListen() error {
+	switch s.network() {
+	case NetworkDualStack, NetworkIPv4, NetworkIPv6:
+	default:
+		return fmt.Errorf("unknown network %q, should be %q, %q or %q", s.Network, NetworkDualStack, NetworkIPv4, NetworkIPv6)
+	}
+	if s.Interface == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	if host != "" {
+		return fmt.Errorf("address %q names a host, which conflicts with interface %q", s.Addr, s.Interface)
+	}
+	return nil
+}
+
+// listen opens the listeners ListenAndServe serves: one on Addr, or, with
+// an Interface, one on each address of the interface in Network.
+func (s *Server) listen() ([]net.Listener, error) {
+	if s.Interface == "" {
+		ln, err := net.Listen(s.network(), s.Addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{s.tlsListener(ln)}, nil
+	}
+	addrs, err := s.interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var lns []net.Listener
+	for _, addr := range addrs {
+		network := NetworkIPv6
+		if addr.IP.To4() != nil {
+			network = NetworkIPv4
+		}
+		ln, err := net.ListenTCP(network, addr)
+		if err != nil {
+			closeListeners(lns)
+			return nil, err
+		}
+		lns = append(lns, s.tlsListener(ln))
+	}
+	return lns, nil
+}
+
+// interfaceAddrs returns the addresses of Interface in Network, with the
+// port of Addr. IPv6 link-local addresses are scoped to the interface.
+func (s *Server) interfaceAddrs() ([]*net.TCPAddr, error) {
+	ifi, err := net.InterfaceByName(s.Interface)
+	if err != nil {
+		return nil, err
+	}
+	ifAddrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	portNum, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return nil, err
+	}
+	network := s.network()
+	var addrs []*net.TCPAddr
+	for _, a := range ifAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP
+		if (ip.To4() != nil && network == NetworkIPv6) || (ip.To4() == nil && network == NetworkIPv4) {
+			continue
+		}
+		addr := &net.TCPAddr{IP: ip, Port: portNum}
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			addr.Zone = ifi.Name
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("interface %q has no %v address", s.Interface, network)
+	}
+	return addrs, nil
+}
+
+func closeListeners(lns []net.Listener) {
+	for _, ln := range lns {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Println("error in closing listener", err)
+		}
+	}
+}
+
+// listenerSet is the set of listeners a server is serving.
+type listenerSet struct {
+	mu  sync.Mutex
+	lns map[net.Listener]struct{}
+	// bound holds the listeners opened by ListenAndServe and
+	// SetListenAddrs, by the address they were opened for
+	bound  map[string][]net.Listener
+	closed bool
+	// done is closed by Close
+	done chan struct{}
+	// reconfigure serializes SetListenAddrs calls
+	reconfigure sync.Mutex
+}
+
+// track adds ln to the set until the returned function is called.
+func (ls *listenerSet) track(ln net.Listener) (untrack func()) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.lns == nil {
+		ls.lns = make(map[net.Listener]struct{})
+	}
+	ls.lns[ln] = struct{}{}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		delete(ls.lns, ln)
+	}
+}
+
+// closedChan returns a channel closed by Close.
+func (ls *listenerSet) closedChan() <-chan struct{} {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.done == nil {
+		ls.done = make(chan struct{})
+	}
+	return ls.done
+}
+
+// addrs returns the addresses of the bound listeners.
+func (ls *listenerSet) addrs() map[string]bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	addrs := make(map[string]bool, len(ls.bound))
+	for addr := range ls.bound {
+		addrs[addr] = true
+	}
+	return addrs
+}
+
+// unbind removes the listeners bound to the addresses not in keep, and
+// returns them.
+func (ls *listenerSet) unbind(keep map[string]bool) []net.Listener {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var removed []net.Listener
+	for addr, lns := range ls.bound {
+		if !keep[addr] {
+			removed = append(removed, lns...)
+			delete(ls.bound, addr)
+		}
+	}
+	return removed
+}
+
+// serveBound records the listeners of bound, by address, and serves each
+// of them in its own goroutine. It closes them instead if the server was
+// closed.
+func (s *Server) serveBound(bound map[string][]net.Listener) error {
+	ls := &s.listeners
+	ls.mu.Lock()
+	if ls.closed {
+		ls.mu.Unlock()
+		for _, lns := range bound {
+			closeListeners(lns)
+		}
+		return net.ErrClosed
+	}
+	if ls.bound == nil {
+		ls.bound = make(map[string][]net.Listener)
+	}
+	for addr, lns := range bound {
+		ls.bound[addr] = append(ls.bound[addr], lns...)
+	}
+	ls.mu.Unlock()
+	for _, lns := range bound {
+		for _, ln := range lns {
+			fmt.Println("Listening on", ln.Addr())
+			go s.Serve(ln)
+		}
+	}
+	return nil
+}
+
+// listenAddrs opens a listener in Network on each of addrs that is not
+// bound yet. If any fails, the ones opened are closed again.
+func (s *Server) listenAddrs(addrs []string, bound map[string]bool) (map[string][]net.Listener, error) {
+	opened := make(map[string][]net.Listener)
+	for _, addr := range addrs {
+		if bound[addr] || opened[addr] != nil {
+			continue
+		}
+		ln, err := net.Listen(s.network(), addr)
+		if err != nil {
+			for _, lns := range opened {
+				closeListeners(lns)
+			}
+			return nil, err
+		}
+		opened[addr] = []net.Listener{s.tlsListener(ln)}
+	}
+	return opened, nil
+}
+
+// SetListenAddrs changes the addresses the server listens on at runtime,
+// e.g. after a configuration reload: addrs replaces Addr and ListenAddrs.
+// The listeners for new addresses are opened and served first; if any of
+// them cannot be opened, nothing changes and the error is returned. The
+// listeners for addresses no longer listed are then closed and their
+// connections drained as by Shutdown, within grace. Connections on the
+// other listeners are left alone. It returns once the drained connections
+// are closed.
+func (s *Server) SetListenAddrs(addrs []string, grace time.Duration) error {
+	ls := &s.listeners
+	ls.reconfigure.Lock()
+	defer ls.reconfigure.Unlock()
+
+	opened, err := s.listenAddrs(addrs, ls.addrs())
+	if err != nil {
+		return err
+	}
+	if err := s.serveBound(opened); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	removed := ls.unbind(keep)
+	if len(removed) == 0 {
+		return nil
+	}
+	closeListeners(removed)
+	isRemoved := make(map[net.Listener]bool, len(removed))
+	for _, ln := range removed {
+		isRemoved[ln] = true
+	}
+	summary := s.conns.drain(func(c *trackedConn) bool { return isRemoved[c.ln] }, grace)
+	log.Printf("Closed %d listeners: %d connections drained, %d aborted", len(removed), summary.Drained, summary.Aborted)
+	return nil
+}
+
+// Close closes the listeners the server is serving, so that Serve and
+// ListenAndServe return. Connections already accepted are left open. The
+// HTTP/3 server, if any, is stopped too, aborting its requests.
+func (s *Server) Close() {
+	s.stopListening()
+	s.closeHTTP3()
+}
+
+// stopListening closes the TCP listeners of Close.
+func (s *Server) stopListening() {
+	ls := &s.listeners
+	ls.mu.Lock()
+	var lns []net.Listener
+	for ln := range ls.lns {
+		lns = append(lns, ln)
+	}
+	for _, bound := range ls.bound {
+		lns = append(lns, bound...)
+	}
+	ls.bound = nil
+	if !ls.closed {
+		ls.closed = true
+		if ls.done == nil {
+			ls.done = make(chan struct{})
+		}
+		close(ls.done)
+	}
+	ls.mu.Unlock()
+	closeListeners(lns)
+}
@@ -0,0 +1,174 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidateListen(t *testing.T) {
+	tests := []struct {
+		s  *Server
+		ok bool
+	}{
+		{&Server{Addr: ":8080"}, true},
+		{&Server{Addr: ":8080", Network: NetworkIPv6}, true},
+		{&Server{Addr: ":8080", Network: "udp"}, false},
+		{&Server{Addr: ":8080", Interface: "lo"}, true},
+		{&Server{Addr: "127.0.0.1:8080", Interface: "lo"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.s.validateListen(); (err == nil) != tt.ok {
+			t.Fatalf("Expected network %q, addr %q and interface %q to be valid: %v, but got: %v\n", tt.s.Network, tt.s.Addr, tt.s.Interface, tt.ok, err)
+		}
+	}
+}
+
+func TestListenIPv4Only(t *testing.T) {
+	s := &Server{Addr: "127.0.0.1:0", Network: NetworkIPv4}
+	lns, err := s.listen()
+	if err != nil {
+		t.Fatalf("Failed to listen: %v\n", err)
+	}
+	closeListeners(lns)
+
+	s.Addr = "[::1]:0"
+	if lns, err := s.listen(); err == nil {
+		closeListeners(lns)
+		t.Fatalf("Expected listening on an IPv6 address to fail for %v\n", NetworkIPv4)
+	}
+}
+
+func TestListenInterface(t *testing.T) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("Failed to list interfaces: %v\n", err)
+	}
+	var loopback string
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			loopback = ifi.Name
+			break
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	s := &Server{Addr: ":0", Network: NetworkIPv4, Interface: loopback}
+	lns, err := s.listen()
+	if err != nil {
+		t.Fatalf("Failed to listen on %v: %v\n", loopback, err)
+	}
+	defer closeListeners(lns)
+	for _, ln := range lns {
+		if ip := ln.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() || ip.To4() == nil {
+			t.Fatalf("Expected to listen on IPv4 loopback addresses only but got: %v\n", ln.Addr())
+		}
+	}
+
+	s.VirtualHosts = map[string]string{"website1": "../docroot_dirs/htdocs1"}
+	go func() { _ = s.Serve(lns[0]) }()
+	conn, err := net.Dial("tcp", lns[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v\n", err.Error())
+	}
+	defer conn.Close()
+	_, _ = io.WriteString(conn, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+}
+
+// freeAddr returns a loopback address with a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v\n", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestSetListenAddrs(t *testing.T) {
+	s := newTestServer()
+	s.Addr = freeAddr(t)
+	served := make(chan error)
+	go func() { served <- s.ListenAndServe() }()
+
+	// get answers a request on conn, which stays open
+	get := func(conn net.Conn, br *bufio.Reader) error {
+		if _, err := io.WriteString(conn, "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n"); err != nil {
+			return err
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	dial := func(addr string) (net.Conn, *bufio.Reader) {
+		var conn net.Conn
+		var err error
+		for i := 0; i < 100; i++ {
+			if conn, err = net.Dial("tcp", addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Error dialing %v: %v\n", addr, err.Error())
+		}
+		return conn, bufio.NewReader(conn)
+	}
+	old, oldReader := dial(s.Addr)
+	defer old.Close()
+	if err := get(old, oldReader); err != nil {
+		t.Fatalf("Error requesting from %v: %v\n", s.Addr, err.Error())
+	}
+
+	if err := s.SetListenAddrs([]string{s.Addr, "127.0.0.1:bogus"}, time.Second); err == nil {
+		t.Fatalf("Expected an error for an invalid address\n")
+	}
+	added := freeAddr(t)
+	if err := s.SetListenAddrs([]string{s.Addr, added}, time.Second); err != nil {
+		t.Fatalf("Error adding %v: %v\n", added, err.Error())
+	}
+	conn, br := dial(added)
+	defer conn.Close()
+	if err := get(conn, br); err != nil {
+		t.Fatalf("Error requesting from %v: %v\n", added, err.Error())
+	}
+	// connections on the listeners kept are untouched
+	if err := get(old, oldReader); err != nil {
+		t.Fatalf("Expected the connection on %v to stay open but got: %v\n", s.Addr, err.Error())
+	}
+
+	if err := s.SetListenAddrs([]string{added}, time.Second); err != nil {
+		t.Fatalf("Error removing %v: %v\n", s.Addr, err.Error())
+	}
+	if _, err := oldReader.Peek(1); err != io.EOF {
+		t.Fatalf("Expected the idle connection on %v to be closed but got: %v\n", s.Addr, err)
+	}
+	if conn, err := net.Dial("tcp", s.Addr); err == nil {
+		conn.Close()
+		t.Fatalf("Expected %v to be closed\n", s.Addr)
+	}
+	if err := get(conn, br); err != nil {
+		t.Fatalf("Expected the connection on %v to stay open but got: %v\n", added, err.Error())
+	}
+
+	s.Close()
+	if err := <-served; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Expected ListenAndServe to return net.ErrClosed but got: %v\n", err)
+	}
+}
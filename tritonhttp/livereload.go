@@ -0,0 +1,119 @@
+package tritonhttp
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LiveReloadPath is the URL path of the server-sent event stream
+	// pages reload on in development mode with LiveReload.
+	LiveReloadPath = "/.tritonhttp/livereload"
+
+	LAST_EVENT_ID = "last-event-id"
+)
+
+// liveReloadPoll is how long a live-reload request waits for a change
+// before it is answered with no event, and the browser asks again.
+const liveReloadPoll = 30 * time.Second
+
+// liveReloadScript is injected into HTML pages in development mode. The
+// browser reloads the page when the server sends a message.
+const liveReloadScript = `<script>new EventSource("` + LiveReloadPath + `").onmessage = function () { location.reload(); };</script>`
+
+// liveReload tracks the generation of the watched files: the number of
+// changes seen so far.
+type liveReload struct {
+	mu      sync.Mutex
+	gen     uint64
+	changed chan struct{}
+}
+
+// notify records a change and wakes up the waiting requests.
+func (l *liveReload) notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// current returns the generation and a channel closed on the next change.
+func (l *liveReload) current() (uint64, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	return l.gen, l.changed
+}
+
+// liveReloadRoute reports whether req asks for the live-reload events.
+func (s *Server) liveReloadRoute(req *Request) bool {
+	if !s.Dev || !s.LiveReload || req.Method != methodGet {
+		return false
+	}
+	urlPath, err := cleanURLPath(req.URL)
+	return err == nil && urlPath == LiveReloadPath
+}
+
+// serveLiveReload answers an EventSource request of a page in development
+// mode. Each response carries at most one event, and the browser connects
+// again once it is read, so the request is long-polled rather than kept
+// open: it is answered with a "reload" message as soon as a watched file
+// changes, or with no message once liveReloadPoll elapses. Every response
+// sets the event ID to the generation of the files, which the browser
+// sends back as Last-Event-ID, so a change between two requests is not
+// missed.
+func (s *Server) serveLiveReload(req *Request) *Response {
+	gen, changed := s.reloads.current()
+	seen, err := strconv.ParseUint(req.Headers[LAST_EVENT_ID], 10, 64)
+	if err == nil && seen < gen {
+		return liveReloadEvent(s.newResponse(statusOK, responseOptions{req: req}), gen, true)
+	}
+	select {
+	case <-changed:
+		gen, _ = s.reloads.current()
+		return liveReloadEvent(s.newResponse(statusOK, responseOptions{req: req}), gen, true)
+	case <-req.LongPoll(liveReloadPoll):
+		return liveReloadEvent(s.newResponse(statusOK, responseOptions{req: req}), gen, false)
+	}
+}
+
+// liveReloadEvent makes res the event stream for generation gen, with a
+// reload message if reload is set.
+func liveReloadEvent(res *Response, gen uint64, reload bool) *Response {
+	body := "retry: 500\nid: " + strconv.FormatUint(gen, 10) + "\n"
+	if reload {
+		body += "data: reload\n"
+	}
+	res.SetBody("text/event-stream", body+"\n")
+	res.Headers["Cache-Control"] = devCacheControl
+	return res
+}
+
+// injectLiveReload adds liveReloadScript to res, an HTML page, before its
+// closing body tag, or at its end if it has none.
+func (s *Server) injectLiveReload(res *Response) {
+	if !s.LiveReload || !strings.HasPrefix(res.Headers["Content-Type"], "text/html") {
+		return
+	}
+	page := res.Body
+	if page == "" {
+		data, err := os.ReadFile(res.FilePath)
+		if err != nil {
+			return
+		}
+		page = string(data)
+	}
+	i := strings.LastIndex(strings.ToLower(page), "</body>")
+	if i < 0 {
+		i = len(page)
+	}
+	res.SetBody(res.Headers["Content-Type"], page[:i]+liveReloadScript+page[i:])
+}
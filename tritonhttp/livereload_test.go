@@ -0,0 +1,56 @@
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func liveReloadServer(t *testing.T) *Server {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><BODY>hi</BODY></html>"), 0o644); err != nil {
+		t.Fatalf("Error writing index.html: %v\n", err.Error())
+	}
+	return &Server{DocRoot: dir, VirtualHosts: map[string]string{"website1": dir}, Dev: true, LiveReload: true}
+}
+
+func TestLiveReloadInjection(t *testing.T) {
+	s := liveReloadServer(t)
+	resp := parseResponse(t, serveRaw(t, s, "GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	body, _ := io.ReadAll(resp.Body)
+	if want := "<html><BODY>hi" + liveReloadScript + "</BODY></html>"; string(body) != want {
+		t.Fatalf("Expected page %q but got: %q\n", want, body)
+	}
+}
+
+func TestLiveReloadEvents(t *testing.T) {
+	s := liveReloadServer(t)
+	request := "GET " + LiveReloadPath + " HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n"
+
+	// a page that missed a change reloads at once
+	s.reloads.notify()
+	resp := parseResponse(t, serveRaw(t, s, request+"Last-Event-ID: 0\r\n\r\n"))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "text/event-stream" || !strings.Contains(string(body), "id: 1\ndata: reload\n") {
+		t.Fatalf("Expected a reload event with id 1 but got: %q\n", body)
+	}
+
+	// a page that is up to date waits for the next change
+	out := make(chan string)
+	go func() {
+		out <- serveRaw(t, s, request+"Last-Event-ID: 1\r\n\r\n")
+	}()
+	select {
+	case raw := <-out:
+		t.Fatalf("Expected the request to wait for a change but got: %q\n", raw)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.invalidate(filepath.Join(s.DocRoot, "index.html"))
+	body, _ = io.ReadAll(parseResponse(t, <-out).Body)
+	if !strings.Contains(string(body), "id: 2\ndata: reload\n") {
+		t.Fatalf("Expected a reload event with id 2 but got: %q\n", body)
+	}
+}
@@ -0,0 +1,54 @@
+package tritonhttp
+
+import (
+	"log"
+	"time"
+)
+
+// longPollGrace is the time left to write the response, and to read what
+// remains of the request body, once a long poll expires.
+const longPollGrace = 5 * time.Second
+
+// LongPoll marks req as a long-polling request: its handler may block for
+// up to timeout waiting for data before answering. The connection deadlines
+// are extended to cover the wait, so neither Server.IdleTimeout nor a slow
+// request body cuts the exchange short, and they are restored for the next
+// request once the response is sent. The response is written as soon as
+// the handler returns.
+//
+// The returned channel receives when timeout has elapsed, so a handler can
+// wait for either its data or the end of the poll, e.g. with messages a
+// chan string fed elsewhere:
+//
+//	s.HandleFunc("/messages", func(req *Request) *Response {
+//		res := &Response{}
+//		select {
+//		case msg := <-messages:
+//			res.HandleOK()
+//			res.SetBody("text/plain", msg)
+//		case <-req.LongPoll(30 * time.Second):
+//			// nothing new, the client polls again
+//			res.HandleError(204)
+//		}
+//		return res
+//	})
+//
+// Over HTTP/2 and HTTP/3, where the transport manages timeouts per stream,
+// only the channel is of use.
+func (req *Request) LongPoll(timeout time.Duration) <-chan time.Time {
+	if req.conn != nil {
+		deadline := time.Now().Add(timeout + longPollGrace)
+		if err := req.conn.SetDeadline(deadline); err != nil {
+			log.Printf("Failed to extend timeout for connection %v", req.conn.RemoteAddr())
+		}
+		req.longPolled = true
+		if c, ok := req.conn.(*pipelinedConn); ok {
+			// the responses to the requests pipelined before this
+			// one need not wait for it
+			if err := c.flush(); err != nil {
+				log.Printf("Failed to write responses to %v: %v", req.conn.RemoteAddr(), err)
+			}
+		}
+	}
+	return time.After(timeout)
+}
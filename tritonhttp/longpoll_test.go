@@ -0,0 +1,80 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLongPoll(t *testing.T) {
+	s := newTestServer()
+	s.IdleTimeout = 20 * time.Millisecond
+	messages := make(chan string, 1)
+	s.HandleFunc("/poll", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		expired := req.LongPoll(200 * time.Millisecond)
+		// the body is sent after the idle timeout has passed
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			res.HandleError(statusBadRequest)
+			return res
+		}
+		select {
+		case msg := <-messages:
+			res.SetBody("text/plain", string(body)+msg)
+		case <-expired:
+			res.HandleError(statusNoContent)
+		}
+		return res
+	})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.HandleConnection(server)
+	br := bufio.NewReader(client)
+
+	tests := []struct {
+		name    string
+		message string
+		code    int
+		body    string
+	}{
+		{"data arrives", "world", 200, "hello world"},
+		{"poll expires", "", 204, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _ = io.WriteString(client, "POST /poll HTTP/1.1\r\nHost: website1\r\nContent-Length: 6\r\n\r\n")
+			time.Sleep(50 * time.Millisecond)
+			_, _ = io.WriteString(client, "hello ")
+			if tt.message != "" {
+				time.Sleep(50 * time.Millisecond)
+				messages <- tt.message
+			}
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("got an error parsing the response: %v\n", err.Error())
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if resp.StatusCode != tt.code || string(body) != tt.body {
+				t.Fatalf("Expected %v %q but got: %v %q\n", tt.code, tt.body, resp.StatusCode, body)
+			}
+		})
+	}
+
+	// the idle timeout applies again once the exchange is over
+	start := time.Now()
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the connection to be closed but got %v\n", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Connection took %v to time out\n", elapsed)
+	}
+}
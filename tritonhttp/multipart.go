@@ -0,0 +1,40 @@
+package tritonhttp
+
+import (
+	"errors"
+	"mime"
+	"mime/multipart"
+)
+
+const CONTENT_TYPE = "content-type"
+
+// ErrNotMultipart is returned when a request body is not multipart/form-data.
+var ErrNotMultipart = errors.New("request Content-Type isn't multipart/form-data")
+
+// MultipartReader returns a reader over the parts of a multipart/form-data
+// request body, so handlers can stream each part, e.g. a large uploaded
+// file, without buffering it.
+func (req *Request) MultipartReader() (*multipart.Reader, error) {
+	mediaType, params, err := mime.ParseMediaType(req.Headers[CONTENT_TYPE])
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, badStringError("missing boundary in Content-Type", req.Headers[CONTENT_TYPE])
+	}
+	return multipart.NewReader(req.Body, boundary), nil
+}
+
+// ParseMultipartForm reads a whole multipart/form-data request body. Up to
+// maxMemory bytes of file parts are kept in memory, the remainder is
+// spooled to temporary files; the caller must call RemoveAll on the form
+// once done with it. The total size of the body is capped by
+// Server.MaxBodyBytes.
+func (req *Request) ParseMultipartForm(maxMemory int64) (*multipart.Form, error) {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return mr.ReadForm(maxMemory)
+}
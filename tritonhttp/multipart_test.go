@@ -0,0 +1,119 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func multipartRequest(t *testing.T, url string, fields map[string]string, files map[string]string) string {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatalf("Error writing field: %v\n", err.Error())
+		}
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("Error creating file part: %v\n", err.Error())
+		}
+		_, _ = io.WriteString(fw, content)
+	}
+	mw.Close()
+	return "POST " + url + " HTTP/1.1\r\nHost: website1\r\n" +
+		"Content-Type: " + mw.FormDataContentType() + "\r\n" +
+		"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n\r\n" + body.String()
+}
+
+func TestMultipartUploadForm(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer()
+	s.HandleFunc("/upload", func(req *Request) *Response {
+		res := &Response{}
+		form, err := req.ParseMultipartForm(1 << 10)
+		if err != nil {
+			res.HandleError(statusBadRequest)
+			return res
+		}
+		defer form.RemoveAll()
+		for _, fh := range form.File["file"] {
+			src, err := fh.Open()
+			if err != nil {
+				res.HandleError(statusInternalServerError)
+				return res
+			}
+			content, _ := io.ReadAll(src)
+			src.Close()
+			_ = os.WriteFile(filepath.Join(dir, filepath.Base(fh.Filename)), content, 0644)
+		}
+		res.HandleOK()
+		res.SetBody("text/plain", "thanks "+form.Value["name"][0])
+		return res
+	})
+
+	big := string(bytes.Repeat([]byte("x"), 4<<10))
+	raw := multipartRequest(t, "/upload", map[string]string{"name": "ann"}, map[string]string{"a.txt": "hello", "big.bin": big})
+	resp := parseResponse(t, serveRaw(t, s, raw+"GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "thanks ann" {
+		t.Fatalf("Unexpected response %v %q\n", resp.StatusCode, body)
+	}
+	for name, want := range map[string]string{"a.txt": "hello", "big.bin": big} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("Upload %v was not saved (%v)\n", name, err)
+		}
+	}
+}
+
+func TestMultipartStreaming(t *testing.T) {
+	s := newTestServer()
+	var names []string
+	s.HandleFunc("/stream", func(req *Request) *Response {
+		res := &Response{}
+		mr, err := req.MultipartReader()
+		if err != nil {
+			res.HandleError(statusBadRequest)
+			return res
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				res.HandleError(statusBadRequest)
+				return res
+			}
+			names = append(names, part.FormName())
+		}
+		res.HandleOK()
+		return res
+	})
+
+	raw := multipartRequest(t, "/stream", map[string]string{"a": "1"}, map[string]string{"f.txt": "data"})
+	resp := parseResponse(t, serveRaw(t, s, raw+"POST /stream HTTP/1.1\r\nHost: website1\r\nContent-Length: 3\r\nConnection: close\r\n\r\nabc"))
+	if resp.StatusCode != 200 || len(names) != 2 {
+		t.Fatalf("Unexpected response %v after parts %v\n", resp.StatusCode, names)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	s := newTestServer()
+	s.MaxBodyBytes = 16
+	s.HandleFunc("/upload", func(req *Request) *Response {
+		t.Fatal("The handler was called for a body over the limit")
+		return nil
+	})
+	raw := multipartRequest(t, "/upload", map[string]string{"name": "a long enough value"}, nil)
+	resp := parseResponse(t, serveRaw(t, s, raw))
+	if resp.StatusCode != 413 || !resp.Close {
+		t.Fatalf("Expected a 413 closing the connection but got %v\n", resp.StatusCode)
+	}
+}
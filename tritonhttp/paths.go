@@ -0,0 +1,46 @@
+package tritonhttp
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// cleanURLPath returns the path of the request target, without the query,
+// percent-decoded and cleaned in URL space: it is rooted, has no "." or
+// ".." elements, and keeps a trailing slash.
+func cleanURLPath(target string) (string, error) {
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		target = target[:i]
+	}
+	decoded, err := url.PathUnescape(target)
+	if err != nil {
+		return "", err
+	}
+	cleaned := path.Clean("/" + decoded)
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// docrootPath maps the request target to the file it names under docroot,
+// using the path syntax of the operating system. It fails for targets that
+// could name anything outside docroot, e.g. ones containing a backslash,
+// which Windows takes for a separator, or a Windows device name.
+func docrootPath(docroot, target string) (string, error) {
+	urlPath, err := cleanURLPath(target)
+	if err != nil {
+		return "", notFoundError("IllegalAccessError: malformed URL path. ", target)
+	}
+	rel := strings.Trim(urlPath, "/")
+	if rel == "" {
+		return filepath.Clean(docroot), nil
+	}
+	local := filepath.FromSlash(rel)
+	if strings.ContainsAny(rel, "\\\x00") || !filepath.IsLocal(local) {
+		return "", notFoundError("IllegalAccessError: URL trying to access files outside of docroot. ", target)
+	}
+	return filepath.Join(docroot, local), nil
+}
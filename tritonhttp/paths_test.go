@@ -0,0 +1,85 @@
+package tritonhttp
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanURLPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/", "/"},
+		{"/index.html?x=1", "/index.html"},
+		{"/a/./b/../c", "/a/c"},
+		{"/../../etc/passwd", "/etc/passwd"},
+		{"/subdir/", "/subdir/"},
+		{"//subdir//", "/subdir/"},
+		{"/my%20file.txt", "/my file.txt"},
+		{"/a%2F..%2F..%2Fb", "/b"},
+	}
+	for _, tt := range tests {
+		got, err := cleanURLPath(tt.target)
+		if err != nil || got != tt.want {
+			t.Fatalf("cleanURLPath(%q) = %q, %v, want %q\n", tt.target, got, err, tt.want)
+		}
+	}
+	if _, err := cleanURLPath("/%zz"); err == nil {
+		t.Fatal("Expected an error for a malformed escape")
+	}
+}
+
+func TestDocrootPath(t *testing.T) {
+	docroot := filepath.Join("srv", "www")
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/", docroot},
+		{"/index.html", filepath.Join(docroot, "index.html")},
+		{"/subdir/", filepath.Join(docroot, "subdir")},
+		{"/a/b.txt?q", filepath.Join(docroot, "a", "b.txt")},
+		{"/../secret", filepath.Join(docroot, "secret")},
+		{"/..%2Fsecret", filepath.Join(docroot, "secret")},
+	}
+	for _, tt := range tests {
+		// with and without a trailing separator on the docroot
+		for _, root := range []string{docroot, docroot + string(filepath.Separator)} {
+			got, err := docrootPath(root, tt.target)
+			if err != nil || got != tt.want {
+				t.Fatalf("docrootPath(%q, %q) = %q, %v, want %q\n", root, tt.target, got, err, tt.want)
+			}
+		}
+	}
+	for _, target := range []string{"/..\\secret", "/a%5C..%5C..%5Csecret", "/a%00.html"} {
+		if got, err := docrootPath(docroot, target); err == nil {
+			t.Fatalf("Expected docrootPath(%q) to fail but got %q\n", target, got)
+		}
+	}
+}
+
+func TestServePaths(t *testing.T) {
+	s := newTestServer()
+	// docroots configured without the path separator at the end
+	s.VirtualHosts["website1"] = filepath.Clean("../docroot_dirs/htdocs1")
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/index.html?v=2", 200},
+		{"/%69ndex.html", 200},
+		{"/subdir/", 200},
+		{"/subdir/../index.html", 200},
+		{"/subdir", 404},
+		{"/../htdocs2/index.html", 404},
+		// dotfiles are files like any other
+		{"/.DS_Store", 200},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for %v but got: %v\n", tt.code, tt.url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package tritonhttp
+
+import "testing"
+
+func TestDocrootPathWindows(t *testing.T) {
+	tests := []struct {
+		docroot string
+		target  string
+		want    string
+	}{
+		{`C:\www`, "/index.html", `C:\www\index.html`},
+		{`C:\www\`, "/a/b/c.txt", `C:\www\a\b\c.txt`},
+		{`\\server\share\www`, "/subdir/", `\\server\share\www\subdir`},
+		{`C:\www`, "/../windows/win.ini", `C:\www\windows\win.ini`},
+	}
+	for _, tt := range tests {
+		got, err := docrootPath(tt.docroot, tt.target)
+		if err != nil || got != tt.want {
+			t.Fatalf("docrootPath(%q, %q) = %q, %v, want %q\n", tt.docroot, tt.target, got, err, tt.want)
+		}
+	}
+	// drive letters and device names must not escape the docroot
+	for _, target := range []string{"/C:/windows/win.ini", "/NUL", "/a/CON", "/..%5C..%5Cwindows"} {
+		if got, err := docrootPath(`C:\www`, target); err == nil {
+			t.Fatalf("Expected docrootPath(%q) to fail but got %q\n", target, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"net"
+)
+
+// pipelinedConn is an HTTP/1.1 connection whose responses are buffered
+// until the server runs out of requests to answer. A client pipelining
+// requests sends several before reading the responses: those already in
+// the read buffer are parsed and answered in order, and their responses go
+// out back-to-back, in as few writes as possible. The buffered responses
+// are flushed whenever reading blocks on the network, so a client waiting
+// for a response, or for 100 Continue, always gets it.
+type pipelinedConn struct {
+	net.Conn
+	bw *bufio.Writer
+}
+
+func newPipelinedConn(conn net.Conn) *pipelinedConn {
+	return &pipelinedConn{Conn: conn, bw: bufio.NewWriter(conn)}
+}
+
+// Read flushes the buffered responses before reading from the network.
+// A bufio.Reader on the connection only calls it once its buffer is empty,
+// that is once every pipelined request received was answered.
+func (c *pipelinedConn) Read(p []byte) (int, error) {
+	if err := c.flush(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *pipelinedConn) Write(p []byte) (int, error) {
+	return c.bw.Write(p)
+}
+
+// flush writes the buffered responses to the network.
+func (c *pipelinedConn) flush() error {
+	return c.bw.Flush()
+}
+
+// netConn returns the network connection under conn.
+func netConn(conn net.Conn) net.Conn {
+	if c, ok := conn.(*pipelinedConn); ok {
+		return c.Conn
+	}
+	return conn
+}
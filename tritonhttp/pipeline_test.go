@@ -0,0 +1,73 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// writeCountingConn counts the writes to the connection.
+type writeCountingConn struct {
+	*scriptedConn
+	writes int
+}
+
+func (c *writeCountingConn) Write(p []byte) (int, error) {
+	c.writes++
+	return c.scriptedConn.Write(p)
+}
+
+func TestPipelinedResponses(t *testing.T) {
+	requests := "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n" +
+		"GET /nope HTTP/1.1\r\nHost: website1\r\n\r\n" +
+		"GET /subdir/ HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"
+	conn := &writeCountingConn{scriptedConn: &scriptedConn{r: strings.NewReader(requests)}}
+	newTestServer().HandleConnection(conn)
+
+	br := bufio.NewReader(&conn.out)
+	for _, code := range []int{200, 404, 200} {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("got an error parsing the response: %v\n", err.Error())
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode != code {
+			t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+		}
+	}
+	if conn.writes != 1 {
+		t.Fatalf("Expected the responses to go out in a single write but got: %v\n", conn.writes)
+	}
+}
+
+func TestPipelinedPartialRequest(t *testing.T) {
+	client, server := net.Pipe()
+	go newTestServer().HandleConnection(server)
+	defer client.Close()
+
+	// the second request is incomplete: the first response must not wait
+	// for it
+	go func() {
+		_, _ = io.WriteString(client, "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\nGET /index.html HTTP/1.1\r\n")
+	}()
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	go func() {
+		_, _ = io.WriteString(client, "Host: website1\r\nConnection: close\r\n\r\n")
+	}()
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 200 || !resp.Close {
+		t.Fatalf("Expected the second request to be answered but got: %v\n", resp.StatusCode)
+	}
+}
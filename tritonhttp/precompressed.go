@@ -0,0 +1,53 @@
+package tritonhttp
+
+import "os"
+
+// sidecars lists the content codings of precompressed sidecar files, such
+// as those tritonpack writes, with their suffix, in the order of
+// preference.
+var sidecars = []struct {
+	coding string
+	ext    string
+}{
+	{"br", ".br"},
+	{"zstd", ".zst"},
+	{"gzip", ".gz"},
+}
+
+// servePrecompressed makes res, a 200 response for a file, send the
+// precompressed sidecar of the file instead, e.g. app.js.gz next to app.js,
+// when Server.Precompressed is set and the "Accept-Encoding" header of req
+// accepts its coding. The response keeps the Content-Type and validators
+// of the file, names the coding in "Content-Encoding" and carries an ETag
+// of its own. Sidecars older than their file are stale and ignored. They
+// are never served in development mode, where files change all the time,
+// nor for a transcoded body.
+func (s *Server) servePrecompressed(req *Request, res *Response) {
+	if !s.Precompressed || s.Dev || res.Body != "" || res.FilePath == "" {
+		return
+	}
+	found := make(map[string]os.FileInfo)
+	var codings []string
+	for _, sc := range sidecars {
+		info, err := os.Stat(res.FilePath + sc.ext)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(res.LastModified) {
+			continue
+		}
+		found[sc.ext] = info
+		codings = append(codings, sc.coding)
+	}
+	if len(codings) == 0 {
+		return
+	}
+	// the response varies once a sidecar exists, even if req does not
+	// accept its coding
+	coding := chooseEncoding(parseWeightedList(req.VaryOn(ACCEPT_ENCODING)), codings)
+	for _, sc := range sidecars {
+		if sc.coding == coding {
+			res.FilePath += sc.ext
+			res.ContentLength = found[sc.ext].Size()
+			setContentEncoding(res, coding)
+			return
+		}
+	}
+}
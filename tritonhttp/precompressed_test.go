@@ -0,0 +1,81 @@
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrecompressed(t *testing.T) {
+	docroot := t.TempDir()
+	modTime := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	files := map[string]string{
+		"app.js":       "console.log('hello');",
+		"app.js.gz":    "gzip bytes",
+		"app.js.br":    "brotli bytes",
+		"old.js":       "console.log('new');",
+		"old.js.gz":    "stale gzip bytes",
+		"style.css":    "body {}",
+		"style.css.gz": "css gzip bytes",
+	}
+	for name, content := range files {
+		path := filepath.Join(docroot, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing file: %v\n", err.Error())
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Error setting times: %v\n", err.Error())
+		}
+	}
+	stale := modTime.Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(docroot, "old.js.gz"), stale, stale); err != nil {
+		t.Fatalf("Error setting times: %v\n", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		disabled bool
+		url      string
+		headers  string
+		code     int
+		encoding string
+		vary     string
+		body     string
+	}{
+		{"gzip", false, "/app.js", "Accept-Encoding: gzip\r\n", 200, "gzip", "Accept-Encoding", "gzip bytes"},
+		{"brotli preferred", false, "/app.js", "Accept-Encoding: gzip, br\r\n", 200, "br", "Accept-Encoding", "brotli bytes"},
+		{"weights", false, "/app.js", "Accept-Encoding: gzip, br;q=0.5\r\n", 200, "gzip", "Accept-Encoding", "gzip bytes"},
+		{"not accepted", false, "/app.js", "", 200, "", "Accept-Encoding", "console.log('hello');"},
+		{"stale", false, "/old.js", "Accept-Encoding: gzip\r\n", 200, "", "", "console.log('new');"},
+		{"disabled", true, "/app.js", "Accept-Encoding: gzip\r\n", 200, "", "", "console.log('hello');"},
+		{"range of sidecar", false, "/style.css", "Accept-Encoding: gzip\r\nRange: bytes=0-2\r\n", 206, "gzip", "Accept-Encoding", "css"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"website1": docroot}, Precompressed: !tt.disabled}
+			resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\n"+tt.headers+"Connection: close\r\n\r\n"))
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected Content-Encoding %q but got %q\n", tt.encoding, got)
+			}
+			if got := resp.Header.Get("Vary"); got != tt.vary {
+				t.Fatalf("Expected Vary %q but got %q\n", tt.vary, got)
+			}
+			if want := MIMETypeByExtension(filepath.Ext(tt.url)); resp.Header.Get("Content-Type") != want {
+				t.Fatalf("Expected Content-Type %v but got %v\n", want, resp.Header.Get("Content-Type"))
+			}
+			if string(body) != tt.body {
+				t.Fatalf("Expected body %q but got %q\n", tt.body, body)
+			}
+		})
+	}
+}
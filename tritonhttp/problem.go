@@ -0,0 +1,70 @@
+package tritonhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypeBlank   = "about:blank"
+
+	REQUEST_ID = "x-request-id"
+)
+
+// Problem is an RFC 7807 "problem details" object describing why a
+// request could not be served.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// newRequestID returns a random identifier used to correlate an error
+// response with the server logs.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the client supplied X-Request-Id of req, or a newly
+// generated one when the client did not send any.
+func requestID(req *Request) string {
+	if req != nil {
+		if id, ok := req.Headers[REQUEST_ID]; ok && id != "" {
+			return id
+		}
+	}
+	return newRequestID()
+}
+
+// HandleProblem attaches an application/problem+json body to res, which must
+// already carry its final status code. req may be nil when the request could
+// not be parsed.
+func (res *Response) HandleProblem(req *Request, detail string) error {
+	p := Problem{
+		Type:      problemTypeBlank,
+		Title:     statusText[res.StatusCode],
+		Status:    res.StatusCode,
+		Detail:    detail,
+		RequestID: requestID(req),
+	}
+	if req != nil {
+		p.Instance = req.URL
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	res.Body = string(body)
+	res.Headers["Content-Type"] = problemContentType
+	res.ContentLength = int64(len(res.Body))
+	return nil
+}
@@ -0,0 +1,196 @@
+package tritonhttp
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxProxyBytes is the size limit of relayed response bodies when
+// Server.MaxProxyBytes is zero.
+const DefaultMaxProxyBytes = 10 << 20
+
+// proxyVia identifies the server in the "Via" header of proxied messages.
+const proxyVia = "1.1 tritonhttp"
+
+// forwardsProxy reports whether req is a forward-proxy request: an
+// absolute-form request, with forward proxying enabled, for a host that is
+// not one of the virtual hosts.
+func (s *Server) forwardsProxy(req *Request) bool {
+	if len(s.ProxyHosts) == 0 || req.absoluteURL == "" {
+		return false
+	}
+	_, _, local := lookupHost(s.virtualHosts(), req.Host)
+	return !local
+}
+
+func (s *Server) maxProxyBytes() int64 {
+	if s.MaxProxyBytes == 0 {
+		return DefaultMaxProxyBytes
+	}
+	return s.MaxProxyBytes
+}
+
+// proxyAllowed reports whether host, without its port, is in ProxyHosts.
+func (s *Server) proxyAllowed(host string) bool {
+	for _, allowed := range s.ProxyHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxy fetches the absolute-form target of req from its upstream server
+// and relays the response. Only plain http GET requests to the hosts of
+// ProxyHosts are forwarded.
+func (s *Server) proxy(req *Request) *Response {
+	u, err := url.Parse(req.absoluteURL)
+	if err != nil || u.Scheme != "http" || !s.proxyAllowed(u.Hostname()) {
+		return s.newResponse(statusForbidden, responseOptions{req: req, detail: "requests for " + req.absoluteURL + " are not forwarded"})
+	}
+	if req.Method != methodGet {
+		return s.newResponse(statusMethodNotAllowed, responseOptions{req: req, detail: req.Method + " requests are not forwarded"})
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "80")
+	}
+	relayed, err := s.fetchUpstream(addr, s.upstreamRequest(req, u.Host, u.RequestURI()))
+	if err != nil {
+		return s.upstreamFailed(req, u.Host, err)
+	}
+	return relayResponse(req, relayed)
+}
+
+// upstreamRequest returns the request to forward to an upstream server for
+// req: a copy of it for host and uri, carrying the body of req, without
+// hop-by-hop headers, with the server added to "Via" and the client to the
+// Forwarded headers.
+func (s *Server) upstreamRequest(req *Request, host, uri string) *Request {
+	upstream := NewRequest(host, uri)
+	upstream.Method = req.Method
+	for k, v := range req.Headers {
+		upstream.Headers[k] = v
+	}
+	upstream.ConnectionTokens = req.ConnectionTokens
+	upstream.removeHopByHopHeaders()
+	upstream.ConnectionTokens = nil
+	delete(upstream.Headers, HOST)
+	// the body is sent right away, the client already got its 100 Continue
+	delete(upstream.Headers, EXPECT)
+	upstream.Headers["via"] = appendVia(upstream.Headers["via"])
+	s.addForwarded(upstream, req)
+	upstream.Body = req.Body
+	upstream.ContentLength = req.ContentLength
+	upstream.Trailers = req.Trailers
+	upstream.Close = true
+	return upstream
+}
+
+// fetchUpstream sends upstream to the server at addr, over a connection of
+// its own, and returns the response.
+func (s *Server) fetchUpstream(addr string, upstream *Request) (*Response, error) {
+	c := &Client{Addr: addr, MaxBodyBytes: s.maxProxyBytes()}
+	defer c.Close()
+	return c.Do(upstream)
+}
+
+// upstreamFailed answers req with 502 after the upstream server host
+// failed to answer with err.
+func (s *Server) upstreamFailed(req *Request, host string, err error) *Response {
+	log.Printf("Failed to fetch %v from %v: %v", req.URL, host, err)
+	detail := "cannot fetch " + req.URL + " from " + host
+	if errors.Is(err, ErrResponseTooLarge) {
+		detail = "the response from " + host + " is too large"
+	}
+	return s.newResponse(statusBadGateway, responseOptions{req: req, detail: detail})
+}
+
+// relayResponse turns relayed, the response of an upstream server, into
+// the response to req, without hop-by-hop headers and with the server
+// added to "Via".
+func relayResponse(req *Request, relayed *Response) *Response {
+	res := &Response{
+		Proto:         responseProto,
+		StatusCode:    relayed.StatusCode,
+		StatusText:    relayed.StatusText,
+		Headers:       make(map[string]string, len(relayed.Headers)),
+		Request:       req,
+		Body:          relayed.Body,
+		LastModified:  relayed.LastModified,
+		ContentLength: relayed.ContentLength,
+		Cookies:       relayed.Cookies,
+	}
+	connectionTokens := parseTokenList(relayed.Headers["Connection"])
+	for k, v := range relayed.Headers {
+		if !containsFold(hopByHopHeaders, k) && !containsFold(connectionTokens, k) {
+			res.Headers[k] = v
+		}
+	}
+	res.Headers["Via"] = appendVia(res.Headers["Via"])
+	if req.Close {
+		res.Headers["Connection"] = "close"
+	}
+	return res
+}
+
+// appendVia adds the server to the "Via" header value via.
+func appendVia(via string) string {
+	if via == "" {
+		return proxyVia
+	}
+	return via + ", " + proxyVia
+}
+
+// reverseProxy forwards req to one of the upstream servers of its virtual
+// host, which has the given settings, chosen as settings.Affinity says, and
+// relays the response.
+func (s *Server) reverseProxy(req *Request, host string, settings VirtualHostSettings) *Response {
+	addr, ok := s.pickUpstream(req, host, settings)
+	if !ok {
+		return s.newResponse(statusServiceUnavailable, responseOptions{req: req, detail: "no upstream of " + req.Host + " is available"})
+	}
+	res := s.forwardTo(req, host, addr)
+	// a failed upstream is no place to pin the client to
+	if settings.Affinity == AffinityCookie && res.StatusCode != statusBadGateway {
+		setAffinityCookie(req, res, addr)
+	}
+	return res
+}
+
+// forwardTo sends req to addr, an upstream of the virtual host host, and
+// relays the response, answering from the cache when it can; see
+// Server.ProxyCacheBytes.
+func (s *Server) forwardTo(req *Request, host, addr string) *Response {
+	if !s.cachesProxy() || !cacheableRequest(req) {
+		relayed, err := s.fetchFromPool(host, addr, s.upstreamRequest(req, req.Host, req.URL))
+		if err != nil {
+			return s.upstreamFailed(req, addr, err)
+		}
+		return relayResponse(req, relayed)
+	}
+
+	key := req.Host + req.URL
+	now := s.now()
+	entry := s.proxyCache.get(key, req)
+	if entry != nil && entry.fresh(now) && !requestsRevalidation(req) {
+		return entry.response(req, now)
+	}
+	upstream := s.upstreamRequest(req, req.Host, req.URL)
+	if entry != nil {
+		entry.addValidators(upstream)
+	}
+	relayed, err := s.fetchFromPool(host, addr, upstream)
+	if err != nil {
+		return s.upstreamFailed(req, addr, err)
+	}
+	if entry != nil && relayed.StatusCode == statusNotModified {
+		entry = s.proxyCache.revalidated(entry, relayed, now)
+		return entry.response(req, now)
+	}
+	s.proxyCache.store(key, req, relayed, now, s.maxProxyCacheObject(), s.ProxyCacheBytes)
+	return relayResponse(req, relayed)
+}
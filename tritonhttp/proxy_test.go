@@ -0,0 +1,99 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Via") != proxyVia || r.Header.Get("Proxy-Connection") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/chunked":
+			_, _ = io.WriteString(w, "hello ")
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "world")
+		case "/big":
+			_, _ = io.WriteString(w, strings.Repeat("a", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "http://")
+
+	s := newTestServer()
+	s.ProxyHosts = []string{"127.0.0.1"}
+	s.MaxProxyBytes = 50
+
+	tests := []struct {
+		name   string
+		target string
+		host   string
+		code   int
+		body   string
+	}{
+		{"chunked", upstream.URL + "/chunked", host, 200, "hello world"},
+		{"upstream error", upstream.URL + "/missing", host, 404, "404 page not found\n"},
+		{"too large", upstream.URL + "/big", host, 502, ""},
+		{"not allowed", "http://example.com/", "example.com", 403, ""},
+		{"https", "https://" + host + "/chunked", host, 403, ""},
+		{"virtual host", "http://website1/index.html", "website1", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, s, "GET "+tt.target+" HTTP/1.1\r\nHost: "+tt.host+"\r\n"+
+				"Proxy-Connection: keep-alive\r\nConnection: close\r\n\r\n"))
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading response body: %v\n", err.Error())
+			}
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Fatalf("Expected body %q but got %q\n", tt.body, body)
+			}
+			if tt.body != "" && resp.Header.Get("Via") != proxyVia {
+				t.Fatalf("Expected Via %q but got %q\n", proxyVia, resp.Header.Get("Via"))
+			}
+		})
+	}
+}
+
+func TestReverseProxyHead(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"proxied": {Upstreams: []string{strings.TrimPrefix(upstream.URL, "http://")}},
+	}
+
+	// a GET on the same connection checks the framing of the HEAD response
+	raw := serveRaw(t, s, "HEAD /a HTTP/1.1\r\nHost: proxied\r\n\r\nGET /b HTTP/1.1\r\nHost: proxied\r\nConnection: close\r\n\r\n")
+	br := bufio.NewReader(strings.NewReader(raw))
+	for _, method := range []string{"HEAD", "GET"} {
+		resp, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			t.Fatalf("got an error parsing the %v response: %v\n", method, err.Error())
+		}
+		body, _ := io.ReadAll(resp.Body)
+		want := "hello"
+		if method == "HEAD" {
+			want = ""
+		}
+		if resp.StatusCode != 200 || resp.ContentLength != 5 || string(body) != want {
+			t.Fatalf("Expected %v to get 200 announcing 5 bytes and %q but got %v, %v and %q\n", method, want, resp.StatusCode, resp.ContentLength, body)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package tritonhttp
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxProxyCacheObject is the size limit of a cached response body
+// when Server.MaxProxyCacheObject is zero.
+const DefaultMaxProxyCacheObject = 1 << 20
+
+func (s *Server) cachesProxy() bool {
+	return s.ProxyCacheBytes > 0
+}
+
+func (s *Server) maxProxyCacheObject() int64 {
+	if s.MaxProxyCacheObject == 0 {
+		return DefaultMaxProxyCacheObject
+	}
+	return s.MaxProxyCacheObject
+}
+
+// cacheControl parses a "Cache-Control" header into its lower-cased
+// directives and their arguments, "" for directives without one.
+func cacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, element := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(element, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k != "" {
+			directives[k] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return directives
+}
+
+// cacheableRequest reports whether the response to req may come from, or
+// go to, the proxy cache.
+func cacheableRequest(req *Request) bool {
+	if req.Method != methodGet {
+		return false
+	}
+	if _, ok := req.Headers["authorization"]; ok {
+		return false
+	}
+	_, noStore := cacheControl(req.Headers["cache-control"])["no-store"]
+	return !noStore
+}
+
+// requestsRevalidation reports whether req asks for a response validated
+// with the upstream server, even if a fresh one is cached.
+func requestsRevalidation(req *Request) bool {
+	directives := cacheControl(req.Headers["cache-control"])
+	_, noCache := directives["no-cache"]
+	return noCache || directives["max-age"] == "0" ||
+		strings.EqualFold(strings.TrimSpace(req.Headers["pragma"]), "no-cache")
+}
+
+// cacheEntry is a response stored in the proxy cache. Entries are never
+// modified once stored; revalidation replaces them.
+type cacheEntry struct {
+	key string
+	// vary holds the request header values the response was selected by
+	vary map[string]string
+	res  *Response
+	// stored is when the response was received or last revalidated
+	stored     time.Time
+	freshUntil time.Time
+	size       int64
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.freshUntil)
+}
+
+// response returns the cached response as the response to req, with the
+// "Age" of the copy.
+func (e *cacheEntry) response(req *Request, now time.Time) *Response {
+	res := relayResponse(req, e.res)
+	res.Headers["Age"] = strconv.FormatInt(int64(now.Sub(e.stored)/time.Second), 10)
+	return res
+}
+
+// addValidators turns upstream into a conditional request for the cached
+// response.
+func (e *cacheEntry) addValidators(upstream *Request) {
+	delete(upstream.Headers, "if-none-match")
+	delete(upstream.Headers, "if-modified-since")
+	if etag, ok := e.res.Headers["Etag"]; ok {
+		upstream.Headers["if-none-match"] = etag
+	}
+	if lastModified, ok := e.res.Headers["Last-Modified"]; ok {
+		upstream.Headers["if-modified-since"] = lastModified
+	}
+}
+
+// matches reports whether the cached response was selected by the same
+// values of the Vary headers as req has.
+func (e *cacheEntry) matches(req *Request) bool {
+	for k, v := range e.vary {
+		if req.Headers[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// freshness returns how long res may be served from the cache without
+// revalidation, and whether it may be stored at all.
+func freshness(res *Response) (time.Duration, bool) {
+	directives := cacheControl(res.Headers["Cache-Control"])
+	for _, d := range []string{"no-store", "private"} {
+		if _, ok := directives[d]; ok {
+			return 0, false
+		}
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[d]; ok {
+			seconds, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if expires, ok := res.Headers["Expires"]; ok {
+		at, err := ParseTime(expires)
+		if err != nil || res.Date.IsZero() || !at.After(res.Date) {
+			return 0, true
+		}
+		return at.Sub(res.Date), true
+	}
+	return 0, true
+}
+
+// proxyCache is an LRU cache of upstream responses, bounded by the total
+// size of their bodies.
+type proxyCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *cacheEntry, most recently used first
+	size    int64
+}
+
+// get returns the cached response for key that matches req, or nil.
+func (c *proxyCache) get(key string, req *Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.matches(req) {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry
+}
+
+// store caches res, the response to req, under key if it is a 200 response
+// that may be stored and fits in maxObject bytes, evicting the least
+// recently used responses beyond maxTotal bytes.
+func (c *proxyCache) store(key string, req *Request, res *Response, now time.Time, maxObject, maxTotal int64) {
+	if res.StatusCode != statusOK || len(res.Cookies) > 0 || res.ContentLength > maxObject || res.ContentLength > maxTotal {
+		return
+	}
+	lifetime, ok := freshness(res)
+	if !ok {
+		return
+	}
+	_, hasETag := res.Headers["Etag"]
+	_, hasLastModified := res.Headers["Last-Modified"]
+	if lifetime == 0 && !hasETag && !hasLastModified {
+		// it could never be served without fetching it again
+		return
+	}
+	entry := &cacheEntry{key: key, vary: make(map[string]string), res: res, stored: now, freshUntil: now.Add(lifetime), size: res.ContentLength}
+	for _, k := range strings.Split(res.Headers["Vary"], ",") {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "*" {
+			return
+		}
+		if k != "" {
+			entry.vary[k] = req.Headers[k]
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(entry, maxTotal)
+}
+
+// revalidated records that the upstream server confirmed entry with the
+// 304 response notModified, and returns the refreshed entry.
+func (c *proxyCache) revalidated(entry *cacheEntry, notModified *Response, now time.Time) *cacheEntry {
+	res := *entry.res
+	res.Headers = make(map[string]string, len(entry.res.Headers))
+	for k, v := range entry.res.Headers {
+		res.Headers[k] = v
+	}
+	// a 304 carries the headers that changed, e.g. a new Cache-Control
+	for _, k := range []string{"Cache-Control", "Date", "Etag", "Expires"} {
+		if v, ok := notModified.Headers[k]; ok {
+			res.Headers[k] = v
+		}
+	}
+	res.Date = notModified.Date
+	lifetime, _ := freshness(&res)
+	refreshed := *entry
+	refreshed.res, refreshed.stored, refreshed.freshUntil = &res, now, now.Add(lifetime)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.key]; ok && el.Value == entry {
+		c.put(&refreshed, c.size)
+	}
+	return &refreshed
+}
+
+// put inserts entry, replacing any entry with the same key, and evicts
+// entries until the cache holds at most maxTotal bytes. c.mu must be held.
+func (c *proxyCache) put(entry *cacheEntry, maxTotal int64) {
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if el, ok := c.entries[entry.key]; ok {
+		c.remove(el)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += entry.size
+	for c.size > maxTotal {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *proxyCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
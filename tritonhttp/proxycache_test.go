@@ -0,0 +1,128 @@
+package tritonhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReverseProxyCache(t *testing.T) {
+	var fetches, revalidations atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidations.Add(1)
+				// written raw, as net/http drops the Content-Length of a
+				// 304: it is the length of the stored response, not of
+				// a body to read
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = io.WriteString(conn, "HTTP/1.1 304 Not Modified\r\nCache-Control: max-age=60\r\nETag: \"v1\"\r\nContent-Length: 5\r\n\r\n")
+				return
+			}
+			_, _ = io.WriteString(w, "fresh")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = io.WriteString(w, "no-store")
+		case "/big":
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, strings.Repeat("a", 100))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			_, _ = io.WriteString(w, r.Header.Get("Accept-Language"))
+		}
+	}))
+	defer upstream.Close()
+
+	now := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	s := newTestServer()
+	s.Now = func() time.Time { return now }
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"proxied": {Upstreams: []string{strings.TrimPrefix(upstream.URL, "http://")}},
+	}
+	s.ProxyCacheBytes = 1 << 10
+	s.MaxProxyCacheObject = 50
+
+	steps := []struct {
+		name    string
+		url     string
+		headers string
+		advance time.Duration
+		body    string
+		fetches int32
+		cached  bool
+	}{
+		{"miss", "/fresh", "", 0, "fresh", 1, false},
+		{"hit", "/fresh", "", 10 * time.Second, "fresh", 1, true},
+		{"client revalidates", "/fresh", "Cache-Control: no-cache\r\n", 0, "fresh", 2, true},
+		{"stale", "/fresh", "", time.Minute, "fresh", 3, true},
+		{"revalidated", "/fresh", "", 0, "fresh", 3, true},
+		{"no-store", "/no-store", "", 0, "no-store", 4, false},
+		{"no-store again", "/no-store", "", 0, "no-store", 5, false},
+		{"too large", "/big", "", 0, strings.Repeat("a", 100), 6, false},
+		{"too large again", "/big", "", 0, strings.Repeat("a", 100), 7, false},
+		{"variant", "/vary", "Accept-Language: fr\r\n", 0, "fr", 8, false},
+		{"same variant", "/vary", "Accept-Language: fr\r\n", 0, "fr", 8, true},
+		{"other variant", "/vary", "Accept-Language: de\r\n", 0, "de", 9, false},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		// the frozen clock would expire the deadlines of a real connection
+		conn := &scriptedConn{r: strings.NewReader("GET " + step.url + " HTTP/1.1\r\nHost: proxied\r\n" + step.headers + "Connection: close\r\n\r\n")}
+		s.HandleConnection(conn)
+		resp := parseResponse(t, conn.out.String())
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%v: error reading response body: %v\n", step.name, err.Error())
+		}
+		if resp.StatusCode != 200 || string(body) != step.body {
+			t.Fatalf("%v: expected 200 %q but got %v %q\n", step.name, step.body, resp.StatusCode, body)
+		}
+		if got := fetches.Load(); got != step.fetches {
+			t.Fatalf("%v: expected %v upstream requests but got %v\n", step.name, step.fetches, got)
+		}
+		if cached := resp.Header.Get("Age") != ""; cached != step.cached {
+			t.Fatalf("%v: expected cached %v but got Age %q\n", step.name, step.cached, resp.Header.Get("Age"))
+		}
+	}
+	if got := revalidations.Load(); got != 2 {
+		t.Fatalf("Expected 2 revalidations but got %v\n", got)
+	}
+}
+
+func TestReverseProxyBalancing(t *testing.T) {
+	var addrs []string
+	for _, name := range []string{"a", "b"} {
+		name := name
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+r.URL.Path)
+		}))
+		defer upstream.Close()
+		addrs = append(addrs, strings.TrimPrefix(upstream.URL, "http://"))
+	}
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{"proxied": {Upstreams: addrs}}
+
+	for _, want := range []string{"a/x", "b/x", "a/x"} {
+		resp := parseResponse(t, serveRaw(t, s, "GET /x HTTP/1.1\r\nHost: proxied\r\nConnection: close\r\n\r\n"))
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Error reading response body: %v\n", err.Error())
+		}
+		if string(body) != want {
+			t.Fatalf("Expected %q but got %q\n", want, body)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package tritonhttp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentConnections hammers a server with many concurrent keep-alive
+// connections while its virtual hosts are swapped. Run with -race.
+func TestConcurrentConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ln.Close()
+	s := newTestServer()
+	go s.Serve(ln)
+
+	stop := make(chan struct{})
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				s.SetVirtualHosts(map[string]string{
+					"website1":                  "../docroot_dirs/htdocs1",
+					fmt.Sprintf("website%d", i): "../docroot_dirs/htdocs2",
+				})
+			}
+		}
+	}()
+
+	const clients, requests = 32, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := &Client{Addr: ln.Addr().String()}
+			defer c.Close()
+			for j := 0; j < requests; j++ {
+				res, err := c.Do(NewRequest("website1", "/"))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if res.StatusCode != 200 {
+					errs <- fmt.Errorf("expected 200 but got %v", res.StatusCode)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-reloaded
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Request failed: %v\n", err)
+	}
+}
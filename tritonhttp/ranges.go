@@ -0,0 +1,247 @@
+package tritonhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const RANGE = "range"
+
+// AllRangeTypes matches every type in Server.RangeTypes.
+const AllRangeTypes = "*/*"
+
+// DefaultRangeTypes are the types served in byte ranges when
+// Server.RangeTypes is not set: all of them, as media players seek by
+// requesting ranges and download managers resume with them.
+var DefaultRangeTypes = []string{AllRangeTypes}
+
+// mediaTypes are registered for their extension when the system MIME table
+// does not know them, since Go's built-in table has no media types.
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+}
+
+func init() {
+	for ext, typ := range mediaTypes {
+		if mime.TypeByExtension(ext) == "" {
+			_ = mime.AddExtensionType(ext, typ)
+		}
+	}
+}
+
+// acceptsRanges reports whether res, a 200 response for a file, may be
+// served in byte ranges.
+func (s *Server) acceptsRanges(res *Response) bool {
+	if res.FilePath == "" {
+		return false
+	}
+	if res.encodeIn != "" {
+		// ranges would be of the compressed body, built anew for every
+		// response
+		return false
+	}
+	types := s.RangeTypes
+	if types == nil {
+		types = DefaultRangeTypes
+	}
+	contentType := res.Headers["Content-Type"]
+	for _, t := range types {
+		if mediaTypeMatches(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// byteRange is the range of length bytes starting at start.
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// maxRanges caps the ranges of a multi-range request; a request for more
+// is answered with the whole file, rather than in a flood of tiny parts.
+const maxRanges = 16
+
+// parseRanges parses the ranges of the "Range" header spec against a
+// representation of size bytes (RFC 9110 section 14.1.2), leaving out
+// those that select no byte. ok is false when the header is malformed, in
+// which case it is ignored; it is also ignored when it asks for more than
+// maxRanges ranges, or for more bytes than the representation holds, as
+// overlapping ranges would. A valid header whose ranges all select no byte
+// is reported as unsatisfiable.
+func parseRanges(spec string, size int64) (ranges []byteRange, unsatisfiable bool, ok bool) {
+	const unit = "bytes="
+	if !strings.HasPrefix(spec, unit) {
+		return nil, false, false
+	}
+	elements := strings.Split(spec[len(unit):], ",")
+	if len(elements) > maxRanges {
+		return nil, false, false
+	}
+	var total int64
+	for _, element := range elements {
+		r, unsatisfiable, ok := parseRange(element, size)
+		if !ok {
+			return nil, false, false
+		}
+		if !unsatisfiable {
+			ranges = append(ranges, r)
+			total += r.length
+		}
+	}
+	if total > size {
+		return nil, false, false
+	}
+	return ranges, len(ranges) == 0, true
+}
+
+// parseRange parses one range of a "Range" header, "first-last", "first-"
+// or "-suffix". A syntactically valid range that selects no byte is
+// reported as unsatisfiable.
+func parseRange(spec string, size int64) (r byteRange, unsatisfiable bool, ok bool) {
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, false
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	if first == "" {
+		// suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false, false
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, true, true
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{start: size - n, length: n}, false, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return byteRange{}, false, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return byteRange{}, true, true
+	}
+	return byteRange{start: start, length: end - start + 1}, false, true
+}
+
+// handleRange narrows the 200 response res down to the byte ranges
+// requested by the "Range" header spec: a single range is sent as is, with
+// its Content-Range, several as the parts of a multipart/byteranges body.
+func (s *Server) handleRange(res *Response, spec string) *Response {
+	size := res.ContentLength
+	ranges, unsatisfiable, ok := parseRanges(spec, size)
+	switch {
+	case !ok:
+		return res
+	case unsatisfiable:
+		failed := s.newResponse(statusRangeNotSatisfiable, responseOptions{req: res.Request, detail: "no byte of the file satisfies " + spec})
+		failed.Headers["Content-Range"] = "bytes */" + strconv.FormatInt(size, 10)
+		return failed
+	}
+	res.StatusCode = statusPartialContent
+	res.StatusText = statusText[statusPartialContent]
+	if len(ranges) > 1 {
+		setByteRanges(res, ranges)
+		return res
+	}
+	r := ranges[0]
+	res.Headers["Content-Range"] = r.contentRange(size)
+	res.Offset = r.start
+	res.ContentLength = r.length
+	return res
+}
+
+// rangePart is a part of a multipart/byteranges body: its delimiter and
+// headers, followed by the bytes of the range.
+type rangePart struct {
+	header string
+	byteRange
+}
+
+// setByteRanges makes the body of res, a response for a file, the
+// multipart/byteranges of the given ranges of the file (RFC 9110 section
+// 14.6). Each part carries the Content-Type of the file and its own
+// Content-Range.
+func setByteRanges(res *Response, ranges []byteRange) {
+	size := res.ContentLength
+	contentType := res.Headers["Content-Type"]
+	boundary := randomBoundary()
+	res.parts = nil
+	res.ContentLength = 0
+	for i, r := range ranges {
+		header := "--" + boundary + "\r\n"
+		if i > 0 {
+			header = "\r\n" + header
+		}
+		if contentType != "" {
+			header += "Content-Type: " + contentType + "\r\n"
+		}
+		header += "Content-Range: " + r.contentRange(size) + "\r\n\r\n"
+		res.parts = append(res.parts, rangePart{header: header, byteRange: r})
+		res.ContentLength += int64(len(header)) + r.length
+	}
+	closing := "\r\n--" + boundary + "--\r\n"
+	res.parts = append(res.parts, rangePart{header: closing})
+	res.ContentLength += int64(len(closing))
+	res.Headers["Content-Type"] = "multipart/byteranges; boundary=" + boundary
+}
+
+// randomBoundary returns a multipart boundary that is unlikely to occur in
+// the parts.
+func randomBoundary() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// writeParts writes the multipart/byteranges body made of parts of f.
+func writeParts(w io.Writer, f *os.File, parts []rangePart) error {
+	for _, part := range parts {
+		if _, err := io.WriteString(w, part.header); err != nil {
+			return err
+		}
+		if part.length == 0 {
+			continue
+		}
+		if _, err := f.Seek(part.start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, f, part.length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		spec          string
+		ranges        []byteRange
+		unsatisfiable bool
+		ok            bool
+	}{
+		{"bytes=0-4", []byteRange{{0, 5}}, false, true},
+		{"bytes=5-", []byteRange{{5, 5}}, false, true},
+		{"bytes=-3", []byteRange{{7, 3}}, false, true},
+		{"bytes=-30", []byteRange{{0, 10}}, false, true},
+		{"bytes=8-100", []byteRange{{8, 2}}, false, true},
+		{"bytes=10-", nil, true, true},
+		{"bytes=-0", nil, true, true},
+		{"bytes=4-2", nil, false, false},
+		{"bytes=0-1,4-5", []byteRange{{0, 2}, {4, 2}}, false, true},
+		{"bytes=0-1, 20-30, -2", []byteRange{{0, 2}, {8, 2}}, false, true},
+		{"bytes=20-, 30-", nil, true, true},
+		{"bytes=0-1,4-", []byteRange{{0, 2}, {4, 6}}, false, true},
+		{"bytes=0-,0-", nil, false, false},
+		{"bytes=0-1,x", nil, false, false},
+		{"bytes=" + strings.Repeat("0-0,", maxRanges) + "0-0", nil, false, false},
+		{"items=0-1", nil, false, false},
+		{"bytes=a-b", nil, false, false},
+	}
+	for _, tt := range tests {
+		ranges, unsatisfiable, ok := parseRanges(tt.spec, 10)
+		if !reflect.DeepEqual(ranges, tt.ranges) || unsatisfiable != tt.unsatisfiable || ok != tt.ok {
+			t.Fatalf("parseRanges(%q) = %v, %v, %v; want %v, %v, %v\n", tt.spec, ranges, unsatisfiable, ok, tt.ranges, tt.unsatisfiable, tt.ok)
+		}
+	}
+}
+
+func TestMediaRanges(t *testing.T) {
+	docroot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(docroot, "clip.mp4"), []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(docroot, "page.html"), []byte("<p>hi</p>"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"media": docroot}, RangeTypes: []string{"video/", "audio/"}}
+
+	tests := []struct {
+		name         string
+		url          string
+		rangeHeader  string
+		code         int
+		body         string
+		contentRange string
+	}{
+		{"full file", "/clip.mp4", "", 200, "0123456789", ""},
+		{"first bytes", "/clip.mp4", "bytes=0-3", 206, "0123", "bytes 0-3/10"},
+		{"seek", "/clip.mp4", "bytes=6-", 206, "6789", "bytes 6-9/10"},
+		{"past the end", "/clip.mp4", "bytes=20-", 416, "", "bytes */10"},
+		{"not media", "/page.html", "bytes=0-1", 200, "<p>hi</p>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "GET " + tt.url + " HTTP/1.1\r\nHost: media\r\nConnection: close\r\n"
+			if tt.rangeHeader != "" {
+				raw += "Range: " + tt.rangeHeader + "\r\n"
+			}
+			resp := parseResponse(t, serveRaw(t, s, raw+"\r\n"))
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Error reading body: %v\n", err.Error())
+			}
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+				t.Fatalf("Expected Content-Range %q but got %q\n", tt.contentRange, got)
+			}
+			if tt.code != 416 && string(body) != tt.body {
+				t.Fatalf("Expected body %q but got %q\n", tt.body, body)
+			}
+			media := strings.HasSuffix(tt.url, ".mp4")
+			if advertised := resp.Header.Get("Accept-Ranges") == "bytes"; advertised != (media && tt.code != 416) {
+				t.Fatalf("Unexpected Accept-Ranges %q\n", resp.Header.Get("Accept-Ranges"))
+			}
+		})
+	}
+}
+
+func TestDefaultRangeTypes(t *testing.T) {
+	docroot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(docroot, "archive.zip"), []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"downloads": docroot}}
+
+	// a download resumes after the bytes it already has
+	resp := parseResponse(t, serveRaw(t, s, "GET /archive.zip HTTP/1.1\r\nHost: downloads\r\nRange: bytes=4-\r\nConnection: close\r\n\r\n"))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 206 || string(body) != "456789" || resp.Header.Get("Content-Range") != "bytes 4-9/10" {
+		t.Fatalf("Expected bytes 4-9 of the file but got: %v %q %q\n", resp.StatusCode, resp.Header.Get("Content-Range"), body)
+	}
+
+	s = &Server{DocRoot: docroot, VirtualHosts: map[string]string{"downloads": docroot}, RangeTypes: []string{}}
+	resp = parseResponse(t, serveRaw(t, s, "GET /archive.zip HTTP/1.1\r\nHost: downloads\r\nRange: bytes=4-\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 200 || resp.Header.Get("Accept-Ranges") != "" {
+		t.Fatalf("Expected the whole file without ranges but got: %v\n", resp.StatusCode)
+	}
+}
+
+func TestMultipleRanges(t *testing.T) {
+	docroot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(docroot, "clip.mp4"), []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"media": docroot}}
+
+	resp := parseResponse(t, serveRaw(t, s, "GET /clip.mp4 HTTP/1.1\r\nHost: media\r\nRange: bytes=0-1, 6-\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 206 || resp.Header.Get("Content-Range") != "" {
+		t.Fatalf("Expected a 206 without Content-Range but got: %v %q\n", resp.StatusCode, resp.Header.Get("Content-Range"))
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected a multipart/byteranges body but got: %q\n", resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || int64(len(body)) != resp.ContentLength {
+		t.Fatalf("Expected a body of Content-Length %v but got %v bytes: %v\n", resp.ContentLength, len(body), err)
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	want := []struct{ contentRange, data string }{
+		{"bytes 0-1/10", "01"},
+		{"bytes 6-9/10", "6789"},
+	}
+	for _, w := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("Error reading part: %v\n", err.Error())
+		}
+		data, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Range") != w.contentRange || part.Header.Get("Content-Type") != "video/mp4" || string(data) != w.data {
+			t.Fatalf("Expected part %v %q but got: %v %q\n", w.contentRange, w.data, part.Header, data)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("Expected no more parts but got: %v\n", err)
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	docroot := t.TempDir()
+	path := filepath.Join(docroot, "archive.zip")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v\n", err.Error())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error stating file: %v\n", err.Error())
+	}
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"downloads": docroot}}
+	etag := fileETag(info)
+
+	tests := []struct {
+		name    string
+		ifRange string
+		code    int
+	}{
+		{"current tag", etag, 206},
+		{"other tag", `"other"`, 200},
+		{"weak tag", "W/" + etag, 200},
+		{"last modified", FormatTime(info.ModTime()), 206},
+		{"other date", FormatTime(info.ModTime().Add(-time.Hour)), 200},
+		{"invalid", "yesterday", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, s, "GET /archive.zip HTTP/1.1\r\nHost: downloads\r\nRange: bytes=4-\r\n"+
+				"If-Range: "+tt.ifRange+"\r\nConnection: close\r\n\r\n"))
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.code == 200 && string(body) != "0123456789" {
+				t.Fatalf("Expected the whole file but got: %q\n", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package tritonhttp
+
+import (
+	"html/template"
+	"log"
+	"strings"
+)
+
+// redirectPage is the body of redirects, for clients that don't follow
+// them by themselves.
+var redirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.StatusCode}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.StatusCode}} {{.StatusText}}</h1>
+<p>The document has moved <a href="{{.Location}}">here</a>.</p>
+</body>
+</html>
+`))
+
+// Redirect prepares res to send the client to location, which may be
+// relative to the request URL. code is one of 301, 302, 303, 307 or 308;
+// any other code is replaced by 302. Use 307 or 308 when the client must
+// repeat a POST rather than switch to GET.
+func (res *Response) Redirect(code int, location string) {
+	if code < 300 || code > 399 {
+		code = statusFound
+	}
+	res.init()
+	res.StatusCode = code
+	res.StatusText = statusText[code]
+	// a line break would end the header early
+	location = strings.NewReplacer("\r", "", "\n", "").Replace(location)
+	res.Headers["Location"] = location
+
+	data := struct {
+		StatusCode int
+		StatusText string
+		Location   string
+	}{res.StatusCode, res.StatusText, location}
+	if err := res.RenderTemplate(redirectPage, data); err != nil {
+		log.Printf("Failed to render redirect page: %v", err)
+	}
+}
+
+// RedirectHandler returns a HandlerFunc redirecting every request it gets
+// to location with the given code, e.g.
+//
+//	s.HandleFunc("/old.html", RedirectHandler(301, "/new.html"))
+func RedirectHandler(code int, location string) HandlerFunc {
+	return func(req *Request) *Response {
+		res := &Response{}
+		res.Redirect(code, location)
+		return res
+	}
+}
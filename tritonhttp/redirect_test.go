@@ -0,0 +1,44 @@
+package tritonhttp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	s := newTestServer()
+	s.HandleFunc("/old.html", RedirectHandler(301, "/index.html"))
+	s.HandleFunc("/login", func(req *Request) *Response {
+		res := &Response{}
+		res.Redirect(303, "/welcome?user=<b>")
+		return res
+	})
+	s.HandleFunc("/bogus", RedirectHandler(200, "/index.html"))
+
+	tests := []struct {
+		raw      string
+		code     int
+		location string
+	}{
+		{"GET /old.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", 301, "/index.html"},
+		{"POST /login HTTP/1.1\r\nHost: website1\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", 303, "/welcome?user=<b>"},
+		{"GET /bogus HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n", 302, "/index.html"},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveRaw(t, s, tt.raw))
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Error reading response body: %v\n", err.Error())
+		}
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); loc != tt.location {
+			t.Fatalf("Expected Location %q but got %q\n", tt.location, loc)
+		}
+		if int64(len(body)) != resp.ContentLength || strings.Contains(string(body), "<b>") {
+			t.Fatalf("Unexpected redirect page: %q\n", body)
+		}
+	}
+}
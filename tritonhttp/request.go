@@ -1,6 +1,16 @@
 package tritonhttp
 
-import "encoding/json"
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
 
 type Request struct {
 	Method string // e.g. "GET"
@@ -12,6 +22,83 @@ type Request struct {
 
 	Host  string // determine from the "Host" header
 	Close bool   // determine from the "Connection" header
+
+	// ConnectionTokens holds the lower-cased options listed in the
+	// "Connection" header, e.g. ["keep-alive", "upgrade"]
+	ConnectionTokens []string
+
+	// Cookies holds the well-formed cookies of the "Cookie" header
+	Cookies []*Cookie
+
+	// varied lists the headers read through VaryOn
+	varied []string
+
+	// Body reads the request body, delimited by the "Content-Length"
+	// header, or decoded from "Transfer-Encoding: chunked". It is empty,
+	// never nil, for requests without a body. The
+	// body is streamed from the connection as it is read, never buffered
+	// as a whole, so handlers can process or pipe large uploads; a body
+	// the client cut short fails with io.ErrUnexpectedEOF. Whatever the
+	// handler leaves unread is discarded before the next request.
+	Body io.Reader
+	// ContentLength is the length of Body in bytes, -1 for a chunked
+	// body, or one of unknown length over HTTP/2 and HTTP/3
+	ContentLength int64
+	// Trailers holds the trailer fields sent after a chunked body, with
+	// lower-cased keys. It is nil for other requests, and only filled once
+	// Body was read to io.EOF.
+	Trailers map[string]string
+
+	// RemoteAddr and LocalAddr are the addresses of the client and of the
+	// server end of the connection the request arrived on, "ip:port"
+	RemoteAddr string
+	LocalAddr  string
+	// ConnID identifies the connection the request arrived on: requests
+	// on one connection share it, and no two connections of a Server
+	// have the same. IDs start at 1.
+	ConnID uint64
+
+	// TLS describes the TLS connection the request arrived on: the
+	// negotiated version and cipher suite, the server name the client
+	// asked for (SNI) and the client certificates. It is nil for requests
+	// over plain TCP.
+	TLS *tls.ConnectionState
+
+	// conn is the HTTP/1.1 connection the request arrived on, nil for
+	// other transports; see LongPoll
+	conn net.Conn
+	// longPolled is set once LongPoll extended the deadlines of conn
+	longPolled bool
+	// absoluteURL is the request target as sent, when it was in
+	// absolute-form; URL then only holds its path and query
+	absoluteURL string
+	// httpsRedirect is the listener of ListenAndRedirectHTTPS the request
+	// arrived on, if any
+	httpsRedirect *httpsRedirectListener
+}
+
+// ClientCertificate returns the certificate the client authenticated with,
+// or nil if the request did not arrive over TLS or the client sent no
+// certificate that verified against the configured client CAs.
+func (req *Request) ClientCertificate() *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// hopByHopHeaders are only meaningful for a single transport-level
+// connection and must not be forwarded (RFC 7230 section 6.1).
+var hopByHopHeaders = []string{
+	CONNECTION,
+	"keep-alive",
+	"proxy-authenticate",
+	"proxy-authorization",
+	"proxy-connection",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
 }
 
 func (req *Request) init() {
@@ -19,28 +106,168 @@ func (req *Request) init() {
 	req.Close = false
 }
 
-func (req *Request) processHeader() (err error) {
-	if req.URL[0] != '/' {
-		return invalidHeaderError("InvalidHeader: Request URL should start with `/`, but URL is ", req.URL)
+// addHeader records a header field, combining repeated fields into a single
+// comma-separated value as described in RFC 7230 section 3.2.2. Cookie lines
+// are joined with "; " instead, per RFC 6265 section 5.4.
+func (req *Request) addHeader(key, value string) {
+	prev, ok := req.Headers[key]
+	switch {
+	case !ok:
+		req.Headers[key] = value
+	case key == COOKIE:
+		req.Headers[key] = prev + "; " + value
+	default:
+		req.Headers[key] = prev + ", " + value
 	}
+}
+
+func (req *Request) processHeader() (err error) {
 	_, ok := req.Headers[HOST]
 	if !ok {
 		b, err := json.Marshal(req.Headers)
 		if err != nil {
-			return invalidHeaderError("InvalidHeader: Does contain `host` field & header cannot be converted to JSON", "")
+			return badRequest(classMissingHost, invalidHeaderError("InvalidHeader: Does contain `host` field & header cannot be converted to JSON", ""))
 		}
-		return invalidHeaderError("InvalidHeader: Does not contain `host` field", string(b))
+		return badRequest(classMissingHost, invalidHeaderError("InvalidHeader: Does not contain `host` field", string(b)))
+	}
+	if _, _, ok := splitHost(req.Headers[HOST]); !ok {
+		return badRequest(classHeader, invalidHeaderError("InvalidHeader: malformed `host` field", req.Headers[HOST]))
 	}
-	req.Host = req.Headers[HOST]
-	_, ok = req.Headers[CONNECTION]
-	if ok {
-		val := req.Headers[CONNECTION]
-		if val == "close" {
-			req.Close = true
-		} else {
-			return invalidHeaderError("InvalidHeader: `Connection` key in Header has invalid value. Allowed: close, actual: ", req.Headers[CONNECTION])
+	// Host names are case-insensitive and may be internationalized, so
+	// they are looked up in normalized form
+	req.Host = normalizeHost(req.Headers[HOST])
+	if req.Method == methodConnect {
+		// the target of CONNECT is in authority-form, "host:port"
+		if _, port, err := net.SplitHostPort(req.URL); err != nil || port == "" {
+			return badRequest(classRequestLine, invalidHeaderError("InvalidHeader: CONNECT target should be `host:port`, but is ", req.URL))
 		}
+	} else if isAbsoluteForm(req.URL) {
+		u, err := url.Parse(req.URL)
+		if err != nil || u.Host == "" {
+			return badRequest(classRequestLine, invalidHeaderError("InvalidHeader: malformed absolute-form request target", req.URL))
+		}
+		if normalizeHost(u.Host) != req.Host {
+			return badRequest(classHeader, invalidHeaderError("InvalidHeader: `host` field conflicts with the request target", req.URL))
+		}
+		req.absoluteURL = req.URL
+		req.URL = u.RequestURI()
+	}
+	if req.Method != methodConnect && (req.URL == "" || req.URL[0] != '/') {
+		return badRequest(classRequestLine, invalidHeaderError("InvalidHeader: Request URL should start with `/`, but URL is ", req.URL))
+	}
+	req.Cookies = parseCookies(req.Headers[COOKIE])
+	req.ConnectionTokens = parseTokenList(req.Headers[CONNECTION])
+	if containsToken(req.ConnectionTokens, "close") {
+		req.Close = true
 	}
 
 	return nil
 }
+
+// VaryOn returns the value of the request header key, like Headers, and
+// records that the response depends on it: every response to req then
+// lists key in its "Vary" header. Content negotiation, e.g. on
+// Accept-Encoding, Accept-Language or Origin, should read headers this way.
+func (req *Request) VaryOn(key string) string {
+	key = strings.ToLower(key)
+	if !containsFold(req.varied, key) {
+		req.varied = append(req.varied, key)
+	}
+	return req.Headers[key]
+}
+
+// removeHopByHopHeaders deletes the hop-by-hop headers from req, including
+// any header named by the "Connection" header. It must be called before a
+// request is forwarded to another server.
+func (req *Request) removeHopByHopHeaders() {
+	for _, token := range req.ConnectionTokens {
+		delete(req.Headers, token)
+	}
+	for _, key := range hopByHopHeaders {
+		delete(req.Headers, key)
+	}
+}
+
+// isAbsoluteForm reports whether target is an absolute-form request target
+// such as "http://www.example.org/index.html".
+func isAbsoluteForm(target string) bool {
+	lower := strings.ToLower(target)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Write serializes req to w as an HTTP/1.1 request: the request line, the
+// Host and Connection headers derived from req.Host and req.Close, then the
+// remaining headers in canonical form. A body of unknown length, with a
+// negative ContentLength, is sent chunked, followed by req.Trailers.
+// ReadRequest parses the output back into an equivalent Request.
+func (req *Request) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	proto := req.Proto
+	if proto == "" {
+		proto = responseProto
+	}
+	if _, err := bw.WriteString(req.Method + " " + req.URL + " " + proto + "\r\n"); err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(req.Headers)+2)
+	for k, v := range req.Headers {
+		headers[CanonicalHeaderKey(k)] = v
+	}
+	if req.Host != "" {
+		headers["Host"] = req.Host
+	}
+	tokens := req.ConnectionTokens
+	if req.Close && !containsToken(tokens, "close") {
+		tokens = append(tokens[:len(tokens):len(tokens)], "close")
+	}
+	if len(tokens) > 0 {
+		headers["Connection"] = strings.Join(tokens, ", ")
+	}
+	chunked := req.Body != nil && req.ContentLength < 0
+	if chunked {
+		delete(headers, "Content-Length")
+		headers["Transfer-Encoding"] = "chunked"
+	}
+	for _, k := range sortedHeaderKeys(headers) {
+		if _, err := bw.WriteString(k + ": " + headers[k] + "\r\n"); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString("\r\n"); err != nil {
+		return err
+	}
+	switch {
+	case chunked:
+		if err := writeChunked(bw, req.Body, req.Trailers); err != nil {
+			return err
+		}
+	case req.Body != nil:
+		if _, err := io.Copy(bw, req.Body); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeChunked writes body to w in chunked transfer coding, then the
+// trailer fields.
+func writeChunked(w io.Writer, body io.Reader, trailers map[string]string) error {
+	cw := httputil.NewChunkedWriter(w)
+	if _, err := io.Copy(cw, body); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	canonical := make(map[string]string, len(trailers))
+	for k, v := range trailers {
+		canonical[CanonicalHeaderKey(k)] = v
+	}
+	for _, k := range sortedHeaderKeys(canonical) {
+		if _, err := io.WriteString(w, k+": "+canonical[k]+"\r\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
@@ -0,0 +1,288 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readRequestString(raw string) (*Request, error) {
+	req, _, err := ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	return req, err
+}
+
+func TestReadRequestHeaderValueWhitespace(t *testing.T) {
+	req, err := readRequestString("GET / HTTP/1.1\r\n" +
+		"Host: website1\r\n" +
+		"User-Agent: Mozilla/5.0 (X11; Linux)\r\n" +
+		"Accept:\ttext/html, application/json \r\n" +
+		"\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if got := req.Headers["user-agent"]; got != "Mozilla/5.0 (X11; Linux)" {
+		t.Fatalf("Unexpected User-Agent %q\n", got)
+	}
+	if got := req.Headers["accept"]; got != "text/html, application/json" {
+		t.Fatalf("Unexpected Accept %q\n", got)
+	}
+}
+
+func TestReadRequestHeaderKeyWhitespace(t *testing.T) {
+	for _, line := range []string{"Host : website1", " Host: website1", "Ho st: website1", ": website1"} {
+		_, err := readRequestString("GET / HTTP/1.1\r\n" + line + "\r\n\r\n")
+		if err == nil {
+			t.Fatalf("Expected an error for header line %q\n", line)
+		}
+	}
+}
+
+func TestReadRequestRepeatedHeaders(t *testing.T) {
+	req, err := readRequestString("GET / HTTP/1.1\r\n" +
+		"Host: website1\r\n" +
+		"Accept: text/html\r\n" +
+		"Cookie: a=1\r\n" +
+		"Accept: application/json\r\n" +
+		"Cookie: b=2\r\n" +
+		"\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if got := req.Headers["accept"]; got != "text/html, application/json" {
+		t.Fatalf("Unexpected Accept %q\n", got)
+	}
+	if got := req.Headers["cookie"]; got != "a=1; b=2" {
+		t.Fatalf("Unexpected Cookie %q\n", got)
+	}
+}
+
+func TestReadRequestPreservesValueCase(t *testing.T) {
+	req, err := readRequestString("GET / HTTP/1.1\r\n" +
+		"Host: WebSite1\r\n" +
+		"Connection: Close\r\n" +
+		"Authorization: Bearer AbC+dEf==\r\n" +
+		"\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if got := req.Headers["authorization"]; got != "Bearer AbC+dEf==" {
+		t.Fatalf("Unexpected Authorization %q\n", got)
+	}
+	if err := req.processHeader(); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if req.Host != "website1" || !req.Close {
+		t.Fatalf("Unexpected Host %q / Close %v\n", req.Host, req.Close)
+	}
+}
+
+func TestConnectionTokenList(t *testing.T) {
+	req, err := readRequestString("GET / HTTP/1.1\r\n" +
+		"Host: website1\r\n" +
+		"Connection: keep-alive, Upgrade, X-Trace\r\n" +
+		"Upgrade: websocket\r\n" +
+		"X-Trace: 1\r\n" +
+		"Accept: */*\r\n" +
+		"\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if err := req.processHeader(); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err.Error())
+	}
+	if req.Close {
+		t.Fatal("Request should not be marked as Close")
+	}
+
+	req.removeHopByHopHeaders()
+	for _, key := range []string{"connection", "upgrade", "x-trace"} {
+		if _, ok := req.Headers[key]; ok {
+			t.Fatalf("Hop-by-hop header %q was not removed\n", key)
+		}
+	}
+	if _, ok := req.Headers["accept"]; !ok {
+		t.Fatal("End-to-end header accept was removed")
+	}
+
+	req, _ = readRequestString("GET / HTTP/1.1\r\nHost: website1\r\nConnection: Upgrade, CLOSE\r\n\r\n")
+	if err := req.processHeader(); err != nil || !req.Close {
+		t.Fatalf("Expected a Close request, got %v (err %v)\n", req.Close, err)
+	}
+}
+
+func TestHostValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+		wantURL string
+	}{
+		{"single host", "GET /a.html HTTP/1.1\r\nHost: website1\r\n\r\n", false, "/a.html"},
+		{"duplicate host", "GET / HTTP/1.1\r\nHost: website1\r\nHost: website1\r\n\r\n", true, ""},
+		{"conflicting host", "GET / HTTP/1.1\r\nHost: website1\r\nhost: website2\r\n\r\n", true, ""},
+		{"absolute form", "GET http://website1/a.html HTTP/1.1\r\nHost: website1\r\n\r\n", false, "/a.html"},
+		{"absolute form conflict", "GET http://website2/a.html HTTP/1.1\r\nHost: website1\r\n\r\n", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := readRequestString(tt.raw)
+			if err == nil {
+				err = req.processHeader()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v but got %v\n", tt.wantErr, err)
+			}
+			if !tt.wantErr && req.URL != tt.wantURL {
+				t.Fatalf("Expected URL %q but got %q\n", tt.wantURL, req.URL)
+			}
+		})
+	}
+}
+
+// stalledReader returns data and then fails as if the read deadline expired.
+type stalledReader struct {
+	data string
+}
+
+func (r *stalledReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadRequestTimeout(t *testing.T) {
+	_, n, err := ReadRequest(bufio.NewReader(&stalledReader{"GET / HTTP/1.1\r\nHost: web"}))
+	if !errors.Is(err, ErrRequestTimeout) || n != 25 {
+		t.Fatalf("Expected ErrRequestTimeout after 25 bytes but got %v after %v\n", err, n)
+	}
+
+	_, _, err = ReadRequest(bufio.NewReader(&stalledReader{}))
+	if errors.Is(err, ErrRequestTimeout) || !isTimeout(err) {
+		t.Fatalf("Expected a plain timeout for an idle connection but got %v\n", err)
+	}
+}
+
+func TestReadLineLimit(t *testing.T) {
+	br := bufio.NewReaderSize(strings.NewReader("short\r\n"+strings.Repeat("x", 100)+"\r\n"), 16)
+	if line, err := readLineLimit(br, 64); err != nil || line != "short" {
+		t.Fatalf("Unexpected line %q (err %v)\n", line, err)
+	}
+	if _, err := readLineLimit(br, 64); !errors.Is(err, errLineTooLong) {
+		t.Fatalf("Expected errLineTooLong but got %v\n", err)
+	}
+
+	br = bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", 100)+"\r\n"), 16)
+	if line, err := ReadLine(br); err != nil || len(line) != 100 {
+		t.Fatalf("Unexpected line of length %v (err %v)\n", len(line), err)
+	}
+}
+
+func TestReadRequestControlCharacters(t *testing.T) {
+	for _, raw := range []string{
+		"GET /a\x00b HTTP/1.1\r\nHost: website1\r\n\r\n",
+		"GET /a\tb HTTP/1.1\r\nHost: website1\r\n\r\n",
+		"GET / HTTP/1.1\nHost: website1\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: website1\rX-Injected: 1\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: website1\r\nX-Log: a\nb\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: website1\r\nX-Bell: \x07\r\n\r\n",
+	} {
+		if _, err := readRequestString(raw); err == nil {
+			t.Fatalf("Expected an error for request %q\n", raw)
+		}
+	}
+
+	if _, err := readRequestString("GET / HTTP/1.1\r\nHost: website1\r\nX-Tab: a\tb\r\n\r\n"); err != nil {
+		t.Fatalf("Unexpected error for a tab in a header value: %v\n", err)
+	}
+}
+
+func TestRequestWriteRoundTrip(t *testing.T) {
+	req := NewRequest("website1", "/subdir/index.html")
+	req.Close = true
+	req.Headers["user-agent"] = "Mozilla/5.0 (X11; Linux)"
+	req.Headers["x-custom"] = "A b"
+
+	var sb strings.Builder
+	if err := req.Write(&sb); err != nil {
+		t.Fatalf("Error writing request: %v\n", err.Error())
+	}
+	want := "GET /subdir/index.html HTTP/1.1\r\n" +
+		"Connection: close\r\n" +
+		"Host: website1\r\n" +
+		"User-Agent: Mozilla/5.0 (X11; Linux)\r\n" +
+		"X-Custom: A b\r\n" +
+		"\r\n"
+	if sb.String() != want {
+		t.Fatalf("Unexpected serialization:\n%q\nwant:\n%q\n", sb.String(), want)
+	}
+
+	parsed, err := readRequestString(sb.String())
+	if err != nil {
+		t.Fatalf("Error parsing written request: %v\n", err.Error())
+	}
+	if err := parsed.processHeader(); err != nil {
+		t.Fatalf("Error processing written request: %v\n", err.Error())
+	}
+	if parsed.Method != req.Method || parsed.URL != req.URL || parsed.Host != req.Host || !parsed.Close {
+		t.Fatalf("Round trip changed the request: %+v\n", parsed)
+	}
+	for k, v := range req.Headers {
+		if parsed.Headers[k] != v {
+			t.Fatalf("Round trip changed header %v from %q to %q\n", k, v, parsed.Headers[k])
+		}
+	}
+}
+
+func TestRequestConnMetadata(t *testing.T) {
+	s := newTestServer()
+	var seen []*Request
+	s.HandleFunc("/meta", func(req *Request) *Response {
+		seen = append(seen, req)
+		res := &Response{}
+		res.HandleOK()
+		return res
+	})
+	for i := 0; i < 2; i++ {
+		conn := &scriptedConn{r: strings.NewReader(strings.Repeat("GET /meta HTTP/1.1\r\nHost: website1\r\n\r\n", 2))}
+		s.HandleConnection(conn)
+	}
+	if len(seen) != 4 {
+		t.Fatalf("Expected 4 requests but got: %v\n", len(seen))
+	}
+	if seen[0].ConnID == 0 || seen[0].ConnID != seen[1].ConnID || seen[2].ConnID != seen[3].ConnID || seen[0].ConnID == seen[2].ConnID {
+		t.Fatalf("Expected one ConnID per connection but got: %v %v %v %v\n", seen[0].ConnID, seen[1].ConnID, seen[2].ConnID, seen[3].ConnID)
+	}
+	if seen[0].RemoteAddr != "127.0.0.1:0" || seen[0].LocalAddr != "127.0.0.2:0" {
+		t.Fatalf("Expected the addresses of the connection but got: %q %q\n", seen[0].RemoteAddr, seen[0].LocalAddr)
+	}
+}
+
+func TestRequestWriteChunked(t *testing.T) {
+	req := NewRequest("website1", "/upload")
+	req.Method = "PUT"
+	req.Body = strings.NewReader("streamed")
+	req.ContentLength = -1
+	req.Trailers = map[string]string{"x-checksum": "abc"}
+
+	var sb strings.Builder
+	if err := req.Write(&sb); err != nil {
+		t.Fatalf("Error writing request: %v\n", err.Error())
+	}
+	parsed, err := readRequestString(sb.String())
+	if err != nil {
+		t.Fatalf("Error parsing written request: %v\n", err.Error())
+	}
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil || string(body) != "streamed" || parsed.ContentLength != -1 {
+		t.Fatalf("Round trip changed the body to %q (length %v): %v\n", body, parsed.ContentLength, err)
+	}
+	if parsed.Trailers["x-checksum"] != "abc" {
+		t.Fatalf("Round trip lost the trailer: %v\n", parsed.Trailers)
+	}
+}
@@ -3,8 +3,14 @@ package tritonhttp
 import (
 	"bufio"
 	"fmt"
+	"html/template"
 	"io"
+	"log"
+	"net/http/httputil"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,9 +30,35 @@ type Response struct {
 	// FilePath is the local path to the file to serve.
 	// It could be "", which means there is no file to serve.
 	FilePath string
+	// Offset is where the body starts in the file at FilePath. The body
+	// is the ContentLength bytes from there.
+	Offset int64
+	// parts, when set, make the body a multipart/byteranges of ranges of
+	// the file at FilePath instead, see handleRange
+	parts []rangePart
+	// encodeIn is the content coding the body is compressed in on the fly,
+	// see encodeBody
+	encodeIn string
 
 	// Response body will contain response as a HTML
 	Body string
+
+	// Date, LastModified and ContentLength are written as the "Date",
+	// "Last-Modified" and "Content-Length" headers, taking precedence over
+	// any value in Headers. A zero time is not written. ContentLength is
+	// written for every status that allows a body.
+	Date          time.Time
+	LastModified  time.Time
+	ContentLength int64
+
+	// Cookies are each written as a "Set-Cookie" header, after Headers.
+	// Use SetCookie to add one.
+	Cookies []*Cookie
+
+	// Vary lists the request headers the response was selected by, written
+	// as the "Vary" header so caches keep one copy per variant. Use
+	// AddVary to add to it.
+	Vary []string
 }
 
 // HandleOK prepares res to be a 200 OK response
@@ -37,84 +69,411 @@ func (res *Response) HandleOK() {
 	res.StatusText = statusText[statusOK]
 }
 
-func (res *Response) HandleClose() {
+// HandleInformational prepares res to be an interim 1xx response, sent
+// before the final response to the same request.
+func (res *Response) HandleInformational(statusCode int) {
 	res.init()
-	res.StatusCode = statusOK
-	res.StatusText = statusText[statusOK]
-	res.FilePath = ""
-	res.Headers[CONNECTION] = "close"
+	res.StatusCode = statusCode
+	res.StatusText = statusText[statusCode]
+}
+
+// SetBody makes body, of the given Content-Type, the body of res.
+func (res *Response) SetBody(contentType, body string) {
+	res.Body = body
+	res.Headers["Content-Type"] = contentType
+	res.ContentLength = int64(len(body))
+}
+
+// AddVary records that res depends on the given request headers, e.g.
+// "Accept-Encoding" for a response that may be compressed. Names are
+// canonicalized and deduplicated; "*" means the response cannot be cached
+// by variant at all.
+func (res *Response) AddVary(keys ...string) {
+	for _, key := range keys {
+		key = CanonicalHeaderKey(strings.TrimSpace(key))
+		if key == "" || containsFold(res.Vary, key) {
+			continue
+		}
+		res.Vary = append(res.Vary, key)
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// varyHeader merges the Vary field of res, the headers its request was
+// negotiated on and any "Vary" set directly in its Headers.
+func (res *Response) varyHeader(set string) string {
+	var keys []string
+	for _, key := range strings.Split(set, ",") {
+		if key = CanonicalHeaderKey(strings.TrimSpace(key)); key != "" && !containsFold(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	vary := res.Vary
+	if res.Request != nil {
+		vary = append(vary[:len(vary):len(vary)], res.Request.varied...)
+	}
+	for _, key := range vary {
+		if key = CanonicalHeaderKey(key); !containsFold(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	if containsFold(keys, "*") {
+		return "*"
+	}
+	return strings.Join(keys, ", ")
 }
 
-// HandleBadRequest prepares res to be a 405 Method Not allowed response
+// HandleBadRequest prepares res to be a 400 Bad Request response, after
+// which the connection is closed.
 func (res *Response) HandleBadRequest() {
+	res.HandleError(statusBadRequest)
+	res.Headers["Connection"] = "close"
+}
+
+// HandleNotFound prepares res to be a 404 Not Found response.
+func (res *Response) HandleNotFound() {
+	res.HandleError(statusNotFound)
+}
+
+// HandleError prepares res to be an error response with the given status
+// code.
+func (res *Response) HandleError(statusCode int) {
 	res.init()
-	res.StatusCode = statusBadRequest
+	res.StatusCode = statusCode
+	res.StatusText = statusText[statusCode]
 	res.FilePath = ""
-	res.Headers[CONNECTION] = "close"
 }
 
 func (res *Response) init() {
 	res.Proto = responseProto
 	res.Headers = make(map[string]string)
-	res.Body = "NULL"
-	res.Headers[DATE] = FormatTime(time.Now())
+	res.Body = ""
+	res.Date = time.Now()
 }
 
 func (res *Response) getStatusLine() string {
-	return fmt.Sprintf("%v %v %v\r\n", res.Proto, res.StatusCode, statusText[res.StatusCode])
+	text := res.StatusText
+	if text == "" {
+		text = statusText[res.StatusCode]
+	}
+	return fmt.Sprintf("%v %v %v\r\n", res.Proto, res.StatusCode, text)
 }
 
-func (res *Response) Write(w io.Writer) error {
-	bw := bufio.NewWriter(w)
+// WriteTo serializes res to w: the status line, the headers and the body,
+// unless res answers a HEAD request.
+// It only writes; closing the connection afterwards is up to the caller,
+// see Response.Close.
+func (res *Response) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
 
-	statusLine := res.getStatusLine()
-	headers := res.generateResponseHeaders()
-	_, err := w.Write([]byte(statusLine + headers + "\r\n"))
-	if err != nil {
-		return err
+	if _, err := bw.WriteString(res.getStatusLine()); err != nil {
+		return cw.n, err
 	}
-	if res.StatusCode == 200 {
-		_, err := w.Write([]byte(res.Body))
-		if err != nil {
-			return err
+	if _, err := bw.WriteString(res.generateResponseHeaders() + "\r\n"); err != nil {
+		return cw.n, err
+	}
+	if !res.omitsBody() {
+		if err := res.writeBody(bw); err != nil {
+			return cw.n, err
 		}
 	}
 
-	// serializedResponse := fmt.Sprintf(statusLine + res.generateResponseHeaders())
-	// if res.Body != "" {
-	// 	serializedResponse += "\r\n" + res.Body
-	// }
-	// serializedResponse += "\r\n"
-	// fmt.Printf("Serialized Response: \n%s\n", serializedResponse)
-	// if _, err := bw.WriteString(serializedResponse); err != nil {
-	// 	return err
-	// }
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// omitsBody reports whether res answers a HEAD request: it has the
+// headers, Content-Length included, of the response to a GET, but no body.
+func (res *Response) omitsBody() bool {
+	return res.Request != nil && res.Request.Method == methodHead
+}
 
-	if err := bw.Flush(); err != nil {
+// writeBody writes the body of res to w: Body if set, otherwise the
+// selected part of the file at FilePath. The file is streamed, never read
+// into memory as a whole.
+func (res *Response) writeBody(w io.Writer) error {
+	if res.Body != "" {
+		_, err := io.WriteString(w, res.Body)
 		return err
 	}
-	return nil
+	if res.FilePath == "" || res.ContentLength == 0 || !bodyAllowed(res.StatusCode) {
+		return nil
+	}
+	f, err := os.Open(res.FilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(res.parts) > 0 {
+		return writeParts(w, f, res.parts)
+	}
+	if _, err := f.Seek(res.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	// a file that shrank since it was stat'ed makes CopyN fail, rather
+	// than sending fewer bytes than announced
+	_, err = io.CopyN(w, f, res.ContentLength)
+	return err
+}
+
+// Close reports whether the connection must be closed after res is sent.
+func (res *Response) Close() bool {
+	return containsToken(parseTokenList(res.Headers["Connection"]), "close")
 }
 
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// headerOrder lists the headers that are always written first, in this
+// order. Any other header follows them, sorted by key.
+var headerOrder = []string{
+	"Connection",
+	"Content-Length",
+	"Content-Type",
+	"Date",
+	"Last-Modified",
+}
+
+// sortedHeaderKeys returns the canonical keys of headers in the order they
+// are serialized.
+func sortedHeaderKeys(headers map[string]string) []string {
+	rank := make(map[string]int, len(headerOrder))
+	for i, k := range headerOrder {
+		rank[k] = i
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, CanonicalHeaderKey(k))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, iKnown := rank[keys[i]]
+		rj, jKnown := rank[keys[j]]
+		switch {
+		case iKnown && jKnown:
+			return ri < rj
+		case iKnown != jKnown:
+			return iKnown
+		default:
+			return keys[i] < keys[j]
+		}
+	})
+	return keys
+}
+
+// bodyAllowed reports whether a response with the given status code may
+// carry a body (RFC 7230 section 3.3).
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
+
+// generateResponseHeaders serializes res.Headers with canonical keys in a
+// deterministic order, so responses can be compared byte for byte.
 func (res *Response) generateResponseHeaders() string {
-	line := ""
-	idx := 0
-	keys := make([]string, len(res.Headers))
+	canonical := res.headerFields()
+	var sb strings.Builder
+	for _, k := range sortedHeaderKeys(canonical) {
+		sb.WriteString(k + ": " + canonical[k] + "\r\n")
+	}
+	for _, c := range res.Cookies {
+		sb.WriteString("Set-Cookie: " + c.String() + "\r\n")
+	}
+	return sb.String()
+}
+
+// headerFields returns the headers to send with res, keyed by canonical
+// name, including the ones derived from its typed fields. Of the keys of
+// res.Headers that only differ in case, e.g. "ETag" and the "Etag" of a
+// relayed response, the canonical spelling wins, otherwise the first in
+// sorted order.
+func (res *Response) headerFields() map[string]string {
+	keys := make([]string, 0, len(res.Headers))
 	for k := range res.Headers {
-		keys[idx] = k
-		idx += 1
+		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	canonical := make(map[string]string, len(res.Headers)+3)
 	for _, k := range keys {
-		headerValue, ok := res.Headers[k]
-		if ok {
-			line += fmt.Sprintf(k + ":" + headerValue + "\r\n")
+		name := CanonicalHeaderKey(k)
+		if _, ok := canonical[name]; ok && k != name {
+			continue
 		}
+		canonical[name] = res.Headers[k]
+	}
+	if !res.Date.IsZero() {
+		canonical["Date"] = FormatTime(res.Date)
+	}
+	if !res.LastModified.IsZero() {
+		canonical["Last-Modified"] = FormatTime(res.LastModified)
+	}
+	if vary := res.varyHeader(canonical["Vary"]); vary != "" {
+		canonical["Vary"] = vary
 	}
-	return line
+	if res.establishesTunnel() {
+		// the tunnel, not a body, follows (RFC 9110 section 9.3.6)
+		delete(canonical, "Content-Length")
+	} else if bodyAllowed(res.StatusCode) {
+		canonical["Content-Length"] = strconv.FormatInt(res.ContentLength, 10)
+	} else {
+		delete(canonical, "Content-Length")
+	}
+	return canonical
 }
 
-func (res *Response) HandleNotFound() {
-	res.init()
-	res.StatusCode = statusNotFound
+// errorPage is rendered for error responses, see HandleErrorPage.
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.StatusCode}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.StatusCode}} {{.StatusText}}</h1>
+<hr>
+<p>TritonHTTP</p>
+</body>
+</html>
+`))
+
+// HandleErrorPage attaches a small HTML page describing the status of res,
+// so browsers don't render error responses as blank pages.
+func (res *Response) HandleErrorPage() {
+	data := struct {
+		StatusCode int
+		StatusText string
+	}{res.StatusCode, statusText[res.StatusCode]}
+	if err := res.RenderTemplate(errorPage, data); err != nil {
+		log.Printf("Failed to render error page: %v", err)
+	}
+}
+
+// ReadResponse reads a response from br, as written by Response.Write. The
+// body is delimited by Content-Length, by chunked transfer coding, or by the
+// end of the connection when there is neither.
+func ReadResponse(br *bufio.Reader) (*Response, error) {
+	return readResponse(br, methodGet, 0)
+}
+
+// readResponse is ReadResponse for a request with the given method, which
+// gets no body if it is HEAD, with a limit on the size of the body; a
+// larger body fails with ErrResponseTooLarge. Zero means no limit.
+func readResponse(br *bufio.Reader, method string, maxBody int64) (*Response, error) {
+	res := &Response{Headers: make(map[string]string)}
+
+	line, err := ReadLine(br)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		return nil, badStringError("malformed status line", line)
+	}
+	res.Proto = fields[0]
+	if res.StatusCode, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, badStringError("malformed status code", fields[1])
+	}
+	if len(fields) == 3 {
+		res.StatusText = fields[2]
+	}
+
+	for {
+		line, err := ReadLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if key = CanonicalHeaderKey(key); key == "Set-Cookie" {
+			res.Cookies = append(res.Cookies, parseSetCookie(value))
+			continue
+		}
+		res.Headers[key] = value
+	}
+
+	if date, ok := res.Headers["Date"]; ok {
+		res.Date, _ = ParseTime(date)
+	}
+	if lastModified, ok := res.Headers["Last-Modified"]; ok {
+		res.LastModified, _ = ParseTime(lastModified)
+	}
+
+	if method == methodHead || !bodyAllowed(res.StatusCode) {
+		// no body follows, whatever the headers say; a HEAD response
+		// keeps the length of the body a GET would get
+		if cl, ok := res.Headers["Content-Length"]; ok && bodyAllowed(res.StatusCode) {
+			length, err := strconv.ParseInt(cl, 10, 64)
+			if err != nil || length < 0 {
+				return nil, badStringError("malformed Content-Length", cl)
+			}
+			res.ContentLength = length
+		}
+		return res, nil
+	}
+
+	var body []byte
+	if te, ok := res.Headers["Transfer-Encoding"]; ok && containsToken(parseTokenList(te), "chunked") {
+		if body, err = readAllLimited(httputil.NewChunkedReader(br), maxBody); err != nil {
+			return nil, err
+		}
+		// the body is stored decoded
+		delete(res.Headers, "Transfer-Encoding")
+	} else if cl, ok := res.Headers["Content-Length"]; ok {
+		length, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || length < 0 {
+			return nil, badStringError("malformed Content-Length", cl)
+		}
+		if maxBody > 0 && length > maxBody {
+			return nil, ErrResponseTooLarge
+		}
+		// the length is not trusted with an allocation: the body grows as
+		// it arrives
+		if body, err = io.ReadAll(io.LimitReader(br, length)); err != nil {
+			return nil, err
+		}
+		if int64(len(body)) < length {
+			return nil, io.ErrUnexpectedEOF
+		}
+	} else {
+		if body, err = readAllLimited(br, maxBody); err != nil {
+			return nil, err
+		}
+	}
+	res.ContentLength = int64(len(body))
+	res.Body = string(body)
+	return res, nil
+}
+
+// readAllLimited reads r to the end, failing with ErrResponseTooLarge past
+// max bytes. Zero means no limit.
+func readAllLimited(r io.Reader, max int64) ([]byte, error) {
+	if max == 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, ErrResponseTooLarge
+	}
+	return body, nil
 }
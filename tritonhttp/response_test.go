@@ -0,0 +1,122 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestResponseHeaderOrder(t *testing.T) {
+	res := &Response{
+		Proto:      responseProto,
+		StatusCode: statusOK,
+		Headers: map[string]string{
+			"x-custom":      "1",
+			"connection":    "close",
+			"Accept-Ranges": "bytes",
+		},
+		Body:          "hi",
+		Date:          time.Date(2022, time.February, 2, 0, 0, 0, 0, time.UTC),
+		LastModified:  time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC),
+		ContentLength: 2,
+	}
+
+	var buf bytes.Buffer
+	if n, err := res.WriteTo(&buf); err != nil || n != int64(buf.Len()) {
+		t.Fatalf("Error writing response (%v bytes reported): %v\n", n, err)
+	}
+
+	want := "HTTP/1.1 200 OK\r\n" +
+		"Connection: close\r\n" +
+		"Content-Length: 2\r\n" +
+		"Date: Wed, 02 Feb 2022 00:00:00 GMT\r\n" +
+		"Last-Modified: Tue, 01 Feb 2022 00:00:00 GMT\r\n" +
+		"Accept-Ranges: bytes\r\n" +
+		"X-Custom: 1\r\n" +
+		"\r\n" +
+		"hi"
+	if buf.String() != want {
+		t.Fatalf("Unexpected serialization:\n%q\nwant:\n%q\n", buf.String(), want)
+	}
+}
+
+func TestReadResponseTypedFields(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\n" +
+		"Content-Length: 5\r\n" +
+		"Date: Wed, 02 Feb 2022 00:00:00 GMT\r\n" +
+		"Last-Modified: Tue, 01 Feb 2022 00:00:00 GMT\r\n" +
+		"\r\n" +
+		"hello"
+	res, err := ReadResponse(bufio.NewReader(bytes.NewBufferString(raw)))
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	if res.ContentLength != 5 || res.Body != "hello" {
+		t.Fatalf("Unexpected body %q of length %v\n", res.Body, res.ContentLength)
+	}
+	if !res.Date.Equal(time.Date(2022, time.February, 2, 0, 0, 0, 0, time.UTC)) ||
+		!res.LastModified.Equal(time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected Date %v / Last-Modified %v\n", res.Date, res.LastModified)
+	}
+}
+
+func TestReadResponseTruncated(t *testing.T) {
+	// a huge Content-Length is not allocated up front
+	for _, length := range []string{"10", "9999999999"} {
+		raw := "HTTP/1.1 200 OK\r\nContent-Length: " + length + "\r\n\r\nhello"
+		if _, err := ReadResponse(bufio.NewReader(bytes.NewBufferString(raw))); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("Expected %v for a truncated body of %v bytes but got: %v\n", io.ErrUnexpectedEOF, length, err)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	tests := []struct {
+		set  string
+		add  []string
+		want string
+	}{
+		{"", nil, ""},
+		{"", []string{"accept-encoding", "Accept-Encoding", "origin"}, "Accept-Encoding, Origin"},
+		{"Accept-Language", []string{"accept-language", "Accept-Encoding"}, "Accept-Language, Accept-Encoding"},
+		{"", []string{"Origin", "*"}, "*"},
+	}
+	for _, tt := range tests {
+		res := &Response{}
+		res.HandleOK()
+		if tt.set != "" {
+			res.Headers["Vary"] = tt.set
+		}
+		res.AddVary(tt.add...)
+		if got := res.headerFields()["Vary"]; got != tt.want {
+			t.Fatalf("Expected Vary %q but got %q\n", tt.want, got)
+		}
+	}
+}
+
+func TestHeaderFieldsCaseCollision(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		want    string
+	}{
+		{map[string]string{"ETag": `"local"`, "Etag": `"relayed"`}, `"relayed"`},
+		{map[string]string{"etag": `"a"`, "ETag": `"b"`}, `"b"`},
+		{map[string]string{"ETAG": `"a"`, "Etag": `"b"`, "etag": `"c"`}, `"b"`},
+	}
+	for _, tt := range tests {
+		// map order varies between runs, the result must not
+		for i := 0; i < 20; i++ {
+			res := &Response{}
+			res.HandleOK()
+			for k, v := range tt.headers {
+				res.Headers[k] = v
+			}
+			if got := res.headerFields()["Etag"]; got != tt.want {
+				t.Fatalf("Expected Etag %q for %v but got %q\n", tt.want, tt.headers, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tritonhttp
+
+import (
+	"net"
+	"os"
+)
+
+// The states ListenAndServe reports to systemd.
+const (
+	sdReady    = "READY=1"
+	sdStopping = "STOPPING=1"
+)
+
+// sdNotify sends state to the service manager over the datagram socket
+// named by $NOTIFY_SOCKET, as units of Type=notify expect (see
+// sd_notify(3)). It does nothing when the variable is unset, i.e. when not
+// running under systemd. A name starting with "@" is an abstract socket.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,54 @@
+package tritonhttp
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSDNotify(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "notify")
+	sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Error listening on %v: %v\n", name, err.Error())
+	}
+	defer sock.Close()
+	t.Setenv("NOTIFY_SOCKET", name)
+
+	s := newTestServer()
+	s.Addr = "127.0.0.1:0"
+	done := make(chan error)
+	go func() {
+		done <- s.ListenAndServe()
+	}()
+	expect := func(want string) {
+		if err := sock.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("Error setting deadline: %v\n", err.Error())
+		}
+		buf := make([]byte, 64)
+		n, err := sock.Read(buf)
+		if err != nil {
+			t.Fatalf("Error reading notification: %v\n", err.Error())
+		}
+		if string(buf[:n]) != want {
+			t.Fatalf("Expected notification %q but got: %q\n", want, buf[:n])
+		}
+	}
+	expect(sdReady)
+	// READY=1 is sent before Serve tracks the listener
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.listeners.mu.Lock()
+		n := len(s.listeners.lns)
+		s.listeners.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to serve its listener\n")
+		}
+	}
+	s.Close()
+	expect(sdStopping)
+	<-done
+}
@@ -2,7 +2,7 @@ package tritonhttp
 
 import (
 	"bufio"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -10,45 +10,467 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	responseProto = "HTTP/1.1"
 
-	statusOK               = 200
-	statusMethodNotAllowed = 405
-	statusNotFound         = 404
-	statusBadRequest       = 400
+	statusContinue            = 100
+	statusSwitchingProtocols  = 101
+	statusEarlyHints          = 103
+	statusOK                  = 200
+	statusCreated             = 201
+	statusAccepted            = 202
+	statusNoContent           = 204
+	statusPartialContent      = 206
+	statusMultiStatus         = 207
+	statusMovedPermanently    = 301
+	statusFound               = 302
+	statusSeeOther            = 303
+	statusNotModified         = 304
+	statusTemporaryRedirect   = 307
+	statusPermanentRedirect   = 308
+	statusMethodNotAllowed    = 405
+	statusNotAcceptable       = 406
+	statusNotFound            = 404
+	statusContentTooLarge     = 413
+	statusBadRequest          = 400
+	statusForbidden           = 403
+	statusRequestTimeout      = 408
+	statusPreconditionFailed  = 412
+	statusURITooLong          = 414
+	statusRangeNotSatisfiable = 416
+	statusExpectationFailed   = 417
+	statusHeaderTooLarge      = 431
+	statusInternalServerError = 500
+	statusBadGateway          = 502
+	statusServiceUnavailable  = 503
+	// statusHTTPVersionNotSupported is sent for well-formed request lines
+	// of another HTTP version than 1.1
+	statusHTTPVersionNotSupported = 505
+	// statusBandwidthLimitExceeded is not standard, but commonly used by
+	// web hosts for sites over their transfer quota
+	statusBandwidthLimitExceeded = 509
 
-	HOST       = "host"
-	CONNECTION = "connection"
-	DATE       = "Date"
+	HOST              = "host"
+	CONNECTION        = "connection"
+	COOKIE            = "cookie"
+	DATE              = "Date"
+	CONTENT_LENGTH    = "content-length"
+	TRANSFER_ENCODING = "transfer-encoding"
+	EXPECT            = "expect"
+
+	methodGet      = "GET"
+	methodHead     = "HEAD"
+	methodDelete   = "DELETE"
+	methodTrace    = "TRACE"
+	methodPatch    = "PATCH"
+	methodOptions  = "OPTIONS"
+	methodPropfind = "PROPFIND"
 
 	// LAYOUT = "01 02 2006 15:04:05"
 )
 
 var statusText = map[int]string{
-	statusOK:               "OK",
-	statusMethodNotAllowed: "Method Not Allowed",
-	statusNotFound:         "Not Found",
-	statusBadRequest:       "Bad Request",
+	statusContinue:                "Continue",
+	statusSwitchingProtocols:      "Switching Protocols",
+	statusEarlyHints:              "Early Hints",
+	statusOK:                      "OK",
+	statusCreated:                 "Created",
+	statusAccepted:                "Accepted",
+	statusNoContent:               "No Content",
+	statusPartialContent:          "Partial Content",
+	statusMultiStatus:             "Multi-Status",
+	statusMovedPermanently:        "Moved Permanently",
+	statusFound:                   "Found",
+	statusSeeOther:                "See Other",
+	statusNotModified:             "Not Modified",
+	statusTemporaryRedirect:       "Temporary Redirect",
+	statusPermanentRedirect:       "Permanent Redirect",
+	statusMethodNotAllowed:        "Method Not Allowed",
+	statusNotAcceptable:           "Not Acceptable",
+	statusNotFound:                "Not Found",
+	statusContentTooLarge:         "Content Too Large",
+	statusBadRequest:              "Bad Request",
+	statusForbidden:               "Forbidden",
+	statusRequestTimeout:          "Request Timeout",
+	statusPreconditionFailed:      "Precondition Failed",
+	statusURITooLong:              "URI Too Long",
+	statusRangeNotSatisfiable:     "Range Not Satisfiable",
+	statusExpectationFailed:       "Expectation Failed",
+	statusHeaderTooLarge:          "Request Header Fields Too Large",
+	statusInternalServerError:     "Internal Server Error",
+	statusBadGateway:              "Bad Gateway",
+	statusServiceUnavailable:      "Service Unavailable",
+	statusHTTPVersionNotSupported: "HTTP Version Not Supported",
+	statusBandwidthLimitExceeded:  "Bandwidth Limit Exceeded",
 }
 
 type Server struct {
 	// Addr ("host:port") : specifies the TCP address of the server
 	Addr string
+	// Network is the network ListenAndServe listens on: NetworkIPv4 or
+	// NetworkIPv6 to accept only IPv4 or only IPv6 clients. Empty means
+	// NetworkDualStack, which accepts both when the host of Addr is empty
+	// or unspecified.
+	Network string
+	// Interface names a network interface, e.g. "eth0", to listen on
+	// instead of all of them: ListenAndServe then listens on every address
+	// of the interface in Network, with the port of Addr, whose host must
+	// be empty.
+	Interface string
+	// ListenAddrs lists more "host:port" addresses ListenAndServe listens
+	// on in Network, besides Addr. SetListenAddrs changes them at runtime.
+	ListenAddrs []string
 	// DocRoot the root folder under which clients can potentially look up information.
 	// Anything outside this should be "out-of-bounds"
 	DocRoot string
-	// VirtualHosts
+	// VirtualHosts maps host names to their docroot. Internationalized
+	// names may be given in Unicode or punycode. It is read once, when
+	// the first request is served; use SetVirtualHosts to change the
+	// mapping of a running server.
 	VirtualHosts map[string]string
+	// VirtualHostSettings holds optional per-host settings, keyed by host
+	// name like VirtualHosts. It must not be modified while serving.
+	VirtualHostSettings map[string]VirtualHostSettings
+	// DefaultHost names the virtual host that serves the requests whose
+	// Host matches none, e.g. requests for an IP address. Empty means such
+	// requests get 404.
+	DefaultHost string
+	// ProblemJSON makes 4xx/5xx responses carry an RFC 7807
+	// application/problem+json body instead of an empty one
+	ProblemJSON bool
+	// MaxHeaderLineBytes caps the length of the request line and of every
+	// header line. Zero means DefaultMaxHeaderLineBytes.
+	MaxHeaderLineBytes int
+	// MaxHeaderCount caps the number of header lines in a request.
+	// Zero means DefaultMaxHeaderCount.
+	MaxHeaderCount int
+	// Now returns the current time, used for Date and Last-Modified
+	// headers and for freshness. Defaults to time.Now; tests can freeze it
+	// to assert exact response bytes. Connection deadlines always follow
+	// the wall clock.
+	Now func() time.Time
+	// IdleTimeout is how long a connection may take to deliver the next
+	// request, measured from when the server starts reading it. Zero
+	// means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// RangeTypes lists the MIME types, or type prefixes such as "video/",
+	// of the files served in byte ranges; AllRangeTypes matches any file.
+	// Responses for them advertise "Accept-Ranges: bytes" and honor
+	// single-range "Range" requests. Nil means DefaultRangeTypes, an empty
+	// list serves no ranges.
+	RangeTypes []string
+	// TranscodeCharsets lets the server convert text files, stored in
+	// UTF-8, to another charset when the "Accept-Charset" header of the
+	// request excludes UTF-8. Without it such requests get a 406.
+	TranscodeCharsets bool
+	// Compress compresses text-like files on the fly in the content
+	// coding the "Accept-Encoding" header of the request favors: gzip,
+	// or another registered with RegisterEncoder, such as "br" and "zstd"
+	// when built with the "brotli" and "zstd" tags.
+	Compress bool
+	// CompressionPolicy sets the sizes and MIME types of the files
+	// Compress compresses; the zero value compresses text-like files of
+	// DefaultCompressMinSize bytes or more.
+	CompressionPolicy CompressionPolicy
+	// Precompressed serves the precompressed sidecar of a file, e.g.
+	// app.js.gz, app.js.zst or app.js.br next to app.js, when the request
+	// accepts its coding, sparing the CPU of compressing on the fly.
+	Precompressed bool
+	// ContentDigests adds "Repr-Digest" and "Digest" headers carrying the
+	// SHA-256 sum of each served file, so clients can verify downloads.
+	// Sums are cached until the file changes.
+	ContentDigests bool
+	// WebDAV enables read-only WebDAV: PROPFIND and OPTIONS requests are
+	// answered so the docroots can be mounted by file browsers
+	WebDAV bool
+	// Uploads enables upload mode: PUT requests create or replace files
+	// under the docroot of their host, optionally in resumable pieces,
+	// see handlePut
+	Uploads bool
+	// PostHandler, if set, answers the POST requests to paths no
+	// HandleFunc pattern matches, e.g. to accept form submissions
+	// anywhere. Without it such requests get 405.
+	PostHandler HandlerFunc
+	// ExpectContinue, if set, decides whether a request sent with
+	// "Expect: 100-continue" may send its body, e.g. by its size or
+	// credentials; those it turns down get 417 Expectation Failed before
+	// the body is sent. The others get 100 Continue once the handler
+	// reads the body.
+	ExpectContinue func(req *Request) bool
+	// MaxBodyBytes caps the size of request bodies; larger requests are
+	// refused with 413 before their body is read. The size of a chunked
+	// body, or of an HTTP/2 or HTTP/3 body without Content-Length, is not
+	// known in advance, reading it fails with ErrBodyTooLarge instead once
+	// it exceeds the cap. Zero means no limit.
+	MaxBodyBytes int64
+	// H2C enables cleartext HTTP/2: connections starting with the HTTP/2
+	// preface, and HTTP/1.1 requests asking to "Upgrade: h2c", are served
+	// over HTTP/2 instead
+	H2C bool
+	// TunnelHosts enables the CONNECT method for the listed "host:port"
+	// targets: the server opens a TCP connection to the target and relays
+	// bytes both ways until either side closes. CONNECT requests for other
+	// targets get 403. Empty means CONNECT is not supported.
+	TunnelHosts []string
+	// ProxyHosts enables forward-proxy mode for the listed host names:
+	// GET requests with an absolute-form target such as
+	// "http://example.org/" on one of them are fetched from that host and
+	// the response is relayed. Other absolute-form requests for hosts that
+	// are not virtual hosts get 403. Empty means no forward proxying.
+	ProxyHosts []string
+	// MaxProxyBytes caps the size of the response bodies relayed in
+	// forward-proxy mode; larger responses are answered with 502. Zero
+	// means DefaultMaxProxyBytes.
+	MaxProxyBytes int64
+	// ProxyCacheBytes enables caching of the responses relayed for the
+	// virtual hosts with upstreams (see VirtualHostSettings.Upstreams) and
+	// bounds the total size of the cached bodies. Responses are cached as
+	// their Cache-Control and Expires headers allow and revalidated with
+	// the upstream using their ETag or Last-Modified once stale. Zero
+	// means no caching.
+	ProxyCacheBytes int64
+	// Forwarded controls how proxied requests tell upstream servers about
+	// the client: ForwardedAppend adds the client to the Forwarded and
+	// X-Forwarded-For headers it sent, and sets X-Forwarded-Proto,
+	// X-Forwarded-Host and X-Real-IP unless an earlier proxy did.
+	// ForwardedReplace discards those headers from the client first, for
+	// servers facing clients that are not trusted proxies. ForwardedOff
+	// adds nothing. Empty means ForwardedAppend.
+	Forwarded string
+	// MaxProxyCacheObject is the largest response body that is cached.
+	// Zero means DefaultMaxProxyCacheObject.
+	MaxProxyCacheObject int64
+	// HealthCheckInterval is how often the upstreams of the virtual hosts
+	// with a VirtualHostSettings.HealthCheck path are checked while the
+	// server is serving. Zero means DefaultHealthCheckInterval.
+	HealthCheckInterval time.Duration
+	// MaxUpstreamFails is the number of consecutive failed requests, i.e.
+	// connection errors or 5xx responses, after which an upstream is
+	// ejected from its pool for UpstreamEjectTime. Zero means
+	// DefaultMaxUpstreamFails.
+	MaxUpstreamFails int
+	// UpstreamEjectTime is how long an upstream that kept failing is left
+	// out of its pool. Zero means DefaultUpstreamEjectTime.
+	UpstreamEjectTime time.Duration
+	// ImmutableAssets matches the base names of content-hash fingerprinted
+	// files, e.g. DefaultImmutableAssets, which are served with
+	// "Cache-Control: public, max-age=31536000, immutable". Nil disables
+	// the header.
+	ImmutableAssets *regexp.Regexp
+	// CachePolicy sets the "Cache-Control" header of the files served,
+	// e.g. "public, max-age=86400" for ".css", by extension (a key such as
+	// ".css") or by path prefix (a key such as "/static/"). The longest
+	// matching prefix wins over extensions; a max-age is also sent as an
+	// "Expires" date. VirtualHostSettings.CachePolicy takes precedence,
+	// and ImmutableAssets over both.
+	CachePolicy map[string]string
+	// TransferFile is the file the bytes sent per virtual host (see
+	// TransferStats) are kept in, as JSON, so that the transfer quotas of
+	// VirtualHostSettings survive restarts. It is read when serving
+	// starts, and written every TransferSaveInterval and when serving
+	// stops. Empty keeps the counts in memory only.
+	TransferFile string
+	// TransferSaveInterval is how often TransferFile is written. Zero
+	// means DefaultTransferSaveInterval.
+	TransferSaveInterval time.Duration
+	// Dev enables development mode: the docroots are watched for changes,
+	// which invalidate the cached digests of the changed files at once,
+	// and files are served with "Cache-Control: no-store" and without
+	// ETag or Last-Modified, so edits show up on the next reload. It
+	// takes precedence over CachePolicy and ImmutableAssets.
+	Dev bool
+	// MaxRequestsPerConn caps the number of requests served on one
+	// HTTP/1.1 connection: the response to the last of them closes it, and
+	// the earlier ones advertise the requests left in a "Keep-Alive"
+	// header. Recycling long-lived connections bounds their memory and lets
+	// clients behind layer 4 load balancers spread out again. Zero means
+	// no limit.
+	MaxRequestsPerConn int
+	// DrainDelay is how long Shutdown keeps serving once it has marked
+	// the server as not Ready, so that load balancers polling a readiness
+	// check (see HandleAdmin) stop sending traffic before the listeners
+	// close. Zero shuts down at once.
+	DrainDelay time.Duration
+	// ETagFuncs adds ETag strategies, by name, that virtual hosts can
+	// choose with VirtualHostSettings.ETag besides the built-in
+	// ETagModTime and ETagContentHash.
+	ETagFuncs map[string]ETagFunc
+	// TLSConfig configures the TLS of ListenAndServeTLS and ServeTLS,
+	// e.g. the minimum version or client authentication; the certificate
+	// files they are given are added to it. Nil means the defaults of
+	// crypto/tls.
+	TLSConfig *tls.Config
+	// CertCheckInterval is how often the certificate files of
+	// ListenAndServeTLS are checked for changes while serving, so renewed
+	// certificates are picked up. Zero means DefaultCertCheckInterval.
+	CertCheckInterval time.Duration
+	// HTTP3 makes ListenAndServeTLS also serve HTTP/3 on the UDP port of
+	// Addr, with the same TLS configuration, see ServeHTTP3.
+	HTTP3 bool
+	// ACME, if set, obtains and renews the certificates of
+	// ListenAndServeTLS and ServeTLS when they are given no certificate
+	// files, see NewACMEManager, and answers the HTTP-01 challenges of the
+	// certificate authority on the plain HTTP listeners of the server.
+	ACME ACMEManager
+	// LiveReload, in development mode, injects a script into the HTML
+	// pages served that reloads them whenever a watched file changes. The
+	// script listens for server-sent events at LiveReloadPath.
+	LiveReload bool
+
+	// vhosts is an immutable snapshot of the virtual hosts, shared by all
+	// connections and replaced as a whole by SetVirtualHosts
+	vhosts atomic.Pointer[map[string]string]
+	// settings is VirtualHostSettings with normalized host names
+	settings atomic.Pointer[map[string]VirtualHostSettings]
+	// certs serves the certificate files of ListenAndServeTLS or
+	// ServeTLS, if any
+	certs atomic.Pointer[CertReloader]
+	// listenTLS is the TLS configuration of ListenAndServeTLS, wrapping every
+	// listener opened, or nil
+	listenTLS atomic.Pointer[tls.Config]
+	// h3 is the HTTP/3 server started by ServeHTTP3, with the "http3"
+	// build tag
+	h3 http3State
+	// handlers holds the HandlerFuncs registered with HandleFunc
+	handlers handlers
+	// digests caches the sums of served files for ContentDigests
+	digests digestCache
+	// upstreams balances requests over the upstreams of each virtual host
+	// and tracks their health
+	upstreams upstreamPools
+	// healthChecks runs CheckUpstreams while the server is serving
+	healthChecks periodicTask
+	// transfers counts the bytes sent per virtual host, and transferSaves
+	// saves them to TransferFile
+	transfers     transferStats
+	transferSaves periodicTask
+	// downloads collects the DownloadStats of the URLs served
+	downloads downloadStats
+	// reloads wakes up the live-reload requests when a watched file
+	// changes
+	reloads liveReload
+	// listeners holds the listeners Serve accepts connections on, for
+	// Close
+	listeners listenerSet
+	// conns tracks the open connections, for Shutdown
+	conns connTracker
+	// draining is set once Shutdown is called
+	draining atomic.Bool
+	// connIDs is the last Request.ConnID handed out
+	connIDs atomic.Uint64
+	// proxyCache holds the upstream responses cached for ProxyCacheBytes
+	proxyCache proxyCache
+	// setReadDeadline, if set, replaces the wall-clock read deadlines of
+	// the idle timeout, so tests can expire them without waiting
+	setReadDeadline func(conn net.Conn, d time.Duration) error
+}
+
+// virtualHosts returns the current virtual host snapshot. The returned map
+// must not be modified.
+func (s *Server) virtualHosts() map[string]string {
+	if vhosts := s.vhosts.Load(); vhosts != nil {
+		return *vhosts
+	}
+	snapshot := copyVirtualHosts(s.VirtualHosts)
+	s.vhosts.CompareAndSwap(nil, &snapshot)
+	return *s.vhosts.Load()
+}
+
+// SetVirtualHosts atomically replaces the virtual hosts of the server. It
+// is safe to call while the server is handling requests; each request sees
+// either the old or the new mapping, never a mix of both.
+func (s *Server) SetVirtualHosts(vhosts map[string]string) {
+	snapshot := copyVirtualHosts(vhosts)
+	s.vhosts.Store(&snapshot)
+}
+
+func copyVirtualHosts(vhosts map[string]string) map[string]string {
+	return normalizeHostKeys(vhosts)
+}
+
+// hostSettings returns VirtualHostSettings keyed by normalized host name.
+// The returned map must not be modified.
+func (s *Server) hostSettings() map[string]VirtualHostSettings {
+	if settings := s.settings.Load(); settings != nil {
+		return *settings
+	}
+	snapshot := normalizeHostKeys(s.VirtualHostSettings)
+	s.settings.CompareAndSwap(nil, &snapshot)
+	return *s.settings.Load()
+}
+
+// DefaultIdleTimeout is the read timeout used when Server.IdleTimeout is not
+// set.
+const DefaultIdleTimeout = 5 * time.Second
+
+// extendReadDeadline makes reads from conn time out once the idle timeout
+// has passed. The deadline is taken from the wall clock, not from Now: the
+// network deadlines of conn are, and a frozen Now would have expired them
+// already.
+func (s *Server) extendReadDeadline(conn net.Conn) error {
+	if s.setReadDeadline != nil {
+		return s.setReadDeadline(conn, s.idleTimeout())
+	}
+	return conn.SetReadDeadline(time.Now().Add(s.idleTimeout()))
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return s.IdleTimeout
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+const (
+	// DefaultMaxHeaderLineBytes is the line length limit used when
+	// Server.MaxHeaderLineBytes is not set.
+	DefaultMaxHeaderLineBytes = 8 << 10
+	// DefaultMaxHeaderCount is the header count limit used when
+	// Server.MaxHeaderCount is not set.
+	DefaultMaxHeaderCount = 100
+)
+
+// requestLimits bounds how much input a single request may make the parser
+// consume. A zero field means no limit.
+type requestLimits struct {
+	maxLineBytes int
+	maxHeaders   int
+}
+
+func (s *Server) requestLimits() requestLimits {
+	limits := requestLimits{
+		maxLineBytes: s.MaxHeaderLineBytes,
+		maxHeaders:   s.MaxHeaderCount,
+	}
+	if limits.maxLineBytes == 0 {
+		limits.maxLineBytes = DefaultMaxHeaderLineBytes
+	}
+	if limits.maxHeaders == 0 {
+		limits.maxHeaders = DefaultMaxHeaderCount
+	}
+	return limits
 }
 
 func (s *Server) init() {
-	s.DocRoot = "docroot_dirs"
+	if s.DocRoot == "" {
+		s.DocRoot = "docroot_dirs"
+	}
 }
+
 func (s *Server) ListenAndServe() error {
 	// Validate the configuration of the server
 	s.init()
@@ -58,28 +480,54 @@ func (s *Server) ListenAndServe() error {
 	fmt.Println("Server setup valid!")
 
 	// server should now start to listen on the configured address
-	ln, err := net.Listen("tcp", s.Addr)
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	bound, err := s.listenAddrs(s.ListenAddrs, map[string]bool{s.Addr: true})
 	if err != nil {
+		closeListeners(lns)
+		return err
+	}
+	bound[s.Addr] = lns
+	if err := s.serveBound(bound); err != nil {
 		return err
 	}
-	fmt.Println("Listening on", ln.Addr())
 
-	// making sure the listener is closed when we exit
+	// the docroot is valid and the listeners are bound: tell systemd
+	if err := sdNotify(sdReady); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
 	defer func() {
-		err = ln.Close()
-		if err != nil {
-			fmt.Println("error in closing listener", err)
+		if err := sdNotify(sdStopping); err != nil {
+			log.Printf("Failed to notify systemd: %v", err)
 		}
 	}()
 
-	// accept connections forever
+	// serve until Close, even as SetListenAddrs replaces the listeners
+	<-s.listeners.closedChan()
+	return net.ErrClosed
+}
+
+// Serve accepts connections on ln and handles each of them in its own
+// goroutine. It returns once ln is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	defer s.listeners.track(ln)()
+	defer s.startHealthChecks()()
+	defer s.startTransferSaves()()
+	defer s.startDevWatch()()
+	defer s.startCertChecks()()
 	for {
 		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
 		if err != nil {
+			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
 		fmt.Println("accepted connection", conn.RemoteAddr())
-		go s.HandleConnection(conn)
+		go s.handleConnection(conn, ln)
 	}
 }
 
@@ -95,250 +543,643 @@ func (s *Server) ValidateServerSetup() error {
 		return fmt.Errorf("doc root %q is not a directory", s.DocRoot)
 	}
 
-	return nil
+	return s.validateListen()
 }
 
-func prettyPrintReq(request *Request) {
-	empJSON, err := json.MarshalIndent(*request, "", "  ")
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
-	fmt.Printf("Request %s\n", string(empJSON))
+// HandleConnection reads requests from the accepted conn and handles them.
+//
+// A TLS connection on which the client negotiated "h2" is served over
+// HTTP/2. Otherwise, a complete request is answered, and the connection is
+// kept open unless the client asked for "Connection: close". A clean close or an idle
+// timeout closes the connection silently. Every other failure is handled
+// according to its badRequestClass, see errors.go.
+func (s *Server) HandleConnection(conn net.Conn) {
+	s.handleConnection(conn, nil)
 }
 
-func prettyPrintRes(response *Response) {
-	empJSON, err := json.MarshalIndent(*response, "", "  ")
+// handleConnection is HandleConnection for conn, accepted on ln.
+func (s *Server) handleConnection(conn net.Conn, ln net.Listener) {
+	defer conn.Close()
+	if !s.conns.add(conn, ln) {
+		return
+	}
+	defer s.conns.remove(conn)
+	connID := s.connIDs.Add(1)
+	if err := s.extendReadDeadline(conn); err != nil {
+		log.Printf("Failed to set timeout for connection %v", conn.RemoteAddr())
+		return
+	}
+	h2, err := negotiatedHTTP2(conn)
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Printf("TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if h2 {
+		s.conns.active(conn)
+		s.serveHTTP2(conn, connID, nil, nil, nil)
+		return
 	}
-	fmt.Printf("Response %s\n", string(empJSON))
-}
 
-// HandleConnection reads requests from the accepted conn and handles them.
-func (s *Server) HandleConnection(conn net.Conn) {
-	br := bufio.NewReader(conn)
-	for {
-		// Set timeout
-		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			log.Printf("Failed to set timeout for connection %v", conn)
-			_ = conn.Close()
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
+	out := newPipelinedConn(conn)
+	defer out.flush()
+	br := bufio.NewReader(out)
+	// requests counts the requests answered, for MaxRequestsPerConn
+	requests := 0
+	if s.H2C {
+		if hasHTTP2Preface(br) {
+			s.conns.active(conn)
+			s.serveHTTP2(conn, connID, br, nil, nil)
 			return
 		}
-
-		// Read next request from the client
-		req, err := ReadRequest(br)
-		if err != nil {
-			fmt.Println("Error while reading request")
-			log.Printf(err.Error())
-			log.Printf("Handle bad request for error - Read request")
-			res := &Response{}
-			res.HandleBadRequest()
-			_ = res.Write(conn)
-			_ = conn.Close()
+	}
+	for {
+		// a server shutting down reads no more requests
+		if !s.conns.idle(conn) {
 			return
 		}
-		err = req.processHeader()
-		if err != nil {
-			fmt.Println("Error while processing header")
-			log.Printf(err.Error())
-			log.Printf("Handle bad request for error - Process header")
-			res := &Response{}
-			res.HandleBadRequest()
-			_ = res.Write(conn)
-			_ = conn.Close()
+		// Set timeout
+		if err := s.extendReadDeadline(conn); err != nil {
+			log.Printf("Failed to set timeout for connection %v", conn.RemoteAddr())
 			return
 		}
-		prettyPrintReq(req)
 
-		// Handle EOF
-		if errors.Is(err, io.EOF) {
+		// Read next request from the client
+		req, n, err := readRequest(br, s.requestLimits())
+		s.conns.active(conn)
+		if req != nil {
+			req.ConnID = connID
+			req.RemoteAddr = conn.RemoteAddr().String()
+			req.LocalAddr = conn.LocalAddr().String()
+		}
+		switch {
+		case errors.Is(err, io.EOF):
 			log.Printf("Connection closed by %v", conn.RemoteAddr())
-			_ = conn.Close()
 			return
-		}
-
-		// timeout in this application means we just close the connection
-		// Note : proj3 might require you to do a bit more here
-		if err, ok := err.(net.Error); ok && err.Timeout() {
+		case isTimeout(err) && !errors.Is(err, ErrRequestTimeout):
 			log.Printf("Connection to %v timed out", conn.RemoteAddr())
-			_ = conn.Close()
 			return
+		case errors.Is(err, net.ErrClosed):
+			// closed by Shutdown while idle
+			return
+		case err == nil:
+			err = req.processHeader()
 		}
 
 		if err != nil {
-			log.Printf(err.Error())
-			log.Printf("Handle bad request for error")
-			res := &Response{}
-			res.HandleBadRequest()
-			_ = res.Write(conn)
-			_ = conn.Close()
-			return
+			class := classOf(err)
+			log.Printf("Rejected request from %v after %d bytes: %v", conn.RemoteAddr(), n, err)
+			if class.statusCode == 0 {
+				return
+			}
+			// the body of a rejected request must not be taken for the
+			// next request
+			keepAlive := class.keepAlive && req != nil && s.discardBody(conn, req)
+			res := s.newResponse(class.statusCode, responseOptions{
+				req:    req,
+				close:  !keepAlive,
+				detail: err.Error(),
+			})
+			if class == classVersion && !s.ProblemJSON {
+				// the status alone leaves clients guessing which
+				// version to send instead
+				res.SetBody("text/plain; charset=utf-8", errors.Unwrap(err).Error()+"\n")
+			}
+			requests++
+			s.limitRequests(res, requests)
+			if err := s.writeResponse(out, res); err != nil || res.Close() {
+				return
+			}
+			continue
 		}
 
-		// if req.Close {
-		// 	fmt.Print("`Connection: close` header encountered\nClosing connection\n")
-		// 	res := s.HandleCloseRequest()
-		// 	prettyPrintRes(res)
-		// 	err = res.Write(conn)
-		// 	if err != nil {
-		// 		fmt.Println(err)
-		// 	}
-		// 	conn.Close()
-		// 	return
-		// }
+		if s.H2C && isH2CUpgrade(req) {
+			if settings, err := decodeHTTP2Settings(req); err == nil {
+				// the connection leaves HTTP/1.1 after the responses
+				// sent so far
+				if out.flush() != nil {
+					return
+				}
+				s.upgradeHTTP2(conn, br, req, settings)
+				return
+			}
+		}
 
-		// Handle the request which is not a GET and immediately close the connection and return
-		if err != nil {
-			log.Printf("Handle bad request for error: %v", err)
-			res := &Response{}
-			res.HandleBadRequest()
-			prettyPrintRes(res)
-			_ = res.Write(conn)
-			_ = conn.Close()
+		if req.Method == methodConnect && len(s.TunnelHosts) > 0 {
+			if out.flush() != nil {
+				return
+			}
+			s.tunnel(conn, br, req)
 			return
 		}
-		// Handle good request
-		// log.Printf("Handle good request: %v", string(empJSON))
 
-		res := s.HandleGoodRequest()
-		err = s.parseAndGenerateResponse(req, res)
-		prettyPrintRes(res)
-		// 404 error
-		if err != nil {
-			res := s.HandleNotFoundRequest()
-			fmt.Println("404 error; Closing connection")
-			_ = res.Write(conn)
-			_ = conn.Close()
+		req.conn = out
+		req.TLS = tlsState
+		req.httpsRedirect, _ = ln.(*httpsRedirectListener)
+		s.watchBody(conn, req)
+		if res := s.checkExpect(out, req); res != nil {
+			_ = s.writeResponse(out, res)
 			return
 		}
-		err = res.Write(conn)
-		if err != nil {
-			fmt.Println(err)
+		if err := s.writeEarlyHints(out, req); err != nil {
+			return
 		}
-		if req.Close {
-			err = res.Write(conn)
-			if err != nil {
-				fmt.Println(err)
+		res := s.handleRequest(req)
+		// whatever the handler left of the body must not be taken for
+		// the next request, unless the connection is closed anyway
+		if !res.Close() && awaitsContinue(req) {
+			// the body was never asked for, and may or may not follow
+			res.Headers["Connection"] = "close"
+		} else if !res.Close() {
+			if _, err := io.Copy(io.Discard, req.Body); err != nil {
+				// the response can still go out, the connection cannot
+				// be reused
+				log.Printf("Failed to read request body from %v: %v", conn.RemoteAddr(), err)
+				res.Headers["Connection"] = "close"
 			}
-			conn.Close()
+		}
+		requests++
+		s.limitRequests(res, requests)
+		if err := s.writeResponse(out, res); err != nil || res.Close() {
 			return
 		}
+		if req.longPolled {
+			if err := conn.SetWriteDeadline(time.Time{}); err != nil {
+				log.Printf("Failed to clear timeout for connection %v", conn.RemoteAddr())
+				return
+			}
+		}
+	}
+}
 
-		// We'll never close the connection and handle as many requests for this connection and pass on this
-		// responsibility to the timeout mechanism
+// watchBody makes the body of req, read from conn, extend the read
+// deadline as it arrives: a large body may take longer than the idle
+// timeout to arrive, but must not pause for longer. A chunked body is
+// limited to MaxBodyBytes.
+func (s *Server) watchBody(conn net.Conn, req *Request) {
+	progress := func() error { return s.extendReadDeadline(conn) }
+	switch body := req.Body.(type) {
+	case *bodyReader:
+		body.progress = progress
+	case *chunkedReader:
+		body.progress = progress
+		body.max = s.MaxBodyBytes
 	}
 }
 
-// HTTP/1.1 200 OK | Connection close
-func (s *Server) HandleCloseRequest() (res *Response) {
-	res = &Response{}
-	res.HandleOK()
-	res.FilePath = ""
+// discardBody reads and drops the body of req, a request read from conn
+// that is answered without being served, so the next request on conn
+// starts where the body ends. It reports whether it did; if not, e.g.
+// because the body is over MaxBodyBytes or the client waits for "100
+// Continue" before sending it, the connection must be closed.
+func (s *Server) discardBody(conn net.Conn, req *Request) bool {
+	if req.Body == nil || req.ContentLength == 0 {
+		return true
+	}
+	if s.MaxBodyBytes > 0 && req.ContentLength > s.MaxBodyBytes {
+		return false
+	}
+	if _, ok := req.Headers[EXPECT]; ok {
+		return false
+	}
+	s.watchBody(conn, req)
+	if _, err := io.Copy(io.Discard, req.Body); err != nil {
+		log.Printf("Failed to read request body from %v: %v", conn.RemoteAddr(), err)
+		return false
+	}
+	return true
+}
 
-	return res
+// responseOptions carries what newResponse needs besides the status code.
+type responseOptions struct {
+	// req is the request being answered, nil if it could not be parsed
+	req *Request
+	// close makes the server close the connection after the response,
+	// regardless of what the request asked for
+	close bool
+	// detail explains an error response to the client
+	detail string
 }
 
-func (s *Server) HandleBadRequest() (res *Response) {
-	res = &Response{}
-	res.HandleBadRequest()
-	res.FilePath = ""
+// newResponse is the single place responses are assembled: it sets the
+// status, the connection handling and, for errors, the body.
+func (s *Server) newResponse(statusCode int, opts responseOptions) *Response {
+	res := &Response{}
+	if statusCode == statusOK {
+		res.HandleOK()
+	} else {
+		res.HandleError(statusCode)
+	}
+	res.Request = opts.req
+	if opts.close || (opts.req != nil && opts.req.Close) {
+		res.Headers["Connection"] = "close"
+	}
+	if altSvc := s.altSvc(); altSvc != "" {
+		res.Headers["Alt-Svc"] = altSvc
+	}
+	s.handleErrorBody(res, opts.req, opts.detail)
 	return res
 }
 
-// HTTP/1.1 200 OK
-func (s *Server) HandleGoodRequest() (res *Response) {
-	res = &Response{}
-	res.HandleOK()
-	// res.FilePath = filepath.Join(s.DocRoot, res.Request.URL)
+// handleRequest builds the response to the valid request req.
+func (s *Server) handleRequest(req *Request) *Response {
+	if s.MaxBodyBytes > 0 && req.ContentLength > s.MaxBodyBytes {
+		return s.newResponse(statusContentTooLarge, responseOptions{req: req, close: true, detail: "the request body is too large"})
+	}
+	if res := s.checkQuota(req); res != nil {
+		return res
+	}
+	if s.acmeChallenge(req) {
+		return s.serveACMEChallenge(req)
+	}
+	if req.httpsRedirect != nil {
+		return s.redirectHTTPS(req, req.httpsRedirect)
+	}
+	if s.forwardsProxy(req) {
+		return s.proxy(req)
+	}
+	s.useDefaultHost(req)
+	if s.liveReloadRoute(req) {
+		return s.serveLiveReload(req)
+	}
+	if h := s.handlerFor(req); h != nil && (req.Method == methodGet || req.Method == methodHead || req.Method == methodPost) {
+		return s.runHandler(h, req)
+	}
+	if host, settings, ok := lookupHost(s.hostSettings(), req.Host); ok && len(settings.Upstreams) > 0 {
+		return s.reverseProxy(req, host, settings)
+	}
+
+	switch {
+	case req.Method == methodGet, req.Method == methodHead:
+		// HEAD is answered like GET, without the body
+	case s.WebDAV && req.Method == methodPropfind:
+		return s.handlePropfind(req)
+	case s.WebDAV && req.Method == methodOptions:
+		return s.handleOptions(req)
+	case s.Uploads && req.Method == methodPut:
+		return s.handlePut(req)
+	case s.PostHandler != nil && req.Method == methodPost:
+		return s.runHandler(s.PostHandler, req)
+	default:
+		res := s.newResponse(statusMethodNotAllowed, responseOptions{
+			req:    req,
+			detail: req.Method + " is not allowed for " + req.URL,
+		})
+		res.Headers["Allow"] = s.allowedMethods(req)
+		return res
+	}
 
+	res := s.newResponse(statusOK, responseOptions{req: req})
+	err := s.parseAndGenerateResponse(req, res)
+	if err != nil && !errors.Is(err, errDirectoryForbidden) && s.spaRoute(req) {
+		err = s.spaIndex(req, res)
+	}
+	if errors.Is(err, errDirectoryForbidden) {
+		log.Printf("Forbidden: %v", err)
+		return s.newResponse(statusForbidden, responseOptions{req: req, detail: req.URL + " cannot be listed"})
+	} else if err != nil {
+		log.Printf("Not found: %v", err)
+		return s.newResponse(statusNotFound, responseOptions{req: req, detail: "no resource found at " + req.URL})
+	}
+	if res = s.negotiateCharset(req, res); res.StatusCode != statusOK {
+		return res
+	}
+	s.servePrecompressed(req, res)
+	s.negotiateEncoding(req, res)
+	// evaluated against the validators of the file, which development
+	// mode hides from clients
+	outcome, reason := evalPreconditions(req, res.Headers["ETag"], res.LastModified, s.now())
+	if outcome == preconditionFailed {
+		return s.newResponse(statusPreconditionFailed, responseOptions{req: req, detail: reason})
+	}
+	if s.Dev {
+		s.injectLiveReload(res)
+	}
+	if outcome != preconditionNotModified || s.Dev {
+		// only bodies that are sent are compressed
+		if err := encodeBody(res); err != nil {
+			log.Printf("Failed to compress %v: %v", res.FilePath, err)
+			return s.newResponse(statusInternalServerError, responseOptions{req: req, detail: req.URL + " could not be compressed"})
+		}
+	}
+	if s.ContentDigests {
+		s.addDigest(res)
+	}
+	if s.Dev {
+		disableCaching(res)
+	} else {
+		s.applyCachePolicy(req, res)
+		s.markImmutable(res)
+	}
+	if outcome == preconditionNotModified && !s.Dev {
+		return notModified(res)
+	}
+	if s.acceptsRanges(res) {
+		res.Headers["Accept-Ranges"] = "bytes"
+		if spec, ok := req.Headers[RANGE]; ok && ifRange(req, res.Headers["ETag"], res.LastModified) {
+			return s.handleRange(res, spec)
+		}
+	}
 	return res
 }
 
-// HTTP/1.1 404 Not Found
-func (s *Server) HandleNotFoundRequest() (res *Response) {
-	res = &Response{}
-	res.HandleNotFound()
-	// res.FilePath = filepath.Join(s.DocRoot, "hello-world.txt")
-	res.Headers[CONNECTION] = "close"
-	return res
+// limitRequests makes res, the response to the nth request of its
+// connection, close the connection if that is the last request
+// MaxRequestsPerConn allows, or else tells the client how many are left.
+func (s *Server) limitRequests(res *Response, n int) {
+	if s.MaxRequestsPerConn <= 0 || res.Close() {
+		return
+	}
+	left := s.MaxRequestsPerConn - n
+	if left <= 0 {
+		res.Headers["Connection"] = "close"
+		return
+	}
+	res.Headers["Keep-Alive"] = fmt.Sprintf("timeout=%d, max=%d", int(s.idleTimeout().Seconds()), left)
 }
 
-func ReadRequest(br *bufio.Reader) (req *Request, err error) {
-	req = &Request{}
+// writeResponse stamps res with the server's current time and writes it to
+// conn, logging any failure.
+func (s *Server) writeResponse(conn net.Conn, res *Response) error {
+	res.Date = s.now()
+	s.addHSTS(res)
+	if res.StatusCode >= statusOK && s.conns.closing(netConn(conn)) {
+		// the connection is being drained
+		res.Headers["Connection"] = "close"
+		delete(res.Headers, "Keep-Alive")
+	}
+	start := time.Now()
+	n, err := res.WriteTo(conn)
+	s.accountTransfer(res.Request, n)
+	s.recordDownload(res, n, time.Since(start))
+	if err != nil {
+		log.Printf("Failed to write response to %v: %v", conn.RemoteAddr(), err)
+		return err
+	}
+	return nil
+}
+
+// earlyHints returns the 103 Early Hints response to send ahead of the
+// response to req, or nil when req is not a GET or its host has no hints
+// configured. It only depends on the request, so the hints can go out
+// while the response is still being prepared.
+func (s *Server) earlyHints(req *Request) *Response {
+	if req.Method != methodGet {
+		return nil
+	}
+	_, settings, ok := lookupHost(s.hostSettings(), req.Host)
+	if _, _, known := lookupHost(s.virtualHosts(), req.Host); !ok && !known && s.DefaultHost != "" {
+		// the request will be served by DefaultHost, see useDefaultHost
+		_, settings, _ = lookupHost(s.hostSettings(), normalizeHost(s.DefaultHost))
+	}
+	links := settings.EarlyHints
+	if len(links) == 0 {
+		return nil
+	}
+	hints := &Response{}
+	hints.HandleInformational(statusEarlyHints)
+	hints.Headers["Link"] = strings.Join(links, ", ")
+	return hints
+}
 
+// writeEarlyHints writes the 103 Early Hints interim response for req, if
+// any, and flushes it, so clients can start preloading while the request
+// is handled.
+func (s *Server) writeEarlyHints(conn *pipelinedConn, req *Request) error {
+	hints := s.earlyHints(req)
+	if hints == nil {
+		return nil
+	}
+	if err := s.writeResponse(conn, hints); err != nil {
+		return err
+	}
+	return conn.flush()
+}
+
+// handleErrorBody fills in the body of the error response res according to
+// the server configuration.
+func (s *Server) handleErrorBody(res *Response, req *Request, detail string) {
+	if res.StatusCode < 400 {
+		return
+	}
+	if s.ProblemJSON {
+		if err := res.HandleProblem(req, detail); err != nil {
+			log.Printf("Failed to build problem body: %v", err)
+		}
+		return
+	}
+	res.HandleErrorPage()
+}
+
+// ReadRequest reads the next request from br. Besides the request it returns
+// the number of bytes consumed, so callers can tell an idle connection from
+// one that stalled or was closed in the middle of a request:
+//   - io.EOF: the connection was closed before a request started
+//   - io.ErrUnexpectedEOF: the connection was closed in the middle of a request
+//   - ErrRequestTimeout: the deadline expired in the middle of a request
+//   - a net.Error timeout: the deadline expired before a request started
+//
+// Any other error means the request is malformed.
+func ReadRequest(br *bufio.Reader) (req *Request, n int, err error) {
+	return readRequest(br, requestLimits{})
+}
+
+func readRequest(br *bufio.Reader, limits requestLimits) (req *Request, n int, err error) {
+	req = &Request{}
 	req.init()
 
-	// Read start line
-	// line, err := ReadLine(br)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	var line string
-	for {
-		line, err = ReadLine(br)
-		if errors.Is(err, io.EOF) {
-			return nil, err
+	readLine := func() (string, error) {
+		line, err := readLineLimit(br, limits.maxLineBytes)
+		n += len(line)
+		if err == nil {
+			n += len("\r\n")
+			return line, nil
 		}
-		if err != nil {
-			return req, invalidHeaderError("Error while parsing request ", err.Error())
+		switch {
+		case n > 0 && errors.Is(err, io.EOF):
+			return line, io.ErrUnexpectedEOF
+		case n > 0 && isTimeout(err):
+			return line, fmt.Errorf("%w: %v", ErrRequestTimeout, err)
 		}
-		if line != "" {
-			break
+		return line, err
+	}
+
+	// Read start line, skipping any empty lines preceding it
+	var line string
+	for line == "" {
+		if line, err = readLine(); errors.Is(err, errLineTooLong) {
+			return nil, n, ErrURITooLong
+		} else if err != nil {
+			return nil, n, err
 		}
 	}
+	if hasCTL(line, false) {
+		return nil, n, badRequest(classNotHTTP, badStringError("control character in request line", line))
+	}
 	req.Method, req.URL, req.Proto, err = parseRequestLine(line)
 	if err != nil {
-		fmt.Print("Malformed start line error: ", err.Error())
-		return nil, badStringError("malformed start line", err.Error())
+		return nil, n, badRequest(classRequestLine, badStringError("malformed start line", err.Error()))
 	}
 
 	if !validMethod(req.Method) {
-		return nil, badStringError("invalid method", req.Method)
+		return nil, n, badRequest(classRequestLine, badStringError("invalid method", req.Method))
 	}
 
+	if major, minor, ok := parseHTTPVersion(req.Proto); !ok {
+		return nil, n, badRequest(classRequestLine, badStringError("malformed protocol version", req.Proto))
+	} else if major != 1 || minor != 1 {
+		return nil, n, badRequest(classVersion, fmt.Errorf("%s is not supported, this server speaks %s", req.Proto, responseProto))
+	}
+
+	headers := 0
 	for {
-		line, err := ReadLine(br)
+		line, err := readLine()
+		if errors.Is(err, errLineTooLong) {
+			return nil, n, ErrHeaderTooLarge
+		}
 		if err != nil {
-			return nil, err
+			return nil, n, err
 		}
 		if line == "" {
 			// This marks header end
 			break
 		}
-		if !strings.Contains(line, ":") {
-			return req, invalidHeaderError("InvalidHeader: Header does not contain colon", line)
-		} else {
-			fields := strings.SplitN(line, ":", 2)
-			if len(fields) != 2 {
-				return req, invalidHeaderFieldQuantityMismatchError("InvalidHeader: Header does not contain two colon-separated values %v", line)
-			}
-			key := strings.TrimSpace(fields[0])
-			if strings.Contains(key, " ") {
-				return req, invalidHeaderError("InvalidHeader: key in header has whitespace", line)
-			}
-			value := strings.TrimSpace(fields[1])
-			if strings.Contains(value, " ") {
-				return req, invalidHeaderError("InvalidHeader: value in header has whitespace", line)
-			}
-			req.Headers[strings.ToLower(key)] = strings.ToLower(value)
+		headers++
+		if limits.maxHeaders > 0 && headers > limits.maxHeaders {
+			return nil, n, ErrHeaderTooLarge
+		}
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return req, n, badRequest(classHeader, err)
+		}
+		key = strings.ToLower(key)
+		if _, ok := req.Headers[key]; ok && key == HOST {
+			return req, n, badRequest(classHeader, invalidHeaderError("InvalidHeader: request contains more than one `host` field", line))
 		}
-		// fmt.Println("Read line from request", line)
+		req.addHeader(key, value)
 	}
 
-	return req, nil
+	req.Body = newBodyReader(br, 0)
+	if te, ok := req.Headers[TRANSFER_ENCODING]; ok {
+		// a request with both headers may be framed differently by a
+		// proxy in front of the server: it is refused rather than guessed
+		if _, ok := req.Headers[CONTENT_LENGTH]; ok {
+			return req, n, badRequest(classHeader, invalidHeaderError("InvalidHeader: Transfer-Encoding with Content-Length", te))
+		}
+		if codings := parseTokenList(te); len(codings) != 1 || codings[0] != "chunked" {
+			return req, n, badRequest(classHeader, invalidHeaderError("InvalidHeader: unsupported Transfer-Encoding", te))
+		}
+		req.ContentLength = -1
+		req.Trailers = make(map[string]string)
+		req.Body = newChunkedReader(br, limits, req.Trailers)
+	} else if cl, ok := req.Headers[CONTENT_LENGTH]; ok {
+		length, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || length < 0 {
+			return req, n, badRequest(classHeader, invalidHeaderError("InvalidHeader: malformed Content-Length", cl))
+		}
+		req.ContentLength = length
+		req.Body = newBodyReader(br, length)
+	}
+
+	return req, n, nil
+}
+
+// parseHeaderLine splits the header line "Key: value" into its key and its
+// value stripped of surrounding whitespace.
+func parseHeaderLine(line string) (key string, value string, err error) {
+	if hasCTL(line, true) {
+		return "", "", invalidHeaderError("InvalidHeader: control character in header", line)
+	}
+	if !strings.Contains(line, ":") {
+		return "", "", invalidHeaderError("InvalidHeader: Header does not contain colon", line)
+	}
+	fields := strings.SplitN(line, ":", 2)
+	if len(fields) != 2 {
+		return "", "", invalidHeaderFieldQuantityMismatchError("InvalidHeader: Header does not contain two colon-separated values %v", line)
+	}
+	key = fields[0]
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", invalidHeaderError("InvalidHeader: key in header is empty or has whitespace", line)
+	}
+	// Values may contain whitespace, only the optional leading
+	// and trailing whitespace is not part of the value
+	return key, strings.Trim(fields[1], " \t"), nil
 }
 
 // parseRequestLine parses "GET /foo HTTP/1.1" into its individual parts.
 func parseRequestLine(line string) (string, string, string, error) {
 	fields := strings.SplitN(line, " ", 3)
+	if len(fields) == 2 && strings.HasPrefix(fields[1], "/") {
+		// an HTTP/0.9 simple request, "GET /path", has no version
+		return fields[0], fields[1], "HTTP/0.9", nil
+	}
 	if len(fields) != 3 {
 		return "", "", "", fmt.Errorf("could not parse the request line, got fields %v", fields)
 	}
 	return fields[0], fields[1], fields[2], nil
 }
 
+// hasCTL reports whether line contains a control character, including a
+// bare CR or LF. Horizontal tabs are only accepted when allowTab is set.
+func hasCTL(line string, allowTab bool) bool {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\t' && allowTab {
+			continue
+		}
+		if c < ' ' || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// validMethod reports whether method is one the server knows; it answers
+// those it does not serve with 405. Requests with any other method are
+// rejected as malformed.
 func validMethod(method string) bool {
-	return method == "GET"
+	switch method {
+	case methodGet, methodHead, methodPost, methodPut, methodDelete, methodConnect,
+		methodOptions, methodTrace, methodPatch, methodPropfind:
+		return true
+	}
+	return false
+}
+
+// allowedMethods returns the value of the "Allow" header for the resource
+// req asks for: the methods the server would have served.
+func (s *Server) allowedMethods(req *Request) string {
+	allowed := []string{methodGet, methodHead}
+	if s.handlerFor(req) != nil || s.PostHandler != nil {
+		allowed = append(allowed, methodPost)
+	}
+	if s.Uploads {
+		allowed = append(allowed, methodPut)
+	}
+	if s.WebDAV {
+		allowed = append(allowed, methodOptions, methodPropfind)
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// parseHTTPVersion parses an HTTP-version token, "HTTP/" DIGIT "." DIGIT.
+func parseHTTPVersion(proto string) (major, minor int, ok bool) {
+	if len(proto) != len("HTTP/1.1") || !strings.HasPrefix(proto, "HTTP/") || proto[6] != '.' {
+		return 0, 0, false
+	}
+	if !isDigit(proto[5]) || !isDigit(proto[7]) {
+		return 0, 0, false
+	}
+	return int(proto[5] - '0'), int(proto[7] - '0'), true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
 
 func badStringError(what, val string) error {
@@ -357,38 +1198,77 @@ func invalidHeaderFieldQuantityMismatchError(what, val string) error {
 	return fmt.Errorf("%s %q", what, val)
 }
 
-func (s *Server) parseAndGenerateResponse(req *Request, res *Response) error {
-	res.Request = req
-
-	host := req.Host
-	url := req.URL
-
-	if _, ok := s.VirtualHosts[host]; !ok {
-		return notFoundError("HostNotFoundError: Host not present in DocRoot. Host: ", host)
+// resolvePath maps the target of req to a file or directory under the
+// docroot of its virtual host.
+func (s *Server) resolvePath(req *Request) (string, os.FileInfo, error) {
+	_, docroot, ok := lookupHost(s.virtualHosts(), req.Host)
+	if !ok {
+		return "", nil, notFoundError("HostNotFoundError: Host not present in DocRoot. Host: ", req.Host)
 	}
 
-	filelocation := s.VirtualHosts[req.Host] + "/" + url
+	filelocation, err := docrootPath(docroot, req.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	if uploadArtifact(filepath.Base(filelocation)) {
+		return "", nil, notFoundError("IllegalAccessError: URL naming a partial upload. ", filelocation)
+	}
 	fmt.Printf("Location is: %s\n", filelocation)
 	info, err := os.Stat(filelocation)
-	if os.IsNotExist(err) {
-		res = s.HandleNotFoundRequest()
-		return notFoundError("HostNotFoundError: File Not Found. ", filelocation)
+	if err != nil {
+		return "", nil, notFoundError("HostNotFoundError: File Not Found. ", filelocation)
 	}
-	if !strings.HasPrefix(filelocation, s.DocRoot) {
-		res = s.HandleBadRequest()
-		return notFoundError("IllegalAccessError: URL trying to access files outside of docroot. ", filelocation)
+	if s.DocRoot != "" && !strings.HasPrefix(filelocation, filepath.Clean(s.DocRoot)) {
+		return "", nil, notFoundError("IllegalAccessError: URL trying to access files outside of docroot. ", filelocation)
+	}
+	return filelocation, info, nil
+}
+
+func (s *Server) parseAndGenerateResponse(req *Request, res *Response) error {
+	res.Request = req
+
+	filelocation, info, err := s.resolvePath(req)
+	if err != nil {
+		return err
 	}
 	if info.IsDir() {
-		filelocation = filelocation + "index.html"
+		// only "dir/" names the index of dir, so relative links in it work
+		urlPath, _ := cleanURLPath(req.URL)
+		if !strings.HasSuffix(urlPath, "/") {
+			return notFoundError("HostNotFoundError: directory requested without a trailing slash. ", filelocation)
+		}
+		dir, dirInfo := filelocation, info
+		filelocation = filepath.Join(filelocation, "index.html")
 		fmt.Print("Given directory, appending index.html ", filelocation)
 		info, err = os.Stat(filelocation)
+		if err != nil {
+			return s.missingIndex(req, res, urlPath, dir, dirInfo)
+		}
 	}
-	res.Headers["Content-Length"] = fmt.Sprint(info.Size())
-	res.Headers["Last-Modified"] = fmt.Sprintf(FormatTime(info.ModTime()))
+	res.ContentLength = info.Size()
+	res.LastModified = info.ModTime()
 	res.Headers["Content-Type"] = MIMETypeByExtension(filepath.Ext(filelocation))
 	res.FilePath = filelocation
-	body, err := os.ReadFile(filelocation)
-	res.Body = string(body)
+	if etag := s.fileETagFor(req, filelocation, info); etag != "" {
+		res.Headers["ETag"] = etag
+	}
 
 	return nil
 }
+
+// missingIndex answers req for dir, a directory without index.html served
+// at urlPath, as the MissingIndex setting of its virtual host says.
+func (s *Server) missingIndex(req *Request, res *Response, urlPath, dir string, info os.FileInfo) error {
+	_, settings, _ := lookupHost(s.hostSettings(), req.Host)
+	switch settings.MissingIndex {
+	case MissingIndexAutoIndex:
+		if err := res.autoIndex(urlPath, dir); err != nil {
+			return err
+		}
+		res.LastModified = info.ModTime()
+		return nil
+	case MissingIndexForbidden:
+		return fmt.Errorf("%w: %q", errDirectoryForbidden, dir)
+	}
+	return notFoundError("HostNotFoundError: File Not Found. ", filepath.Join(dir, "index.html"))
+}
@@ -0,0 +1,519 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestServer() *Server {
+	return &Server{
+		DocRoot: "../docroot_dirs",
+		VirtualHosts: map[string]string{
+			"website1": "../docroot_dirs/htdocs1",
+		},
+	}
+}
+
+// serveRaw feeds raw to s.HandleConnection over an in-memory connection and
+// returns everything the server wrote back before closing the connection.
+func serveRaw(t *testing.T, s *Server, raw string) string {
+	client, server := net.Pipe()
+	go s.HandleConnection(server)
+	go func() {
+		_, _ = client.Write([]byte(raw))
+	}()
+	out, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	client.Close()
+	return string(out)
+}
+
+// fakeDeadlines drives the idle timeouts of a server through its
+// setReadDeadline hook: time only passes when advance is called, and armed
+// receives whenever the server sets a deadline.
+type fakeDeadlines struct {
+	mu        sync.Mutex
+	now       time.Duration
+	deadlines map[net.Conn]time.Duration
+	armed     chan struct{}
+}
+
+func newFakeDeadlines(s *Server) *fakeDeadlines {
+	f := &fakeDeadlines{deadlines: map[net.Conn]time.Duration{}, armed: make(chan struct{}, 64)}
+	s.setReadDeadline = f.set
+	return f
+}
+
+func (f *fakeDeadlines) set(conn net.Conn, d time.Duration) error {
+	f.mu.Lock()
+	f.deadlines[conn] = f.now + d
+	err := conn.SetReadDeadline(time.Time{})
+	f.mu.Unlock()
+	f.armed <- struct{}{}
+	return err
+}
+
+// wait waits for the server to set n more deadlines.
+func (f *fakeDeadlines) wait(n int) {
+	for ; n > 0; n-- {
+		<-f.armed
+	}
+}
+
+// advance moves time forward by d, making the reads of every connection
+// whose deadline has passed time out.
+func (f *fakeDeadlines) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now += d
+	for conn, deadline := range f.deadlines {
+		if deadline <= f.now {
+			_ = conn.SetReadDeadline(time.Unix(1, 0))
+			delete(f.deadlines, conn)
+		}
+	}
+}
+
+// serveClient runs s.HandleConnection over an in-memory connection while
+// script plays the client, and returns everything the server wrote back
+// before closing the connection.
+func serveClient(t *testing.T, s *Server, script func(client net.Conn)) string {
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.HandleConnection(server)
+	go script(client)
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(client)
+		out <- b
+	}()
+	select {
+	case b := <-out:
+		return string(b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The connection was not closed")
+		return ""
+	}
+}
+
+func parseResponse(t *testing.T, raw string) *http.Response {
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatalf("got an error parsing the response: %v\n", err.Error())
+	}
+	return resp
+}
+
+func TestProblemJSONBadRequest(t *testing.T) {
+	s := newTestServer()
+	s.ProblemJSON = true
+
+	resp := parseResponse(t, serveRaw(t, s, "foobar\r\nHost: website1\r\n\r\n"))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 400 {
+		t.Fatalf("Expected response code of 400 but got: %v\n", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("Expected Content-Type of %v but got %v\n", problemContentType, ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("Error decoding problem body: %v\n", err.Error())
+	}
+	if p.Status != 400 || p.Title != "Bad Request" || p.Type != problemTypeBlank {
+		t.Fatalf("Unexpected problem body: %+v\n", p)
+	}
+	if p.RequestID == "" {
+		t.Fatal("Problem body is missing a request id")
+	}
+}
+
+func TestDefaultErrorPage(t *testing.T) {
+	s := newTestServer()
+
+	resp := parseResponse(t, serveRaw(t, s, "GET /missing.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expected response code of 404 but got: %v\n", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("Expected an HTML Content-Type but got %v\n", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v\n", err.Error())
+	}
+	if int64(len(body)) != resp.ContentLength || !strings.Contains(string(body), "404 Not Found") {
+		t.Fatalf("Unexpected error page (Content-Length %v): %q\n", resp.ContentLength, body)
+	}
+}
+
+// scriptedConn is a net.Conn that reads from r and records everything
+// written to it.
+type scriptedConn struct {
+	net.Conn
+	r      io.Reader
+	out    bytes.Buffer
+	closed bool
+}
+
+func (c *scriptedConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c *scriptedConn) Write(p []byte) (int, error)        { return c.out.Write(p) }
+func (c *scriptedConn) Close() error                       { c.closed = true; return nil }
+func (c *scriptedConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+func (c *scriptedConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)} }
+func (c *scriptedConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *scriptedConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestHandleConnectionOutcomes(t *testing.T) {
+	const good = "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n"
+	tests := []struct {
+		name  string
+		r     io.Reader
+		codes []int
+	}{
+		{"clean close", strings.NewReader(""), nil},
+		{"close after request", strings.NewReader(good), []int{200}},
+		{"idle timeout", &stalledReader{}, nil},
+		{"idle timeout after request", &stalledReader{good}, []int{200}},
+		{"keep-alive", strings.NewReader(good + "GET /nope HTTP/1.1\r\nHost: website1\r\n\r\n" + good), []int{200, 404, 200}},
+		{"connection close", strings.NewReader("GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n" + good), []int{200}},
+
+		// one row per badRequestClass, each followed by a good request
+		// that is only answered when the connection survives
+		{"not http", strings.NewReader("\x16\x03\x01\x02\x00\x01\r\n\r\n" + good), nil},
+		{"malformed request line", strings.NewReader("foobar\r\n\r\n" + good), []int{400}},
+		{"relative target", strings.NewReader("GET index.html HTTP/1.1\r\nHost: website1\r\n\r\n" + good), []int{400}},
+		{"unsupported version", strings.NewReader("GET / HTTP/1.0\r\nHost: website1\r\n\r\n" + good), []int{505}},
+		{"http/2.0", strings.NewReader("GET / HTTP/2.0\r\nHost: website1\r\n\r\n" + good), []int{505}},
+		{"http/0.9", strings.NewReader("GET /\r\n\r\n" + good), []int{505}},
+		{"malformed version", strings.NewReader("GET / HTTP/one\r\nHost: website1\r\n\r\n" + good), []int{400}},
+		{"malformed header", strings.NewReader("GET / HTTP/1.1\r\nHost website1\r\n\r\n" + good), []int{400}},
+		{"duplicate host", strings.NewReader("GET / HTTP/1.1\r\nHost: website1\r\nHost: website2\r\n\r\n" + good), []int{400}},
+		{"missing host", strings.NewReader("GET / HTTP/1.1\r\n\r\n" + good), []int{400, 200}},
+		{"long request line", strings.NewReader("GET /" + strings.Repeat("a", DefaultMaxHeaderLineBytes) + " HTTP/1.1\r\n\r\n" + good), []int{414}},
+		{"long header line", strings.NewReader("GET / HTTP/1.1\r\nHost: website1\r\nX-Big: " + strings.Repeat("a", DefaultMaxHeaderLineBytes) + "\r\n\r\n" + good), []int{431}},
+		{"too many headers", strings.NewReader("GET / HTTP/1.1\r\nHost: website1\r\n" + strings.Repeat("X-A: 1\r\n", DefaultMaxHeaderCount) + "\r\n" + good), []int{431}},
+		{"partial timeout", &stalledReader{"GET / HTTP/1.1\r\n"}, []int{408}},
+		{"truncated request", strings.NewReader("GET /index.html HTTP/1.1\r\nHo"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &scriptedConn{r: tt.r}
+			newTestServer().HandleConnection(conn)
+
+			if !conn.closed {
+				t.Fatal("Connection was not closed")
+			}
+			br := bufio.NewReader(&conn.out)
+			for _, code := range tt.codes {
+				resp, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatalf("got an error parsing the response: %v\n", err.Error())
+				}
+				if resp.StatusCode != code {
+					t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if br.Buffered() > 0 || conn.out.Len() > 0 {
+				t.Fatalf("Unexpected trailing output after %d responses\n", len(tt.codes))
+			}
+		})
+	}
+}
+
+func TestFrozenClock(t *testing.T) {
+	s := newTestServer()
+	s.Now = func() time.Time { return time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC) }
+
+	conn := &scriptedConn{r: strings.NewReader("GET /missing.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")}
+	s.HandleConnection(conn)
+
+	want := "HTTP/1.1 404 Not Found\r\n" +
+		"Connection: close\r\n" +
+		"Content-Length: 134\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"Date: Wed, 01 Feb 2023 12:30:00 GMT\r\n" +
+		"\r\n"
+	if got := conn.out.String(); !strings.HasPrefix(got, want) {
+		t.Fatalf("Unexpected response:\n%q\nwant prefix:\n%q\n", got, want)
+	}
+}
+
+func TestFrozenClockDeadlines(t *testing.T) {
+	s := newTestServer()
+	// a clock frozen in the past must not expire the connection deadlines
+	s.Now = func() time.Time { return time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC) }
+
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Date"); got != "Wed, 01 Feb 2023 12:30:00 GMT" {
+		t.Fatalf("Expected the frozen Date but got %q\n", got)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		armed int
+		codes []int
+	}{
+		{"idle", "", 2, nil},
+		{"idle after request", "GET / HTTP/1.1\r\nHost: website1\r\n\r\n", 3, []int{200}},
+		{"slow client", "GET / HTTP/1.1\r\nHost: web", 2, []int{408}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			deadlines := newFakeDeadlines(s)
+			resp := serveClient(t, s, func(client net.Conn) {
+				if tt.raw != "" {
+					_, _ = io.WriteString(client, tt.raw)
+				}
+				// the server has read everything once it sets the
+				// deadline of the next read
+				deadlines.wait(tt.armed)
+				deadlines.advance(s.idleTimeout())
+			})
+			br := bufio.NewReader(strings.NewReader(resp))
+			for _, code := range tt.codes {
+				resp, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatalf("got an error parsing the response: %v\n", err.Error())
+				}
+				if resp.StatusCode != code {
+					t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+			}
+			if br.Buffered() > 0 {
+				t.Fatalf("Unexpected trailing output after %d responses\n", len(tt.codes))
+			}
+		})
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"website1": {EarlyHints: []string{"</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"}},
+	}
+
+	conn := &scriptedConn{r: strings.NewReader("GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n" +
+		"GET /missing.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")}
+	s.HandleConnection(conn)
+
+	br := bufio.NewReader(&conn.out)
+	// the hints go out before the file is looked up, so a 404 gets them too
+	for _, code := range []int{103, 200, 103, 404} {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("got an error parsing the response: %v\n", err.Error())
+		}
+		if resp.StatusCode != code {
+			t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+		}
+		if link := resp.Header.Get("Link"); (code == 103) != (link != "") {
+			t.Fatalf("Unexpected Link header %q on a %v response\n", link, code)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+	if br.Buffered() > 0 || conn.out.Len() > 0 {
+		t.Fatal("Unexpected trailing output")
+	}
+}
+
+func TestEarlyHintsBeforeHandler(t *testing.T) {
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"website1": {EarlyHints: []string{"</style.css>; rel=preload; as=style"}},
+	}
+	hinted := make(chan struct{})
+	s.HandleFunc("/slow", func(req *Request) *Response {
+		// the client must have the hints while the response is prepared
+		<-hinted
+		res := &Response{}
+		res.HandleOK()
+		res.SetBody("text/plain", "done")
+		return res
+	})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.HandleConnection(server)
+	go func() {
+		_, _ = client.Write([]byte("GET /slow HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	}()
+	br := bufio.NewReader(client)
+	for _, code := range []int{103, 200} {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("got an error parsing the response: %v\n", err.Error())
+		}
+		if resp.StatusCode != code {
+			t.Fatalf("Expected response code of %v but got: %v\n", code, resp.StatusCode)
+		}
+		if code == 103 {
+			close(hinted)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+}
+
+func TestVaryOn(t *testing.T) {
+	s := newTestServer()
+	s.HandleFunc("/greeting", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		if strings.HasPrefix(req.VaryOn("Accept-Language"), "fr") {
+			res.SetBody("text/plain", "bonjour")
+		} else {
+			res.SetBody("text/plain", "hello")
+		}
+		res.AddVary("X-Tenant")
+		return res
+	})
+	resp := parseResponse(t, serveRaw(t, s, "GET /greeting HTTP/1.1\r\nHost: website1\r\nAccept-Language: fr\r\nConnection: close\r\n\r\n"))
+	if vary := resp.Header.Get("Vary"); vary != "X-Tenant, Accept-Language" {
+		t.Fatalf("Unexpected Vary %q\n", vary)
+	}
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	s := newTestServer()
+	s.MaxRequestsPerConn = 2
+	request := "GET /index.html HTTP/1.1\r\nHost: website1\r\n\r\n"
+	conn := &scriptedConn{r: strings.NewReader(strings.Repeat(request, 3))}
+	s.HandleConnection(conn)
+
+	br := bufio.NewReader(strings.NewReader(conn.out.String()))
+	tests := []struct {
+		keepAlive string
+		close     bool
+	}{
+		{"timeout=5, max=1", false},
+		{"", true},
+	}
+	for i, tt := range tests {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Error reading response %d: %v\n", i+1, err.Error())
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.Header.Get("Keep-Alive") != tt.keepAlive || resp.Close != tt.close {
+			t.Fatalf("Expected Keep-Alive %q and close %v for response %d but got: %q, %v\n", tt.keepAlive, tt.close, i+1, resp.Header.Get("Keep-Alive"), resp.Close)
+		}
+	}
+	if _, err := br.Peek(1); err != io.EOF {
+		t.Fatalf("Expected no response to the third request\n")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	s := newTestServer()
+	s.Uploads = true
+	s.HandleFunc("/form", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		return res
+	})
+	tests := []struct {
+		request string
+		code    int
+		allow   string
+	}{
+		{"DELETE /index.html HTTP/1.1", 405, "GET, HEAD, PUT"},
+		{"PATCH /form HTTP/1.1", 405, "GET, HEAD, POST, PUT"},
+		{"BREW /index.html HTTP/1.1", 400, ""},
+		{"get /index.html HTTP/1.1", 400, ""},
+	}
+	for _, tt := range tests {
+		conn := &scriptedConn{r: strings.NewReader(tt.request + "\r\nHost: website1\r\n\r\nGET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")}
+		s.HandleConnection(conn)
+		br := bufio.NewReader(strings.NewReader(conn.out.String()))
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Error reading response to %q: %v\n", tt.request, err.Error())
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode != tt.code || resp.Header.Get("Allow") != tt.allow {
+			t.Fatalf("Expected %v with Allow %q for %q but got: %v %q\n", tt.code, tt.allow, tt.request, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+		// a 405 keeps the connection open, a malformed request does not
+		if _, err := http.ReadResponse(br, nil); (err == nil) != (tt.code == 405) {
+			t.Fatalf("Expected the connection to stay open after %q: %v, but got: %v\n", tt.request, tt.code == 405, err)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	s := newTestServer()
+	s.HandleFunc("/form", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		res.SetBody("text/plain", "handled")
+		return res
+	})
+	get := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	tests := []struct {
+		url    string
+		code   int
+		length string
+	}{
+		{"/index.html", 200, get.Header.Get("Content-Length")},
+		{"/form", 200, "7"},
+		{"/missing.html", 404, ""},
+	}
+	for _, tt := range tests {
+		// the GET after the HEAD only parses if the HEAD response has no
+		// body
+		out := serveRaw(t, s, "HEAD "+tt.url+" HTTP/1.1\r\nHost: website1\r\n\r\nGET /missing.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+		br := bufio.NewReader(strings.NewReader(out))
+		resp, err := http.ReadResponse(br, &http.Request{Method: "HEAD"})
+		if err != nil {
+			t.Fatalf("Error reading response to HEAD %v: %v\n", tt.url, err.Error())
+		}
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for HEAD %v but got: %v\n", tt.code, tt.url, resp.StatusCode)
+		}
+		if tt.length != "" && resp.Header.Get("Content-Length") != tt.length {
+			t.Fatalf("Expected Content-Length %v for HEAD %v but got: %v\n", tt.length, tt.url, resp.Header.Get("Content-Length"))
+		}
+		next, err := http.ReadResponse(br, nil)
+		if err != nil || next.StatusCode != 404 {
+			t.Fatalf("Expected the next response to be 404 after HEAD %v: %v\n", tt.url, err)
+		}
+	}
+}
+
+func TestHTTPVersionNotSupported(t *testing.T) {
+	for _, line := range []string{"GET /index.html HTTP/2.0", "GET /index.html"} {
+		resp := parseResponse(t, serveRaw(t, newTestServer(), line+"\r\nHost: website1\r\n\r\n"))
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 505 {
+			t.Fatalf("Expected response code of 505 for %q but got: %v\n", line, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), "HTTP/1.1") {
+			t.Fatalf("Expected the body to name HTTP/1.1 but got: %q\n", body)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package tritonhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long a session lasts without being saved again,
+// when Sessions.TTL is not set.
+const DefaultSessionTTL = 24 * time.Hour
+
+// A Session is the state kept for one client between requests, e.g. who is
+// logged in.
+type Session struct {
+	ID      string
+	Values  map[string]string
+	Expires time.Time
+}
+
+func (sess *Session) clone() *Session {
+	c := &Session{ID: sess.ID, Expires: sess.Expires, Values: make(map[string]string, len(sess.Values))}
+	for k, v := range sess.Values {
+		c.Values[k] = v
+	}
+	return c
+}
+
+// A SessionStore keeps sessions by ID. Implement it to keep sessions
+// somewhere else than in memory, e.g. to share them between servers.
+type SessionStore interface {
+	// Load returns the session with the given ID, or nil if there is no
+	// such session or it expired.
+	Load(id string) (*Session, error)
+	// Save creates or replaces a session.
+	Save(sess *Session) error
+	// Delete removes a session, if it exists.
+	Delete(id string) error
+}
+
+// MemoryStore is a SessionStore in memory. Expired sessions are dropped.
+type MemoryStore struct {
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func (m *MemoryStore) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *MemoryStore) Load(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if !m.now().Before(sess.Expires) {
+		delete(m.sessions, id)
+		return nil, nil
+	}
+	// callers get their own copy, so concurrent requests of the same
+	// client don't share a map
+	return sess.clone(), nil
+}
+
+func (m *MemoryStore) Save(sess *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]*Session)
+	}
+	now := m.now()
+	for id, s := range m.sessions {
+		if !now.Before(s.Expires) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[sess.ID] = sess.clone()
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Sessions ties sessions to clients with a cookie. Handlers call Get to
+// find the session of a request, and Save or Destroy to update it along
+// with their response.
+type Sessions struct {
+	// Store keeps the sessions. Nil means a MemoryStore.
+	Store SessionStore
+	// CookieName is the name of the session cookie. Defaults to "session".
+	CookieName string
+	// TTL is how long a session lasts after it was last saved. Zero means
+	// DefaultSessionTTL.
+	TTL time.Duration
+	// Secure restricts the session cookie to HTTPS.
+	Secure bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	once sync.Once
+}
+
+func (sm *Sessions) init() {
+	sm.once.Do(func() {
+		if sm.Store == nil {
+			sm.Store = &MemoryStore{Now: sm.Now}
+		}
+	})
+}
+
+func (sm *Sessions) cookieName() string {
+	if sm.CookieName == "" {
+		return "session"
+	}
+	return sm.CookieName
+}
+
+func (sm *Sessions) ttl() time.Duration {
+	if sm.TTL == 0 {
+		return DefaultSessionTTL
+	}
+	return sm.TTL
+}
+
+func (sm *Sessions) now() time.Time {
+	if sm.Now != nil {
+		return sm.Now()
+	}
+	return time.Now()
+}
+
+// Get returns the session of req. A request without a valid session gets a
+// new, empty one, which only lasts if it is saved.
+func (sm *Sessions) Get(req *Request) (*Session, error) {
+	sm.init()
+	if c, ok := req.Cookie(sm.cookieName()); ok {
+		sess, err := sm.Store.Load(c.Value)
+		if err != nil {
+			return nil, err
+		}
+		if sess != nil {
+			return sess, nil
+		}
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ID: id, Values: make(map[string]string)}, nil
+}
+
+// Save stores sess, extending its lifetime by TTL, and sets the session
+// cookie on res.
+func (sm *Sessions) Save(res *Response, sess *Session) error {
+	sm.init()
+	sess.Expires = sm.now().Add(sm.ttl())
+	if err := sm.Store.Save(sess); err != nil {
+		return err
+	}
+	return res.SetCookie(&Cookie{
+		Name:     sm.cookieName(),
+		Value:    sess.ID,
+		Path:     "/",
+		Expires:  sess.Expires,
+		HttpOnly: true,
+		Secure:   sm.Secure,
+		SameSite: SameSiteLax,
+	})
+}
+
+// Destroy deletes sess and tells the client to drop its cookie, e.g. on
+// logout.
+func (sm *Sessions) Destroy(res *Response, sess *Session) error {
+	sm.init()
+	if err := sm.Store.Delete(sess.ID); err != nil {
+		return err
+	}
+	return res.SetCookie(&Cookie{Name: sm.cookieName(), Path: "/", MaxAge: -1})
+}
+
+// newSessionID returns a random, unguessable session ID.
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,75 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2023, time.February, 1, 12, 0, 0, 0, time.UTC)
+	sessions := &Sessions{TTL: time.Hour, Now: func() time.Time { return now }}
+
+	s := newTestServer()
+	s.HandleFunc("/login", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		sess, err := sessions.Get(req)
+		if err != nil {
+			res.HandleError(statusInternalServerError)
+			return res
+		}
+		sess.Values["user"] = "ann"
+		if err := sessions.Save(res, sess); err != nil {
+			res.HandleError(statusInternalServerError)
+		}
+		return res
+	})
+	s.HandleFunc("/whoami", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		sess, err := sessions.Get(req)
+		if err != nil {
+			res.HandleError(statusInternalServerError)
+			return res
+		}
+		res.SetBody("text/plain", sess.Values["user"])
+		return res
+	})
+
+	do := func(raw string) *http.Response {
+		conn := &scriptedConn{r: strings.NewReader(raw)}
+		s.HandleConnection(conn)
+		resp, err := http.ReadResponse(bufio.NewReader(&conn.out), nil)
+		if err != nil {
+			t.Fatalf("got an error parsing the response: %v\n", err.Error())
+		}
+		return resp
+	}
+	whoami := func(cookie string) string {
+		resp := do("GET /whoami HTTP/1.1\r\nHost: website1\r\nCookie: " + cookie + "\r\nConnection: close\r\n\r\n")
+		var sb strings.Builder
+		_, _ = bufio.NewReader(resp.Body).WriteTo(&sb)
+		return sb.String()
+	}
+
+	login := do("GET /login HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+	cookies := login.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || !cookies[0].HttpOnly {
+		t.Fatalf("Unexpected session cookie: %v\n", login.Header["Set-Cookie"])
+	}
+	cookie := "session=" + cookies[0].Value
+
+	if user := whoami(cookie); user != "ann" {
+		t.Fatalf("Expected the session of ann but got %q\n", user)
+	}
+	if user := whoami("session=forged"); user != "" {
+		t.Fatalf("A forged session id was accepted: %q\n", user)
+	}
+	now = now.Add(2 * time.Hour)
+	if user := whoami(cookie); user != "" {
+		t.Fatalf("An expired session was accepted: %q\n", user)
+	}
+}
@@ -0,0 +1,248 @@
+package tritonhttp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownGrace is the grace period tritonhttpd gives in-flight
+// requests when it is stopped.
+const DefaultShutdownGrace = 10 * time.Second
+
+// ShutdownSummary tells how the connections open when Shutdown was called
+// ended.
+type ShutdownSummary struct {
+	// Drained counts the connections that were idle, or finished their
+	// request within the grace period
+	Drained int
+	// Aborted counts the connections closed in the middle of a request
+	// when the grace period ran out
+	Aborted int
+}
+
+// DrainStatus reports the progress of a graceful shutdown.
+type DrainStatus struct {
+	// Draining is set once the connections are being drained
+	Draining bool `json:"draining"`
+	// Started is when draining started, and Deadline when the connections
+	// left are closed
+	Started  time.Time `json:"started,omitempty"`
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Connections counts the connections open when draining started
+	Connections int `json:"connections"`
+	// Remaining counts those still open, of which Active are handling a
+	// request
+	Remaining int `json:"remaining"`
+	Active    int `json:"active"`
+	// Drained and Aborted count the connections closed so far, as in
+	// ShutdownSummary
+	Drained int `json:"drained"`
+	Aborted int `json:"aborted"`
+}
+
+// trackedConn is the state of an open connection.
+type trackedConn struct {
+	// ln is the listener the connection was accepted on, nil when it was
+	// passed to HandleConnection
+	ln net.Listener
+	// active is set while the connection handles a request, rather than
+	// waiting for the next one
+	active bool
+	// closing is set once the connection is drained: its next response
+	// closes it
+	closing bool
+}
+
+// drainGroup is a set of connections being drained together.
+type drainGroup struct {
+	// conns holds the connections of the group still open
+	conns   map[net.Conn]struct{}
+	drained int
+	aborted int
+	// done is closed when conns empties
+	done chan struct{}
+}
+
+// connTracker tracks the open connections of a server.
+type connTracker struct {
+	mu       sync.Mutex
+	conns    map[net.Conn]*trackedConn
+	shutdown bool
+	// drains holds the drains in progress, and status and shutdownDrain
+	// describe the one of Shutdown
+	drains        map[*drainGroup]struct{}
+	status        DrainStatus
+	shutdownDrain *drainGroup
+}
+
+// add tracks conn, accepted on ln, as idle, unless the server is shutting
+// down.
+func (t *connTracker) add(conn net.Conn, ln net.Listener) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.shutdown {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]*trackedConn)
+	}
+	t.conns[conn] = &trackedConn{ln: ln}
+	return true
+}
+
+// remove stops tracking conn, which was closed.
+func (t *connTracker) remove(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+	for g := range t.drains {
+		if _, ok := g.conns[conn]; !ok {
+			continue
+		}
+		delete(g.conns, conn)
+		g.drained++
+		if len(g.conns) == 0 {
+			close(g.done)
+		}
+	}
+}
+
+// active marks conn as handling a request.
+func (t *connTracker) active(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.conns[conn]; ok {
+		c.active = true
+	}
+}
+
+// idle marks conn as waiting for its next request. It reports false if
+// conn is being drained, and must not read another request.
+func (t *connTracker) idle(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.conns[conn]
+	if !ok {
+		return false
+	}
+	c.active = false
+	return !c.closing
+}
+
+// closing reports whether conn is being drained, so the response being
+// written is its last and must say "Connection: close".
+func (t *connTracker) closing(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.conns[conn]
+	return ok && c.closing
+}
+
+// startDrainLocked starts draining the connections match selects: idle ones
+// are closed, the others close after their current request. t.mu must be
+// held.
+func (t *connTracker) startDrainLocked(match func(c *trackedConn) bool) *drainGroup {
+	g := &drainGroup{conns: make(map[net.Conn]struct{}), done: make(chan struct{})}
+	for conn, c := range t.conns {
+		if !match(c) {
+			continue
+		}
+		c.closing = true
+		g.conns[conn] = struct{}{}
+		if !c.active {
+			conn.Close()
+		}
+	}
+	if len(g.conns) == 0 {
+		close(g.done)
+	}
+	if t.drains == nil {
+		t.drains = make(map[*drainGroup]struct{})
+	}
+	t.drains[g] = struct{}{}
+	return g
+}
+
+// wait waits for up to grace for the connections of g to close, closes
+// those left, and returns how they ended.
+func (t *connTracker) wait(g *drainGroup, grace time.Duration) ShutdownSummary {
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-g.done:
+	case <-timer.C:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conn := range g.conns {
+		conn.Close()
+		delete(g.conns, conn)
+		g.aborted++
+	}
+	delete(t.drains, g)
+	return ShutdownSummary{Drained: g.drained, Aborted: g.aborted}
+}
+
+// drain drains the connections match selects within grace.
+func (t *connTracker) drain(match func(c *trackedConn) bool, grace time.Duration) ShutdownSummary {
+	t.mu.Lock()
+	g := t.startDrainLocked(match)
+	t.mu.Unlock()
+	return t.wait(g, grace)
+}
+
+// drainStatus returns the progress of the drain of Shutdown.
+func (t *connTracker) drainStatus() DrainStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	if g := t.shutdownDrain; g != nil {
+		status.Remaining = len(g.conns)
+		for conn := range g.conns {
+			if t.conns[conn] != nil && t.conns[conn].active {
+				status.Active++
+			}
+		}
+		status.Drained, status.Aborted = g.drained, g.aborted
+	}
+	return status
+}
+
+// Ready reports whether the server takes new traffic: it stops being
+// ready as soon as Shutdown is called, DrainDelay before it stops serving.
+func (s *Server) Ready() bool {
+	return !s.draining.Load()
+}
+
+// DrainStatus reports the progress of Shutdown.
+func (s *Server) DrainStatus() DrainStatus {
+	return s.conns.drainStatus()
+}
+
+// Shutdown stops the server gracefully. It first reports the server as not
+// Ready, while still serving, for DrainDelay. It then closes the listeners,
+// like Close, and drains the connections: idle ones are closed, and those
+// handling a request get to finish it within grace, the response saying
+// "Connection: close". The connections still open after that are closed.
+// The HTTP/3 server, if any, is shut down alongside within grace.
+func (s *Server) Shutdown(grace time.Duration) ShutdownSummary {
+	if !s.draining.Swap(true) && s.DrainDelay > 0 {
+		// let load balancers notice the failing readiness checks and
+		// send new requests elsewhere
+		time.Sleep(s.DrainDelay)
+	}
+	defer s.shutdownHTTP3(grace)()
+	s.stopListening()
+
+	t := &s.conns
+	t.mu.Lock()
+	t.shutdown = true
+	now := time.Now()
+	t.status = DrainStatus{Draining: true, Started: now, Deadline: now.Add(grace), Connections: len(t.conns)}
+	g := t.startDrainLocked(func(*trackedConn) bool { return true })
+	t.shutdownDrain = g
+	t.mu.Unlock()
+	return t.wait(g, grace)
+}
@@ -0,0 +1,158 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	s := newTestServer()
+	release := make(chan struct{})
+	s.HandleFunc("/slow", func(req *Request) *Response {
+		<-release
+		res := &Response{}
+		res.HandleOK()
+		return res
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	go s.Serve(ln)
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Error dialing: %v\n", err.Error())
+		}
+		return conn
+	}
+	idle := dial()
+	defer idle.Close()
+	busy := dial()
+	defer busy.Close()
+	if _, err := busy.Write([]byte("GET /slow HTTP/1.1\r\nHost: website1\r\n\r\n")); err != nil {
+		t.Fatalf("Error writing request: %v\n", err.Error())
+	}
+	// wait for both connections to be accepted and the request read
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.conns.mu.Lock()
+		active := 0
+		for _, c := range s.conns.conns {
+			if c.active {
+				active++
+			}
+		}
+		n := len(s.conns.conns)
+		s.conns.mu.Unlock()
+		if n == 2 && active == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected an idle and an active connection\n")
+		}
+	}
+
+	summary := make(chan ShutdownSummary)
+	go func() {
+		summary <- s.Shutdown(5 * time.Second)
+	}()
+	// the idle connection is closed at once, the busy one is waited for
+	want := DrainStatus{Draining: true, Connections: 2, Remaining: 1, Active: 1, Drained: 1}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		status := s.DrainStatus()
+		status.Started, status.Deadline = time.Time{}, time.Time{}
+		if status == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected drain status %+v but got: %+v\n", want, status)
+		}
+	}
+	close(release)
+	if got := <-summary; got != (ShutdownSummary{Drained: 2}) {
+		t.Fatalf("Expected both connections to drain but got: %+v\n", got)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(busy), nil)
+	if err != nil {
+		t.Fatalf("Expected the in-flight request to be answered but got: %v\n", err.Error())
+	}
+	if resp.StatusCode != 200 || !resp.Close {
+		t.Fatalf("Expected response code of 200 with Connection: close but got: %v, close %v\n", resp.StatusCode, resp.Close)
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatalf("Expected the listener to be closed\n")
+	}
+}
+
+func TestShutdownAborts(t *testing.T) {
+	s := newTestServer()
+	release := make(chan struct{})
+	defer close(release)
+	s.HandleFunc("/stuck", func(req *Request) *Response {
+		<-release
+		return &Response{}
+	})
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.HandleConnection(server)
+	go func() {
+		_, _ = client.Write([]byte("GET /stuck HTTP/1.1\r\nHost: website1\r\n\r\n"))
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.conns.mu.Lock()
+		active := s.conns.conns[server] != nil && s.conns.conns[server].active
+		s.conns.mu.Unlock()
+		if active {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the request to be read\n")
+		}
+	}
+	if summary := s.Shutdown(50 * time.Millisecond); summary != (ShutdownSummary{Aborted: 1}) {
+		t.Fatalf("Expected the stuck connection to be aborted but got: %+v\n", summary)
+	}
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	s := newTestServer()
+	s.DrainDelay = 200 * time.Millisecond
+	s.HandleAdmin("/_admin/")
+	ready := func(want int, body string) {
+		t.Helper()
+		resp := parseResponse(t, serveRaw(t, s, "GET /_admin/ready HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		got, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("Expected response code of %v but got: %v\n", want, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != jsonContentType || !strings.Contains(string(got), body) {
+			t.Fatalf("Expected a JSON body containing %q but got %q: %q\n", body, ct, got)
+		}
+	}
+	ready(200, `"ready": true`)
+
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown(time.Second)
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); s.Ready(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to stop being ready\n")
+		}
+	}
+	// still serving, but failing the readiness check
+	ready(503, `"ready": false`)
+	select {
+	case <-done:
+		t.Fatalf("Expected Shutdown to wait for the drain delay\n")
+	default:
+	}
+	<-done
+}
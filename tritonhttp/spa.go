@@ -0,0 +1,28 @@
+package tritonhttp
+
+import "path"
+
+// spaRoute reports whether req, which names no file, is a client-side route
+// of a single-page application: its virtual host has SPA set and the last
+// segment of its path has no file extension, so it is not a missing asset.
+func (s *Server) spaRoute(req *Request) bool {
+	_, settings, _ := lookupHost(s.hostSettings(), req.Host)
+	if !settings.SPA {
+		return false
+	}
+	urlPath, err := cleanURLPath(req.URL)
+	if err != nil {
+		return false
+	}
+	return path.Ext(urlPath) == ""
+}
+
+// spaIndex fills in res with the /index.html of the virtual host of req,
+// which the application routes by itself.
+func (s *Server) spaIndex(req *Request, res *Response) error {
+	index := *req
+	index.URL = "/index.html"
+	err := s.parseAndGenerateResponse(&index, res)
+	res.Request = req
+	return err
+}
@@ -0,0 +1,42 @@
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSPAFallback(t *testing.T) {
+	index, err := os.ReadFile("../docroot_dirs/htdocs1/index.html")
+	if err != nil {
+		t.Fatalf("Error reading index: %v\n", err.Error())
+	}
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{"website1": {SPA: true}}
+	tests := []struct {
+		url   string
+		code  int
+		index bool
+	}{
+		{"/users/42", 200, true},
+		{"/users/42?tab=posts", 200, true},
+		{"/kitten.jpg", 200, false},
+		{"/app.js", 404, false},
+		{"/subdir/", 200, false},
+	}
+	for _, tt := range tests {
+		resp := parseResponse(t, serveRaw(t, s, "GET "+tt.url+" HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+		if resp.StatusCode != tt.code {
+			t.Fatalf("Expected response code of %v for %v but got: %v\n", tt.code, tt.url, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if (string(body) == string(index)) != tt.index {
+			t.Fatalf("Expected %v to be answered with /index.html: %v\n", tt.url, tt.index)
+		}
+	}
+
+	resp := parseResponse(t, serveRaw(t, newTestServer(), "GET /users/42 HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expected response code of 404 without SPA mode but got: %v\n", resp.StatusCode)
+	}
+}
@@ -0,0 +1,84 @@
+package tritonhttp
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const htmlContentType = "text/html; charset=utf-8"
+
+// A TemplateDataFunc supplies the data a template is rendered with for req.
+type TemplateDataFunc func(req *Request) (any, error)
+
+// RenderTemplate executes t with data and makes the result the HTML body of
+// res. Nothing is changed if the execution fails.
+func (res *Response) RenderTemplate(t *template.Template, data any) error {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+	res.SetBody(htmlContentType, buf.String())
+	return nil
+}
+
+// templateFile is an html/template file, parsed again whenever it changes on
+// disk so pages can be edited without restarting the server.
+type templateFile struct {
+	path string
+
+	mu      sync.Mutex
+	t       *template.Template
+	modTime time.Time
+}
+
+func (tf *templateFile) load() (*template.Template, error) {
+	info, err := os.Stat(tf.path)
+	if err != nil {
+		return nil, err
+	}
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	if tf.t == nil || !info.ModTime().Equal(tf.modTime) {
+		t, err := template.ParseFiles(tf.path)
+		if err != nil {
+			return nil, err
+		}
+		tf.t, tf.modTime = t, info.ModTime()
+	}
+	return tf.t, nil
+}
+
+// HandleTemplate registers a handler for pattern, like HandleFunc, that
+// renders the html/template file at path with the data returned by data.
+// data may be nil for static templates. A failure to load or render the
+// template is answered with 500.
+func (s *Server) HandleTemplate(pattern, path string, data TemplateDataFunc) {
+	tf := &templateFile{path: path}
+	s.HandleFunc(pattern, func(req *Request) *Response {
+		res := &Response{}
+		t, err := tf.load()
+		if err != nil {
+			log.Printf("Failed to load template %v: %v", path, err)
+			res.HandleError(statusInternalServerError)
+			return res
+		}
+		var d any
+		if data != nil {
+			if d, err = data(req); err != nil {
+				log.Printf("Failed to get data for template %v: %v", path, err)
+				res.HandleError(statusInternalServerError)
+				return res
+			}
+		}
+		res.HandleOK()
+		if err := res.RenderTemplate(t, d); err != nil {
+			log.Printf("Failed to render template %v: %v", path, err)
+			res.HandleError(statusInternalServerError)
+		}
+		return res
+	})
+}
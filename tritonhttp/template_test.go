@@ -0,0 +1,47 @@
+package tritonhttp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.html")
+	if err := os.WriteFile(path, []byte("<p>Hello {{.}}</p>"), 0644); err != nil {
+		t.Fatalf("Error writing template: %v\n", err.Error())
+	}
+	s := newTestServer()
+	s.HandleTemplate("/status", path, func(req *Request) (any, error) {
+		return req.Headers["x-name"], nil
+	})
+	s.HandleTemplate("/broken", filepath.Join(t.TempDir(), "missing.html"), nil)
+
+	get := func(url, name string) (int, string) {
+		resp := parseResponse(t, serveRaw(t, s, "GET "+url+" HTTP/1.1\r\nHost: website1\r\nX-Name: "+name+"\r\nConnection: close\r\n\r\n"))
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/status", "<ann>"); code != 200 || body != "<p>Hello &lt;ann&gt;</p>" {
+		t.Fatalf("Unexpected rendering %v %q\n", code, body)
+	}
+
+	// edits are picked up without restarting the server
+	if err := os.WriteFile(path, []byte("<p>Bye {{.}}</p>"), 0644); err != nil {
+		t.Fatalf("Error writing template: %v\n", err.Error())
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Error touching template: %v\n", err.Error())
+	}
+	if code, body := get("/status", "bob"); code != 200 || body != "<p>Bye bob</p>" {
+		t.Fatalf("Unexpected rendering after an edit %v %q\n", code, body)
+	}
+
+	if code, _ := get("/broken", ""); code != 500 {
+		t.Fatalf("Expected response code of 500 but got: %v\n", code)
+	}
+}
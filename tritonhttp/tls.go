@@ -0,0 +1,109 @@
+package tritonhttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+
+	"golang.org/x/net/http2"
+)
+
+// ListenAndServeTLS is ListenAndServe over TLS: every listener, including
+// those of ListenAddrs and SetListenAddrs, serves HTTPS with a copy of
+// TLSConfig to which the certificate in certFile, with its private key in
+// keyFile, both PEM encoded, is added. The files may be empty if TLSConfig
+// provides certificates of its own, or if ACME obtains them. Requests see
+// the TLS state of their connection in Request.TLS. Clients that negotiate
+// "h2" through ALPN are served over HTTP/2, unless TLSConfig sets
+// NextProtos without it. With HTTP3 set, HTTP/3 is served on the UDP port
+// of Addr as well. The files are checked every CertCheckInterval, and a
+// renewed certificate written to them is used for new connections at once,
+// without a restart.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	s.listenTLS.Store(config)
+	if s.HTTP3 {
+		conn, err := s.listenHTTP3(config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	return s.ListenAndServe()
+}
+
+// ServeTLS is Serve over TLS for the existing listener ln, with the
+// certificate of certFile and keyFile as in ListenAndServeTLS.
+func (s *Server) ServeTLS(ln net.Listener, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	return s.Serve(tls.NewListener(ln, config))
+}
+
+// tlsConfig returns the TLS configuration of ListenAndServeTLS and
+// ServeTLS: TLSConfig, or a default one, with the certificate of certFile
+// and keyFile added, or those of ACME without files. The files are checked
+// for changes while serving, see CertReloader; the certificates of
+// TLSConfig take precedence for the server names they cover.
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if config.NextProtos == nil {
+		config.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+	var fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	if certFile != "" || keyFile != "" {
+		certs, err := NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs.Store(certs)
+		fallback = certs.GetCertificate
+	} else if s.ACME != nil {
+		// the manager only tries HTTP-01 once its handler is requested
+		s.ACME.HTTPHandler(nil)
+		fallback = s.ACME.GetCertificate
+		// for the TLS-ALPN-01 challenges, answered by GetCertificate
+		config.NextProtos = append(slices.Clip(config.NextProtos), acmeALPNProto)
+	}
+	if fallback != nil {
+		static, getCertificate := config.Certificates, config.GetCertificate
+		config.Certificates = nil
+		config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if getCertificate != nil {
+				if cert, err := getCertificate(hello); cert != nil || err != nil {
+					return cert, err
+				}
+			}
+			// the certificates of TLSConfig serve the names they cover
+			for i := range static {
+				if hello.SupportsCertificate(&static[i]) == nil {
+					return &static[i], nil
+				}
+			}
+			return fallback(hello)
+		}
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("tritonhttp: TLS needs a certificate")
+	}
+	return config, nil
+}
+
+// tlsListener wraps ln, opened by ListenAndServe or SetListenAddrs, in TLS
+// if ListenAndServeTLS was called.
+func (s *Server) tlsListener(ln net.Listener) net.Listener {
+	config := s.listenTLS.Load()
+	if config == nil {
+		return ln
+	}
+	return tls.NewListener(ln, config)
+}
@@ -0,0 +1,220 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestTLS(t *testing.T) {
+	cert := testCertificate(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v\n", err.Error())
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	s := newTestServer()
+	s.HandleFunc("/whoami", func(req *Request) *Response {
+		res := &Response{}
+		res.HandleOK()
+		if req.TLS == nil || req.ClientCertificate() == nil {
+			res.SetBody("text/plain", "anonymous")
+			return res
+		}
+		res.SetBody("text/plain", tls.VersionName(req.TLS.Version)+" "+req.TLS.ServerName+" "+req.ClientCertificate().DNSNames[0])
+		return res
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	ln = tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS13,
+	})
+	go func() { _ = s.Serve(ln) }()
+	defer ln.Close()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:   "website1",
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+	})
+	if err != nil {
+		t.Fatalf("Error dialing: %v\n", err.Error())
+	}
+	defer conn.Close()
+	_, _ = io.WriteString(conn, "GET /whoami HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v\n", err.Error())
+	}
+	if string(body) != "TLS 1.3 website1 website1" {
+		t.Fatalf("Expected the TLS state of the connection but got: %q\n", body)
+	}
+
+	resp = parseResponse(t, serveRaw(t, s, "GET /whoami HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if body, _ := io.ReadAll(resp.Body); string(body) != "anonymous" {
+		t.Fatalf("Expected no TLS state over plain TCP but got: %q\n", body)
+	}
+}
+
+// writeCertFiles writes cert and its key to PEM files and returns their
+// paths.
+func writeCertFiles(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Error encoding key: %v\n", err.Error())
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("Error writing certificate: %v\n", err.Error())
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Error writing key: %v\n", err.Error())
+	}
+	return certFile, keyFile
+}
+
+// getTLS requests /index.html from website1 over TLS at addr, retrying
+// while the server starts, and returns the response and the TLS state.
+func getTLS(t *testing.T, addr string) (*http.Response, tls.ConnectionState) {
+	var conn *tls.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Error dialing %v: %v\n", addr, err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+	_, _ = io.WriteString(conn, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	return resp, conn.ConnectionState()
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	certFile, keyFile := writeCertFiles(t, testCertificate(t))
+	s := newTestServer()
+	s.Addr = freeAddr(t)
+	s.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServeTLS(certFile, keyFile) }()
+	defer func() {
+		s.Close()
+		<-served
+	}()
+
+	resp, state := getTLS(t, s.Addr)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+	if state.Version != tls.VersionTLS13 || state.NegotiatedProtocol != "" {
+		t.Fatalf("Unexpected TLS state: %v %q\n", tls.VersionName(state.Version), state.NegotiatedProtocol)
+	}
+	if s.TLSConfig.Certificates != nil {
+		t.Fatalf("Expected TLSConfig to be left alone\n")
+	}
+
+	// listeners added later serve TLS too
+	addr := freeAddr(t)
+	if err := s.SetListenAddrs([]string{s.Addr, addr}, time.Second); err != nil {
+		t.Fatalf("Error adding a listener: %v\n", err.Error())
+	}
+	if resp, _ := getTLS(t, addr); resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	defer ln.Close()
+	s := newTestServer()
+	// the certificate may come from TLSConfig alone
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}
+	go func() { _ = s.ServeTLS(ln, "", "") }()
+	if resp, _ := getTLS(t, ln.Addr().String()); resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	s := newTestServer()
+	if _, err := s.tlsConfig("", ""); err == nil {
+		t.Fatalf("Expected an error without a certificate\n")
+	}
+	if _, err := s.tlsConfig(filepath.Join(t.TempDir(), "missing.pem"), "missing.key"); err == nil {
+		t.Fatalf("Expected an error for missing certificate files\n")
+	}
+}
+
+func TestServeTLSHTTP2(t *testing.T) {
+	tests := []struct {
+		name       string
+		nextProtos []string
+		proto      string
+	}{
+		{"offered by default", nil, "HTTP/2.0"},
+		{"left out of NextProtos", []string{"http/1.1"}, "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Error listening: %v\n", err.Error())
+			}
+			defer ln.Close()
+			s := newTestServer()
+			s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}, NextProtos: tt.nextProtos}
+			go func() { _ = s.ServeTLS(ln, "", "") }()
+
+			transport := &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				ForceAttemptHTTP2: true,
+			}
+			defer transport.CloseIdleConnections()
+			req, err := http.NewRequest("GET", "https://"+ln.Addr().String()+"/index.html", nil)
+			if err != nil {
+				t.Fatalf("Error building request: %v\n", err.Error())
+			}
+			req.Host = "website1"
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("Error getting /index.html: %v\n", err.Error())
+			}
+			defer resp.Body.Close()
+			if resp.Proto != tt.proto || resp.StatusCode != 200 {
+				t.Fatalf("Expected %v 200 but got %v %v\n", tt.proto, resp.Proto, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package tritonhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultTransferSaveInterval is how often the transfer counts are saved
+// to Server.TransferFile when Server.TransferSaveInterval is not set.
+const DefaultTransferSaveInterval = time.Minute
+
+// The layouts of the accounting periods of HostTransfer, in UTC.
+const (
+	transferDayLayout   = "2006-01-02"
+	transferMonthLayout = "2006-01"
+)
+
+// HostTransfer is the number of bytes sent for the requests of a virtual
+// host, status lines and headers included.
+type HostTransfer struct {
+	// Total counts all bytes ever sent
+	Total int64 `json:"total"`
+	// Day is the day DayBytes were sent on, e.g. "2023-02-01"
+	Day      string `json:"day"`
+	DayBytes int64  `json:"dayBytes"`
+	// Month is the month MonthBytes were sent in, e.g. "2023-02"
+	Month      string `json:"month"`
+	MonthBytes int64  `json:"monthBytes"`
+}
+
+// roll starts new accounting periods for t if now is past its current
+// ones.
+func (t *HostTransfer) roll(now time.Time) {
+	now = now.UTC()
+	if day := now.Format(transferDayLayout); t.Day != day {
+		t.Day, t.DayBytes = day, 0
+	}
+	if month := now.Format(transferMonthLayout); t.Month != month {
+		t.Month, t.MonthBytes = month, 0
+	}
+}
+
+// transferStats counts the bytes sent per virtual host.
+type transferStats struct {
+	mu     sync.Mutex
+	hosts  map[string]*HostTransfer
+	loaded bool
+	// dirty is set when the counts changed since they were last saved
+	dirty bool
+}
+
+func (ts *transferStats) add(host string, n int64, now time.Time) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.hosts == nil {
+		ts.hosts = make(map[string]*HostTransfer)
+	}
+	t := ts.hosts[host]
+	if t == nil {
+		t = &HostTransfer{}
+		ts.hosts[host] = t
+	}
+	t.roll(now)
+	t.Total += n
+	t.DayBytes += n
+	t.MonthBytes += n
+	ts.dirty = true
+}
+
+// get returns the counts of host as of now.
+func (ts *transferStats) get(host string, now time.Time) HostTransfer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var t HostTransfer
+	if ts.hosts[host] != nil {
+		t = *ts.hosts[host]
+	}
+	t.roll(now)
+	return t
+}
+
+// snapshot returns the counts of all hosts as of now.
+func (ts *transferStats) snapshot(now time.Time) map[string]HostTransfer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	snapshot := make(map[string]HostTransfer, len(ts.hosts))
+	for host, t := range ts.hosts {
+		copied := *t
+		copied.roll(now)
+		snapshot[host] = copied
+	}
+	return snapshot
+}
+
+// load reads the counts saved in path, once. Counts added before are kept.
+func (ts *transferStats) load(path string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.loaded {
+		return nil
+	}
+	ts.loaded = true
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved map[string]*HostTransfer
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if ts.hosts == nil {
+		ts.hosts = make(map[string]*HostTransfer, len(saved))
+	}
+	for host, t := range saved {
+		if t == nil {
+			continue
+		}
+		if cur := ts.hosts[host]; cur != nil {
+			t.Total += cur.Total
+			if t.Day == cur.Day {
+				t.DayBytes += cur.DayBytes
+			} else {
+				t.Day, t.DayBytes = cur.Day, cur.DayBytes
+			}
+			if t.Month == cur.Month {
+				t.MonthBytes += cur.MonthBytes
+			} else {
+				t.Month, t.MonthBytes = cur.Month, cur.MonthBytes
+			}
+		}
+		ts.hosts[host] = t
+	}
+	return nil
+}
+
+// save writes the counts to path if they changed since the last save. The
+// file is replaced atomically, so a crash leaves the previous counts.
+func (ts *transferStats) save(path string) error {
+	ts.mu.Lock()
+	if !ts.dirty {
+		ts.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(ts.hosts, "", "  ")
+	ts.dirty = false
+	ts.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(path, append(data, '\n'))
+	}
+	if err != nil {
+		// try again at the next save
+		ts.mu.Lock()
+		ts.dirty = true
+		ts.mu.Unlock()
+	}
+	return err
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers see
+// either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// TransferStats returns the bytes sent per virtual host, keyed by host
+// name.
+func (s *Server) TransferStats() map[string]HostTransfer {
+	return s.transfers.snapshot(s.now())
+}
+
+// transferHost returns the virtual host the traffic of a request for host
+// is accounted to, or "" if the server does not serve host.
+func (s *Server) transferHost(host string) string {
+	if key, _, ok := lookupHost(s.virtualHosts(), host); ok {
+		return key
+	}
+	if key, _, ok := lookupHost(s.hostSettings(), host); ok {
+		return key
+	}
+	return ""
+}
+
+// accountTransfer adds n bytes sent in response to req to the traffic of
+// its virtual host.
+func (s *Server) accountTransfer(req *Request, n int64) {
+	if req == nil || n == 0 {
+		return
+	}
+	if host := s.transferHost(req.Host); host != "" {
+		s.transfers.add(host, n, s.now())
+	}
+}
+
+// checkQuota returns a 509 response if the virtual host of req has used up
+// its daily or monthly transfer quota, or nil.
+func (s *Server) checkQuota(req *Request) *Response {
+	_, settings, ok := lookupHost(s.hostSettings(), req.Host)
+	if !ok || (settings.DailyQuota == 0 && settings.MonthlyQuota == 0) {
+		return nil
+	}
+	host := s.transferHost(req.Host)
+	now := s.now().UTC()
+	used := s.transfers.get(host, now)
+	var period string
+	var next time.Time
+	switch {
+	case settings.MonthlyQuota > 0 && used.MonthBytes >= settings.MonthlyQuota:
+		period = "monthly"
+		next = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	case settings.DailyQuota > 0 && used.DayBytes >= settings.DailyQuota:
+		period = "daily"
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+	res := s.newResponse(statusBandwidthLimitExceeded, responseOptions{req: req, detail: "the " + period + " transfer quota of " + host + " is used up"})
+	res.Headers["Retry-After"] = FormatTime(next)
+	return res
+}
+
+// startTransferSaves loads the transfer counts from TransferFile and saves
+// them every TransferSaveInterval, until the returned function has been
+// called as many times as startTransferSaves. Each call of the returned
+// function also saves them once more.
+func (s *Server) startTransferSaves() (stop func()) {
+	if s.TransferFile == "" {
+		return func() {}
+	}
+	if err := s.transfers.load(s.TransferFile); err != nil {
+		log.Printf("Failed to load transfer counts from %v: %v", s.TransferFile, err)
+	}
+	interval := s.TransferSaveInterval
+	if interval == 0 {
+		interval = DefaultTransferSaveInterval
+	}
+	stopSaves := s.transferSaves.start(interval, s.saveTransfers)
+	return func() {
+		stopSaves()
+		s.saveTransfers()
+	}
+}
+
+func (s *Server) saveTransfers() {
+	if err := s.transfers.save(s.TransferFile); err != nil {
+		log.Printf("Failed to save transfer counts to %v: %v", s.TransferFile, err)
+	}
+}
@@ -0,0 +1,66 @@
+package tritonhttp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransferQuota(t *testing.T) {
+	s := newTestServer()
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"website1": {DailyQuota: 1},
+	}
+	resp := parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1:8080\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected response code of 200 but got: %v\n", resp.StatusCode)
+	}
+	sent := s.TransferStats()["website1"]
+	if sent.Total == 0 || sent.DayBytes != sent.Total || sent.MonthBytes != sent.Total {
+		t.Fatalf("Expected the response to be accounted to website1 but got: %+v\n", sent)
+	}
+
+	resp = parseResponse(t, serveRaw(t, s, "GET /index.html HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 509 {
+		t.Fatalf("Expected response code of 509 but got: %v\n", resp.StatusCode)
+	}
+	retry, err := time.Parse(timeFormat, resp.Header.Get("Retry-After"))
+	if err != nil || !retry.After(time.Now()) || retry.Sub(time.Now()) > 24*time.Hour {
+		t.Fatalf("Expected Retry-After to be the start of the next day but got: %q\n", resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestTransferPeriods(t *testing.T) {
+	var ts transferStats
+	day := time.Date(2023, 1, 31, 12, 0, 0, 0, time.UTC)
+	ts.add("website1", 100, day)
+	ts.add("website1", 50, day.Add(time.Hour))
+	if got := ts.get("website1", day); got.DayBytes != 150 || got.MonthBytes != 150 {
+		t.Fatalf("Expected 150 bytes on the day but got: %+v\n", got)
+	}
+	next := day.Add(24 * time.Hour)
+	ts.add("website1", 10, next)
+	got := ts.get("website1", next)
+	if got.Total != 160 || got.Day != "2023-02-01" || got.DayBytes != 10 || got.Month != "2023-02" || got.MonthBytes != 10 {
+		t.Fatalf("Expected new periods on the next day but got: %+v\n", got)
+	}
+}
+
+func TestTransferPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfer.json")
+	now := time.Now()
+	var saved transferStats
+	saved.add("website1", 100, now)
+	if err := saved.save(path); err != nil {
+		t.Fatalf("Failed to save transfer counts: %v\n", err)
+	}
+
+	var loaded transferStats
+	loaded.add("website1", 10, now)
+	if err := loaded.load(path); err != nil {
+		t.Fatalf("Failed to load transfer counts: %v\n", err)
+	}
+	if got := loaded.get("website1", now); got.Total != 110 || got.DayBytes != 110 {
+		t.Fatalf("Expected the saved counts to add to the new ones but got: %+v\n", got)
+	}
+}
@@ -0,0 +1,85 @@
+// Package tritonhttptest runs TritonHTTP servers in-process for tests,
+// in the spirit of net/http/httptest.
+package tritonhttptest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cse224/tritonhttp"
+)
+
+// Server is a TritonHTTP server listening on a random local port.
+type Server struct {
+	// URL is the base URL of the server, e.g. "http://127.0.0.1:51234"
+	URL string
+	// Listener is the listener the server accepts connections on
+	Listener net.Listener
+	// Config is the server being run. It must not be modified
+	// after NewServer returns.
+	Config *tritonhttp.Server
+
+	done chan struct{}
+}
+
+// NewServer starts a server for vhosts, a map from host name to docroot
+// directory, bound to an ephemeral port on the loopback interface. The
+// caller should call Close when finished.
+func NewServer(vhosts map[string]string) *Server {
+	return NewUnstartedServer(vhosts).Start()
+}
+
+// NewUnstartedServer returns a server for vhosts that is not serving yet,
+// so its Config can be adjusted before calling Start.
+func NewUnstartedServer(vhosts map[string]string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("tritonhttptest: failed to listen on a port: %v", err))
+	}
+	return &Server{
+		Listener: ln,
+		Config:   &tritonhttp.Server{Addr: ln.Addr().String(), VirtualHosts: vhosts},
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts serving requests and returns s.
+func (s *Server) Start() *Server {
+	s.URL = "http://" + s.Listener.Addr().String()
+	go func() {
+		defer close(s.done)
+		_ = s.Config.Serve(s.Listener)
+	}()
+	return s
+}
+
+// Close stops accepting connections, closes the connections that are
+// still open, keep-alive ones included, and waits for the server to stop.
+// Requests in progress are aborted, as by Server.Shutdown with no grace.
+func (s *Server) Close() {
+	s.Config.Shutdown(0)
+	// Serve may not have started to track the listener yet
+	_ = s.Listener.Close()
+	<-s.done
+}
+
+// DocRoot creates a temporary docroot holding files, a map from slash
+// separated relative path to file content. It is removed when the test
+// ends.
+func DocRoot(t testing.TB, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error creating docroot: %v\n", err.Error())
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error creating docroot: %v\n", err.Error())
+		}
+	}
+	return root
+}
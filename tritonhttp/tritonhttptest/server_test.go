@@ -0,0 +1,70 @@
+package tritonhttptest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	root := DocRoot(t, map[string]string{
+		"index.html":     "<h1>hello</h1>",
+		"sub/index.html": "sub",
+	})
+	ts := NewServer(map[string]string{"localhost": root})
+	defer ts.Close()
+
+	for path, want := range map[string]string{"/": "<h1>hello</h1>", "/sub/": "sub"} {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Host = "localhost"
+		req.Close = true
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error issuing request: %v\n", err.Error())
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Error reading response body: %v\n", err.Error())
+		}
+		if resp.StatusCode != 200 || string(body) != want {
+			t.Fatalf("Expected 200 %q for %v but got %v %q\n", want, path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestCloseKeepAlive(t *testing.T) {
+	root := DocRoot(t, map[string]string{"index.html": "hello"})
+	ts := NewServer(map[string]string{"localhost": root})
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v\n", err.Error())
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatalf("Error writing request: %v\n", err.Error())
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Error reading response: %v\n", err.Error())
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// the connection is kept alive, but must not outlive the server
+	ts.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the connection to be closed but got: %v\n", err)
+	}
+}
@@ -0,0 +1,86 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const methodConnect = "CONNECT"
+
+// establishesTunnel reports whether res accepts a CONNECT request, after
+// which the connection carries the tunnel instead of HTTP.
+func (res *Response) establishesTunnel() bool {
+	return res.Request != nil && res.Request.Method == methodConnect &&
+		res.StatusCode >= 200 && res.StatusCode < 300
+}
+
+// tunnelAllowed reports whether target, the "host:port" of a CONNECT
+// request, is listed in TunnelHosts.
+func (s *Server) tunnelAllowed(target string) bool {
+	for _, allowed := range s.TunnelHosts {
+		if strings.EqualFold(allowed, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// tunnel answers the CONNECT request req and, if its target is allowed and
+// reachable, relays bytes between conn and the target until either side
+// is done. conn is not used for HTTP afterwards, whatever the outcome.
+func (s *Server) tunnel(conn net.Conn, br *bufio.Reader, req *Request) {
+	if !s.tunnelAllowed(req.URL) {
+		log.Printf("Refused tunnel from %v to %v", conn.RemoteAddr(), req.URL)
+		_ = s.writeResponse(conn, s.newResponse(statusForbidden, responseOptions{req: req, close: true, detail: "tunnels to " + req.URL + " are not allowed"}))
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", req.URL, s.idleTimeout())
+	if err != nil {
+		log.Printf("Failed to open tunnel to %v: %v", req.URL, err)
+		_ = s.writeResponse(conn, s.newResponse(statusBadGateway, responseOptions{req: req, close: true, detail: "cannot reach " + req.URL}))
+		return
+	}
+	defer upstream.Close()
+
+	res := s.newResponse(statusOK, responseOptions{req: req})
+	res.StatusText = "Connection Established"
+	if err := s.writeResponse(conn, res); err != nil {
+		return
+	}
+	// the tunnel lasts as long as both ends want it to
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear timeout for connection %v", conn.RemoteAddr())
+		return
+	}
+	log.Printf("Tunneling %v to %v", conn.RemoteAddr(), req.URL)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// br may already hold bytes the client sent after the request
+		_, _ = io.Copy(upstream, br)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(conn, upstream)
+		closeWrite(conn)
+	}()
+	wg.Wait()
+}
+
+// closeWrite signals the end of the data sent on c, keeping the other
+// direction open when c supports half-closing.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
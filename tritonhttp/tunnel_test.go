@@ -0,0 +1,83 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// startEchoServer returns the address of a TCP server echoing whatever it
+// receives.
+func startEchoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestConnectTunnel(t *testing.T) {
+	target := startEchoServer(t)
+	s := newTestServer()
+	s.TunnelHosts = []string{target}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go s.HandleConnection(server)
+	go func() {
+		// the first tunneled bytes follow the request immediately
+		_, _ = io.WriteString(client, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\nping")
+	}()
+
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, &http.Request{Method: "CONNECT"})
+	if err != nil {
+		t.Fatalf("got an error parsing the response: %v\n", err.Error())
+	}
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Length") != "" {
+		t.Fatalf("Expected 200 without Content-Length but got: %v %v\n", resp.StatusCode, resp.Header)
+	}
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(br, echo); err != nil || string(echo) != "ping" {
+		t.Fatalf("Expected the tunnel to echo %q but got %q (%v)\n", "ping", echo, err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	target := startEchoServer(t)
+	tests := []struct {
+		name  string
+		hosts []string
+		raw   string
+		code  int
+	}{
+		{"disabled", nil, "CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\nConnection: close\r\n\r\n", 405},
+		{"not allowed", []string{"example.com:443"}, "CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n", 403},
+		{"malformed target", []string{target}, "CONNECT /index.html HTTP/1.1\r\nHost: website1\r\n\r\n", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.TunnelHosts = tt.hosts
+			resp := parseResponse(t, serveRaw(t, s, tt.raw))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package tritonhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	CONTENT_RANGE = "content-range"
+
+	methodPut = "PUT"
+)
+
+// contentRange is a parsed "Content-Range: bytes first-last/total" request
+// header. A status query "bytes */total" has first and last set to -1.
+type contentRange struct {
+	first, last, total int64
+}
+
+func parseContentRange(value string) (contentRange, error) {
+	const unit = "bytes "
+	if !strings.HasPrefix(value, unit) {
+		return contentRange{}, badStringError("unsupported Content-Range unit", value)
+	}
+	spec, total, found := strings.Cut(value[len(unit):], "/")
+	if !found {
+		return contentRange{}, badStringError("malformed Content-Range", value)
+	}
+	cr := contentRange{first: -1, last: -1}
+	var err error
+	if cr.total, err = strconv.ParseInt(total, 10, 64); err != nil || cr.total < 0 {
+		return contentRange{}, badStringError("malformed Content-Range length", value)
+	}
+	if spec == "*" {
+		return cr, nil
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return contentRange{}, badStringError("malformed Content-Range", value)
+	}
+	cr.first, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || cr.first < 0 {
+		return contentRange{}, badStringError("malformed Content-Range", value)
+	}
+	cr.last, err = strconv.ParseInt(last, 10, 64)
+	if err != nil || cr.last < cr.first || cr.last >= cr.total {
+		return contentRange{}, badStringError("malformed Content-Range", value)
+	}
+	return cr, nil
+}
+
+// uploadPath maps the target of the PUT request req to the file it
+// creates or replaces, which must be under the docroot of the host and in
+// an existing directory. No element of the target may start with ".", so
+// uploads reach neither dotfiles like ".git/config" nor ".well-known".
+func (s *Server) uploadPath(req *Request) (string, error) {
+	_, docroot, ok := lookupHost(s.virtualHosts(), req.Host)
+	if !ok {
+		return "", notFoundError("HostNotFoundError: Host not present in DocRoot. Host: ", req.Host)
+	}
+	target, err := cleanURLPath(req.URL)
+	if err != nil {
+		return "", notFoundError("UploadError: malformed URL path. ", req.URL)
+	}
+	// the cleaned target is rooted, so every element follows a slash
+	if strings.HasSuffix(target, "/") || strings.Contains(target, "/.") {
+		return "", notFoundError("UploadError: not a file name. ", target)
+	}
+	path, err := docrootPath(docroot, target)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return "", notFoundError("UploadError: no such directory. ", filepath.Dir(path))
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "", notFoundError("UploadError: target is a directory. ", path)
+	}
+	return path, nil
+}
+
+// partPath is where the bytes received so far for a resumable upload to
+// path are kept until the upload completes.
+func partPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".part")
+}
+
+// uploadTempPattern names the temporary file of a whole upload.
+const uploadTempPattern = ".upload-*"
+
+// uploadArtifact reports whether name is that of a file uploads keep next
+// to their target while in progress: a partial file, its recorded total,
+// or the temporary file of a whole upload. They are never served. Uploads
+// cannot create dotfiles, so no uploaded file is mistaken for one.
+func uploadArtifact(name string) bool {
+	if !strings.HasPrefix(name, ".") {
+		return false
+	}
+	return strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".part.total") || strings.HasPrefix(name, strings.TrimSuffix(uploadTempPattern, "*"))
+}
+
+// partTotalPath is where the total size declared by the first piece of a
+// resumable upload to path is kept, so later pieces can be checked against
+// it.
+func partTotalPath(path string) string {
+	return partPath(path) + ".total"
+}
+
+// partTotal returns the total size recorded for the resumable upload to
+// path, or -1 if none is.
+func partTotal(path string) (int64, error) {
+	data, err := os.ReadFile(partTotalPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+// uploadLocks serializes uploads to the same file. A path has a lock only
+// while an upload holds or waits for it.
+var uploadLocks = struct {
+	sync.Mutex
+	paths map[string]*uploadLock
+}{paths: make(map[string]*uploadLock)}
+
+// uploadLock is the lock of a path, with the number of uploads holding or
+// waiting for it.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockUpload locks path for an upload, and returns the function unlocking
+// it.
+func lockUpload(path string) func() {
+	uploadLocks.Lock()
+	l := uploadLocks.paths[path]
+	if l == nil {
+		l = &uploadLock{}
+		uploadLocks.paths[path] = l
+	}
+	l.refs++
+	uploadLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		uploadLocks.Lock()
+		defer uploadLocks.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(uploadLocks.paths, path)
+		}
+	}
+}
+
+// handlePut stores the body of the PUT request req as the target file.
+//
+// Without a "Content-Range" header the body is the whole file; it is
+// written to a temporary file that then replaces the target, so readers
+// never see a partial file. With "Content-Range: bytes first-last/total"
+// the body is one piece of a resumable upload: pieces must arrive in
+// order and declare the total of the first one, and the file appears once
+// all total bytes were received. A PUT
+// with "Content-Range: bytes */total" and no body asks how many bytes the
+// server already has; they are reported in a "Range" header.
+func (s *Server) handlePut(req *Request) *Response {
+	path, err := s.uploadPath(req)
+	if err != nil {
+		log.Printf("Rejected upload: %v", err)
+		return s.newResponse(statusNotFound, responseOptions{req: req, detail: "cannot upload to " + req.URL})
+	}
+	defer lockUpload(path)()
+	if detail, ok := s.uploadPreconditions(req, path); !ok {
+		return s.newResponse(statusPreconditionFailed, responseOptions{req: req, detail: detail})
+	}
+
+	value, resumable := req.Headers[CONTENT_RANGE]
+	if !resumable {
+		return s.putFile(req, path)
+	}
+	cr, err := parseContentRange(value)
+	if err != nil {
+		return s.newResponse(statusBadRequest, responseOptions{req: req, detail: err.Error()})
+	}
+	if cr.first >= 0 && cr.last-cr.first+1 != req.ContentLength {
+		return s.newResponse(statusBadRequest, responseOptions{req: req, detail: "Content-Range does not match Content-Length"})
+	}
+	return s.putRange(req, path, cr)
+}
+
+// putFile replaces the file at path with the body of req.
+func (s *Server) putFile(req *Request, path string) *Response {
+	_, err := os.Stat(path)
+	created := errors.Is(err, os.ErrNotExist)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), uploadTempPattern)
+	if err != nil {
+		return s.uploadFailed(req, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := copyBody(tmp, req); err != nil {
+		tmp.Close()
+		return s.uploadFailed(req, err)
+	}
+	if err := commitUpload(tmp, path); err != nil {
+		return s.uploadFailed(req, err)
+	}
+	return s.uploaded(req, path, created)
+}
+
+// putRange appends the piece cr of a resumable upload to the partial file
+// of path, and moves it in place once complete.
+func (s *Server) putRange(req *Request, path string, cr contentRange) *Response {
+	flag := os.O_WRONLY
+	if cr.first >= 0 {
+		flag |= os.O_CREATE
+	}
+	part, err := os.OpenFile(partPath(path), flag, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		// a status query for an upload that has not started
+		return s.newResponse(statusAccepted, responseOptions{req: req})
+	}
+	if err != nil {
+		return s.uploadFailed(req, err)
+	}
+	info, err := part.Stat()
+	if err != nil {
+		part.Close()
+		return s.uploadFailed(req, err)
+	}
+	received := info.Size()
+	total, err := partTotal(path)
+	if err != nil {
+		part.Close()
+		return s.uploadFailed(req, err)
+	}
+	// every piece must declare the total of the first one
+	var mismatch string
+	switch {
+	case total >= 0 && cr.total != total:
+		mismatch = fmt.Sprintf("the upload is of %d bytes", total)
+	case received > cr.total:
+		mismatch = fmt.Sprintf("%d bytes were already received", received)
+	}
+	if mismatch != "" {
+		part.Close()
+		return s.newResponse(statusBadRequest, responseOptions{req: req, detail: "Content-Range total does not match: " + mismatch})
+	}
+
+	if cr.first >= 0 {
+		if cr.first != received {
+			part.Close()
+			res := s.newResponse(statusRangeNotSatisfiable, responseOptions{
+				req:    req,
+				detail: fmt.Sprintf("upload must resume at byte %d", received),
+			})
+			setReceivedRange(res, received)
+			return res
+		}
+		if total < 0 {
+			if err := os.WriteFile(partTotalPath(path), []byte(strconv.FormatInt(cr.total, 10)), 0644); err != nil {
+				part.Close()
+				return s.uploadFailed(req, err)
+			}
+		}
+		if _, err := part.Seek(received, io.SeekStart); err != nil {
+			part.Close()
+			return s.uploadFailed(req, err)
+		}
+		// bytes written before a failure are kept, the client resumes
+		// after them
+		n, err := io.CopyN(part, req.Body, req.ContentLength)
+		received += n
+		if err != nil {
+			part.Close()
+			return s.uploadFailed(req, err)
+		}
+	}
+
+	if received < cr.total {
+		part.Close()
+		res := s.newResponse(statusAccepted, responseOptions{req: req})
+		setReceivedRange(res, received)
+		return res
+	}
+	_, err = os.Stat(path)
+	created := errors.Is(err, os.ErrNotExist)
+	if err := commitUpload(part, path); err != nil {
+		return s.uploadFailed(req, err)
+	}
+	if err := os.Remove(partTotalPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove %v: %v", partTotalPath(path), err)
+	}
+	return s.uploaded(req, path, created)
+}
+
+// uploaded answers a completed upload of the file at path with 201, or 204
+// if it replaced an existing file, and the ETag of the stored file.
+func (s *Server) uploaded(req *Request, path string, created bool) *Response {
+	code := statusNoContent
+	if created {
+		code = statusCreated
+	}
+	res := s.newResponse(code, responseOptions{req: req})
+	if info, err := os.Stat(path); err == nil {
+		res.Headers["ETag"] = s.fileETagFor(req, path, info)
+	}
+	return res
+}
+
+// commitUpload flushes f to disk, closes it and atomically moves it to path.
+func commitUpload(f *os.File, path string) error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// setReceivedRange tells the client how many bytes of its upload are
+// stored, as the "Range" header of res.
+func setReceivedRange(res *Response, received int64) {
+	if received > 0 {
+		res.Headers["Range"] = "bytes=0-" + strconv.FormatInt(received-1, 10)
+	}
+}
+
+func (s *Server) uploadFailed(req *Request, err error) *Response {
+	log.Printf("Upload to %v failed: %v", req.URL, err)
+	if errors.Is(err, ErrBodyTooLarge) {
+		return s.newResponse(statusContentTooLarge, responseOptions{req: req, close: true, detail: "the request body is too large"})
+	}
+	return s.newResponse(statusInternalServerError, responseOptions{req: req, close: true, detail: "upload failed"})
+}
+
+// copyBody copies the body of req to w, up to ContentLength bytes, or to
+// its end if it is chunked.
+func copyBody(w io.Writer, req *Request) (int64, error) {
+	if req.ContentLength < 0 {
+		return io.Copy(w, req.Body)
+	}
+	return io.CopyN(w, req.Body, req.ContentLength)
+}
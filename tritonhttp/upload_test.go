@@ -0,0 +1,158 @@
+package tritonhttp
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func putRequest(url, body string, headers ...string) string {
+	raw := "PUT " + url + " HTTP/1.1\r\nHost: uploads\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	for _, h := range headers {
+		raw += h + "\r\n"
+	}
+	return raw + "\r\n" + body
+}
+
+func TestPut(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+	for _, dir := range []string{".git", ".well-known"} {
+		if err := os.Mkdir(filepath.Join(docroot, dir), 0755); err != nil {
+			t.Fatalf("Error creating %v: %v\n", dir, err.Error())
+		}
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		code int
+		file string
+		want string
+	}{
+		{"create", putRequest("/notes.txt", "hello"), 201, "notes.txt", "hello"},
+		{"replace", putRequest("/notes.txt", "bye"), 204, "notes.txt", "bye"},
+		{"dot dot", putRequest("/../escaped.txt", "x"), 201, "escaped.txt", "x"},
+		{"missing directory", putRequest("/nope/a.txt", "x"), 404, "", ""},
+		{"directory", putRequest("/", "x"), 404, "", ""},
+		{"dotfile", putRequest("/.hidden", "x"), 404, "", ""},
+		{"dot directory", putRequest("/.git/config", "x"), 404, "", ""},
+		{"well-known", putRequest("/.well-known/x", "x"), 404, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseResponse(t, serveRaw(t, s, tt.raw+"GET / HTTP/1.1\r\nHost: uploads\r\nConnection: close\r\n\r\n"))
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.file == "" {
+				return
+			}
+			got, err := os.ReadFile(filepath.Join(docroot, tt.file))
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("Expected %v to hold %q but got %q (%v)\n", tt.file, tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestResumablePut(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+
+	steps := []struct {
+		raw       string
+		code      int
+		rangeHave string
+	}{
+		{putRequest("/video.bin", "0123", "Content-Range: bytes 0-3/10"), 202, "bytes=0-3"},
+		// the connection dropped, the client asks where to resume
+		{putRequest("/video.bin", "", "Content-Range: bytes */10"), 202, "bytes=0-3"},
+		// the partial files cannot be fetched
+		{"GET /.video.bin.part HTTP/1.1\r\nHost: uploads\r\n\r\n", 404, ""},
+		{"GET /.video.bin.part.total HTTP/1.1\r\nHost: uploads\r\n\r\n", 404, ""},
+		{putRequest("/video.bin", "6789", "Content-Range: bytes 6-9/10"), 416, "bytes=0-3"},
+		// pieces must agree on the total
+		{putRequest("/video.bin", "45", "Content-Range: bytes 4-5/12"), 400, ""},
+		{putRequest("/video.bin", "45", "Content-Range: bytes 4-5/10"), 202, "bytes=0-5"},
+		{putRequest("/video.bin", "6789", "Content-Range: bytes 6-9/10"), 201, ""},
+	}
+	var raw string
+	for _, step := range steps {
+		raw += step.raw
+	}
+	conn := &scriptedConn{r: strings.NewReader(raw)}
+	s.HandleConnection(conn)
+
+	br := bufio.NewReader(&conn.out)
+	for i, step := range steps {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("got an error parsing response %d: %v\n", i, err.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode != step.code || resp.Header.Get("Range") != step.rangeHave {
+			t.Fatalf("Step %d: expected %v with Range %q but got %v with %q\n", i, step.code, step.rangeHave, resp.StatusCode, resp.Header.Get("Range"))
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(docroot, "video.bin"))
+	if err != nil || string(got) != "0123456789" {
+		t.Fatalf("Unexpected upload %q (%v)\n", got, err)
+	}
+	for _, part := range []string{partPath(filepath.Join(docroot, "video.bin")), partTotalPath(filepath.Join(docroot, "video.bin"))} {
+		if _, err := os.Stat(part); err == nil {
+			t.Fatalf("The partial file %v was left behind\n", part)
+		}
+	}
+}
+
+func TestUploadStatusQuery(t *testing.T) {
+	docroot := t.TempDir()
+	s := &Server{DocRoot: docroot, VirtualHosts: map[string]string{"uploads": docroot}, Uploads: true}
+
+	resp := parseResponse(t, serveRaw(t, s, putRequest("/video.bin", "", "Content-Range: bytes */10", "Connection: close")))
+	if resp.StatusCode != 202 || resp.Header.Get("Range") != "" {
+		t.Fatalf("Expected 202 without Range but got: %v %q\n", resp.StatusCode, resp.Header.Get("Range"))
+	}
+	// asking leaves nothing behind
+	if _, err := os.Stat(partPath(filepath.Join(docroot, "video.bin"))); err == nil {
+		t.Fatal("A status query created a partial file")
+	}
+}
+
+func TestUploadLocks(t *testing.T) {
+	const uploads = 8
+	var wg sync.WaitGroup
+	inside := 0
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := lockUpload("/docroot/a.bin")
+			defer unlock()
+			if inside++; inside != 1 {
+				t.Errorf("Expected uploads to one path to be serialized\n")
+			}
+			inside--
+		}()
+	}
+	wg.Wait()
+
+	uploadLocks.Lock()
+	defer uploadLocks.Unlock()
+	if len(uploadLocks.paths) != 0 {
+		t.Fatalf("Expected no locks once the uploads are done but got %v\n", len(uploadLocks.paths))
+	}
+}
+
+func TestUploadsDisabled(t *testing.T) {
+	resp := parseResponse(t, serveRaw(t, newTestServer(), putRequest("/index.html", "x", "Connection: close")))
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Fatalf("Expected response code of 405 allowing GET and HEAD but got: %v %q\n", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,221 @@
+package tritonhttp
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultMaxUpstreamFails    = 3
+	DefaultUpstreamEjectTime   = 30 * time.Second
+)
+
+// upstreamHealth is what is known about the health of one upstream of a
+// virtual host.
+type upstreamHealth struct {
+	// failing is set while the upstream fails its health checks
+	failing bool
+	// fails counts the consecutive failed requests
+	fails        int
+	ejectedUntil time.Time
+	lastError    string
+}
+
+func (h *upstreamHealth) available(now time.Time) bool {
+	return !h.failing && !now.Before(h.ejectedUntil)
+}
+
+// upstreamPools balances the requests of each virtual host over its
+// upstreams, leaving out the ones that are unhealthy.
+type upstreamPools struct {
+	mu   sync.Mutex
+	next map[string]int
+	// health is keyed by virtual host, then by upstream
+	health map[string]map[string]*upstreamHealth
+}
+
+// healthOf returns the health record of addr in the pool of host. p.mu
+// must be held.
+func (p *upstreamPools) healthOf(host, addr string) *upstreamHealth {
+	if p.health == nil {
+		p.health = make(map[string]map[string]*upstreamHealth)
+	}
+	if p.health[host] == nil {
+		p.health[host] = make(map[string]*upstreamHealth)
+	}
+	h, ok := p.health[host][addr]
+	if !ok {
+		h = &upstreamHealth{}
+		p.health[host][addr] = h
+	}
+	return h
+}
+
+// pick returns the upstream of host to send the next request to, taking
+// the available upstreams in turn. It reports false when none is
+// available.
+func (p *upstreamPools) pick(host string, upstreams []string, now time.Time) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next == nil {
+		p.next = make(map[string]int)
+	}
+	for n := 0; n < len(upstreams); n++ {
+		i := (p.next[host] + n) % len(upstreams)
+		if p.healthOf(host, upstreams[i]).available(now) {
+			p.next[host] = i + 1
+			return upstreams[i], true
+		}
+	}
+	return "", false
+}
+
+// pickFrom returns the first available upstream of host, starting with
+// upstreams[start], without changing the rotation of pick.
+func (p *upstreamPools) pickFrom(host string, upstreams []string, start int, now time.Time) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n := 0; n < len(upstreams); n++ {
+		addr := upstreams[(start+n)%len(upstreams)]
+		if p.healthOf(host, addr).available(now) {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// record notes the outcome of a request to addr for host: err is nil for
+// a success. After maxFails consecutive failures the upstream is ejected
+// until eject has passed.
+func (p *upstreamPools) record(host, addr string, err error, now time.Time, maxFails int, eject time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.healthOf(host, addr)
+	if err == nil {
+		h.fails = 0
+		return
+	}
+	h.fails++
+	h.lastError = err.Error()
+	if h.fails >= maxFails {
+		log.Printf("Ejecting upstream %v of %v for %v: %v", addr, host, eject, err)
+		h.ejectedUntil = now.Add(eject)
+		h.fails = 0
+	}
+}
+
+// checked records the outcome of a health check of addr for host, err
+// being nil if it passed.
+func (p *upstreamPools) checked(host, addr string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.healthOf(host, addr)
+	if err != nil && !h.failing {
+		log.Printf("Upstream %v of %v failed its health check: %v", addr, host, err)
+	}
+	h.failing = err != nil
+	if err != nil {
+		h.lastError = err.Error()
+	}
+}
+
+// UpstreamStatus describes the health of one upstream of a virtual host.
+type UpstreamStatus struct {
+	Addr      string `json:"addr"`
+	Available bool   `json:"available"`
+	// HealthCheckFailing is set while the upstream fails its health checks
+	HealthCheckFailing bool `json:"healthCheckFailing"`
+	// Fails counts the consecutive failed requests since the last success
+	Fails        int       `json:"fails"`
+	EjectedUntil time.Time `json:"ejectedUntil,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// UpstreamStatus returns the health of the upstreams of every virtual host
+// that has some, keyed by host name.
+func (s *Server) UpstreamStatus() map[string][]UpstreamStatus {
+	now := s.now()
+	status := make(map[string][]UpstreamStatus)
+	s.upstreams.mu.Lock()
+	defer s.upstreams.mu.Unlock()
+	for host, settings := range s.hostSettings() {
+		for _, addr := range settings.Upstreams {
+			h := s.upstreams.healthOf(host, addr)
+			us := UpstreamStatus{
+				Addr:               addr,
+				Available:          h.available(now),
+				HealthCheckFailing: h.failing,
+				Fails:              h.fails,
+				LastError:          h.lastError,
+			}
+			if now.Before(h.ejectedUntil) {
+				us.EjectedUntil = h.ejectedUntil
+			}
+			status[host] = append(status[host], us)
+		}
+	}
+	for _, list := range status {
+		sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	}
+	return status
+}
+
+// fetchFromPool sends upstream to addr, one of the upstreams of host, and
+// records the outcome for passive health checking: connection errors and
+// 5xx responses count as failures.
+func (s *Server) fetchFromPool(host, addr string, upstream *Request) (*Response, error) {
+	res, err := s.fetchUpstream(addr, upstream)
+	outcome := err
+	if err == nil && res.StatusCode >= 500 {
+		outcome = badStringError("upstream answered", res.StatusText)
+	}
+	maxFails, eject := s.MaxUpstreamFails, s.UpstreamEjectTime
+	if maxFails == 0 {
+		maxFails = DefaultMaxUpstreamFails
+	}
+	if eject == 0 {
+		eject = DefaultUpstreamEjectTime
+	}
+	s.upstreams.record(host, addr, outcome, s.now(), maxFails, eject)
+	return res, err
+}
+
+// CheckUpstreams runs one round of health checks: the HealthCheck path of
+// every virtual host that has one is requested from each of its upstreams,
+// and upstreams that fail to answer with a status below 400 are left out
+// of their pool until they pass again. Serve runs it periodically.
+func (s *Server) CheckUpstreams() {
+	var wg sync.WaitGroup
+	for host, settings := range s.hostSettings() {
+		if settings.HealthCheck == "" {
+			continue
+		}
+		for _, addr := range settings.Upstreams {
+			wg.Add(1)
+			go func(host, path, addr string) {
+				defer wg.Done()
+				req := NewRequest(host, path)
+				req.Close = true
+				res, err := s.fetchUpstream(addr, req)
+				if err == nil && res.StatusCode >= 400 {
+					err = badStringError("health check answered", res.StatusText)
+				}
+				s.upstreams.checked(host, addr, err)
+			}(host, settings.HealthCheck, addr)
+		}
+	}
+	wg.Wait()
+}
+
+// startHealthChecks runs CheckUpstreams every HealthCheckInterval until the
+// returned function has been called as many times as startHealthChecks.
+func (s *Server) startHealthChecks() (stop func()) {
+	interval := s.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	return s.healthChecks.start(interval, s.CheckUpstreams)
+}
@@ -0,0 +1,90 @@
+package tritonhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpstreamHealth(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "good")
+	}))
+	defer good.Close()
+	// an address nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v\n", err.Error())
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+	goodAddr := strings.TrimPrefix(good.URL, "http://")
+
+	now := time.Date(2023, time.February, 1, 12, 30, 0, 0, time.UTC)
+	s := newTestServer()
+	s.Now = func() time.Time { return now }
+	s.VirtualHostSettings = map[string]VirtualHostSettings{
+		"proxied": {Upstreams: []string{dead, goodAddr}, HealthCheck: "/health"},
+	}
+	s.MaxUpstreamFails = 1
+	s.UpstreamEjectTime = time.Minute
+	s.HandleAdmin("/_admin/")
+
+	get := func(url string) (int, string) {
+		conn := &scriptedConn{r: strings.NewReader("GET " + url + " HTTP/1.1\r\nHost: proxied\r\nConnection: close\r\n\r\n")}
+		s.HandleConnection(conn)
+		resp := parseResponse(t, conn.out.String())
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Error reading response body: %v\n", err.Error())
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	// passive: the dead upstream fails once and is ejected
+	if code, _ := get("/"); code != 502 {
+		t.Fatalf("Expected 502 from the dead upstream but got %v\n", code)
+	}
+	for i := 0; i < 3; i++ {
+		if code, body := get("/"); code != 200 || body != "good" {
+			t.Fatalf("Expected the good upstream but got %v %q\n", code, body)
+		}
+	}
+
+	var status map[string][]UpstreamStatus
+	_, body := get("/_admin/upstreams")
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatalf("Error decoding upstream status: %v\n", err.Error())
+	}
+	for _, us := range status["proxied"] {
+		if (us.Addr == dead) == us.Available {
+			t.Fatalf("Unexpected status %+v\n", us)
+		}
+	}
+
+	// active: the good upstream fails its check while the dead one is
+	// still ejected, leaving nothing to serve
+	healthy.Store(false)
+	s.CheckUpstreams()
+	if code, _ := get("/"); code != 503 {
+		t.Fatalf("Expected 503 without available upstreams but got %v\n", code)
+	}
+	healthy.Store(true)
+	s.CheckUpstreams()
+	now = now.Add(2 * time.Minute)
+	if code, body := get("/"); code != 200 || body != "good" {
+		t.Fatalf("Expected the good upstream after recovering but got %v %q\n", code, body)
+	}
+}
@@ -2,15 +2,57 @@ package tritonhttp
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
-	"fmt"
-	"io"
 	"mime"
+	"net"
 	"net/textproto"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// periodicTask runs a function at an interval for as long as some caller,
+// typically a Serve call, needs it.
+type periodicTask struct {
+	mu   sync.Mutex
+	runs int
+	stop chan struct{}
+}
+
+// start runs fn now and then every interval, unless the task already runs,
+// until the returned function has been called as many times as start.
+func (t *periodicTask) start(interval time.Duration, fn func()) (stop func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runs++
+	if t.runs == 1 {
+		done := make(chan struct{})
+		t.stop = done
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				fn()
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.runs--
+		if t.runs == 0 {
+			close(t.stop)
+		}
+	}
+}
+
 // CanonicalHeaderKey returns the canonical format of the
 // header key s. The canonicalization converts the first
 // letter and any letter following a hyphen to upper case;
@@ -32,6 +74,28 @@ func FormatTime(t time.Time) string {
 	return s
 }
 
+// timeFormat is the layout of the times written by FormatTime.
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// timeFormats are the layouts of the dates HTTP allows: the IMF-fixdate of
+// FormatTime, and the obsolete RFC 850 and asctime formats recipients must
+// still accept.
+var timeFormats = []string{timeFormat, "Monday, 02-Jan-06 15:04:05 GMT", time.ANSIC}
+
+// ParseTime parses an HTTP date, as found in the "Date", "Last-Modified"
+// and "If-Modified-Since" headers, in any of the three formats of RFC 9110.
+// The time returned is in UTC.
+func ParseTime(text string) (time.Time, error) {
+	var err error
+	for _, layout := range timeFormats {
+		var t time.Time
+		if t, err = time.Parse(layout, text); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
 // MIMETypeByExtension returns the MIME type associated with the
 // file extension ext. The extension ext should begin with a
 // leading dot, as in ".html". When ext has no associated type,
@@ -46,23 +110,120 @@ func MIMETypeByExtension(ext string) string {
 // If any error occurs, data read before the error is also returned.
 // You might find this function useful in parsing requests.
 func ReadLine(br *bufio.Reader) (string, error) {
-	var line string
+	return readLineLimit(br, 0)
+}
+
+// errLineTooLong is returned by readLineLimit when a line exceeds its limit.
+var errLineTooLong = errors.New("line too long")
+
+// readLineLimit is ReadLine with a cap of max bytes on the line, including
+// the line end. It stops reading as soon as the cap is exceeded instead of
+// buffering the whole line. A max of 0 means no limit.
+func readLineLimit(br *bufio.Reader, max int) (string, error) {
+	var line []byte
 	for {
-		s, err := br.ReadString('\n')
-		if errors.Is(err, io.EOF) {
-			return "", nil
+		s, err := br.ReadSlice('\n')
+		line = append(line, s...)
+		if max > 0 && len(line) > max {
+			return string(line[:max]), errLineTooLong
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
 		}
-		line += s
 		// Return the error
 		if err != nil {
-			fmt.Printf("Error occurred while reading line %s\nError %s", line, err.Error())
-			return line, err
+			return string(line), err
 		}
 		// Return the line when reaching line end
-		if strings.HasSuffix(line, "\r\n") {
+		if bytes.HasSuffix(line, []byte("\r\n")) {
 			// Striping the line end
-			line = line[:len(line)-2]
-			return line, nil
+			return string(line[:len(line)-2]), nil
+		}
+	}
+}
+
+// parseTokenList splits a comma-separated header value such as
+// "keep-alive, Upgrade" into its lower-cased tokens, dropping empty
+// elements.
+func parseTokenList(value string) []string {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.ToLower(strings.Trim(token, " \t"))
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// weightedValue is one element of a list such as "gzip;q=0.8, br".
+type weightedValue struct {
+	value string
+	q     float64
+}
+
+// parseWeightedList parses a header listing values with optional quality
+// weights (RFC 7231 section 5.3.1), e.g. Accept-Charset. Values are
+// lower-cased; a missing or malformed weight counts as 1. The list keeps
+// the order of the header.
+func parseWeightedList(header string) []weightedValue {
+	var list []weightedValue
+	for _, element := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(element, ";")
+		value = strings.ToLower(strings.Trim(value, " \t"))
+		if value == "" {
+			continue
+		}
+		wv := weightedValue{value: value, q: 1}
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.Trim(k, " \t"), "q") {
+				if q, err := strconv.ParseFloat(strings.Trim(v, " \t"), 64); err == nil && q >= 0 && q <= 1 {
+					wv.q = q
+				}
+			}
+		}
+		list = append(list, wv)
+	}
+	return list
+}
+
+// weightOf returns the weight list gives value, falling back to the weight
+// of "*" and to 0 for values the list doesn't mention.
+func weightOf(list []weightedValue, value string) float64 {
+	wildcard := 0.0
+	for _, wv := range list {
+		switch wv.value {
+		case value:
+			return wv.q
+		case "*":
+			wildcard = wv.q
+		}
+	}
+	return wildcard
+}
+
+// mediaTypeMatches reports whether contentType, the value of a
+// "Content-Type" header, is of type t: a MIME type such as "image/svg+xml",
+// a type prefix such as "text/", or "*/*" for any type.
+func mediaTypeMatches(contentType, t string) bool {
+	return t == "*/*" || (strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t)) ||
+		contentType == t || strings.HasPrefix(contentType, t+";")
+}
+
+// isTimeout reports whether err was caused by an expired deadline.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// containsToken reports whether tokens, as returned by parseTokenList,
+// contains token.
+func containsToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
 		}
 	}
+	return false
 }
@@ -5,19 +5,115 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type VHConfigs struct {
-	VirtualHosts []struct {
-		HostName string `yaml:"hostName"`
-		DocRoot  string `yaml:"docRoot"`
-	} `yaml:"virtual_hosts"`
+	// Listen lists more "host:port" addresses to listen on, see
+	// Server.ListenAddrs
+	Listen       []string   `yaml:"listen"`
+	VirtualHosts []VHConfig `yaml:"virtual_hosts"`
 }
 
-func ParseVHConfigFile(vhConfigFilePath string, docroot_dirs_path string) map[string]string {
-	vh_map := make(map[string]string)
+// VHConfig is the configuration of a single virtual host.
+type VHConfig struct {
+	HostName string `yaml:"hostName"`
+	DocRoot  string `yaml:"docRoot"`
+
+	// EarlyHints lists "Link" header values, e.g.
+	// "</style.css>; rel=preload; as=style", announced to clients in a
+	// 103 Early Hints response to each GET request, ahead of the response
+	EarlyHints []string `yaml:"earlyHints"`
+
+	// Upstreams lists the "host:port" of servers the requests for the host
+	// are forwarded to, in turn, instead of being served from DocRoot
+	Upstreams []string `yaml:"upstreams"`
+	// HealthCheck is the path periodically requested from each upstream
+	// to tell whether it is healthy
+	HealthCheck string `yaml:"healthCheck"`
+	// Affinity keeps each client on one upstream: "cookie" or "ip", see
+	// VirtualHostSettings.Affinity
+	Affinity string `yaml:"affinity"`
+
+	// DailyQuota and MonthlyQuota limit the bytes sent for the host per
+	// day and per month, see VirtualHostSettings
+	DailyQuota   int64 `yaml:"dailyQuota"`
+	MonthlyQuota int64 `yaml:"monthlyQuota"`
+
+	// MissingIndex is the answer for directories without index.html:
+	// "404", "403" or "autoindex", see VirtualHostSettings
+	MissingIndex string `yaml:"missingIndex"`
+	// SPA serves /index.html for missing paths without an extension, see
+	// VirtualHostSettings
+	SPA bool `yaml:"spa"`
+	// ETag is the ETag strategy of the host: "mtime", "hash", "weak" or
+	// "strong", see VirtualHostSettings
+	ETag string `yaml:"etag"`
+	// CachePolicy maps file extensions, e.g. ".css", and path prefixes,
+	// e.g. "/static/", to "Cache-Control" values, see
+	// Server.CachePolicy
+	CachePolicy map[string]string `yaml:"cachePolicy"`
+	// HSTSMaxAge, in seconds, HSTSIncludeSubDomains and HSTSPreload make
+	// the host send a "Strict-Transport-Security" header over HTTPS, see
+	// VirtualHostSettings.HSTS
+	HSTSMaxAge            int64 `yaml:"hstsMaxAge"`
+	HSTSIncludeSubDomains bool  `yaml:"hstsIncludeSubDomains"`
+	HSTSPreload           bool  `yaml:"hstsPreload"`
+}
+
+// VirtualHostSettings holds the per-host settings of a virtual host, other
+// than its docroot.
+type VirtualHostSettings struct {
+	// EarlyHints lists the "Link" header values sent in a 103 Early Hints
+	// response to every GET request of the host, before the request is
+	// handled.
+	EarlyHints []string
+	// Upstreams makes the server a reverse proxy for the host: requests
+	// are forwarded to these "host:port" servers, taken in turn, and
+	// their responses relayed.
+	Upstreams []string
+	// HealthCheck is a path requested from every upstream each
+	// Server.HealthCheckInterval; upstreams answering with an error, or
+	// not at all, get no requests until they pass a check again.
+	HealthCheck string
+	// Affinity makes the requests of a client go to the same upstream, for
+	// backends that keep state between requests. AffinityCookie pins a
+	// client with a cookie naming its upstream, AffinityIP by a hash of
+	// its IP address. Empty means the upstreams are taken in turn. A client
+	// whose upstream is unavailable moves to another one.
+	Affinity string
+	// DailyQuota and MonthlyQuota limit the bytes sent for the host in a
+	// calendar day and month, in UTC. Once a quota is used up, requests
+	// for the host are answered with 509 Bandwidth Limit Exceeded until
+	// the next period starts. Zero means no limit.
+	DailyQuota   int64
+	MonthlyQuota int64
+	// MissingIndex is the answer to a request for a directory that has no
+	// index.html: MissingIndexNotFound (404, the default),
+	// MissingIndexForbidden (403) or MissingIndexAutoIndex, a generated
+	// HTML listing of the directory, leaving out hidden entries.
+	MissingIndex string
+	// SPA hosts a single-page application, which routes URLs on the
+	// client: a GET request for a path that names no file and has no
+	// file extension, e.g. "/users/42", is answered with /index.html and
+	// 200 instead of 404. Missing files such as "/app.js" still get 404.
+	SPA bool
+	// ETag names the strategy computing the entity tags of the files of
+	// the host: ETagModTime (the default), ETagContentHash, ETagWeak,
+	// ETagStrong, or one added to Server.ETagFuncs.
+	ETag string
+	// CachePolicy sets the "Cache-Control" header of the files of the
+	// host, as Server.CachePolicy, which it takes precedence over.
+	CachePolicy map[string]string
+	// HSTS is sent in the "Strict-Transport-Security" header of every
+	// response of the host to a request over TLS, including HTTP/2 and
+	// HTTP/3.
+	HSTS HSTSPolicy
+}
+
+func readVHConfigFile(vhConfigFilePath string) VHConfigs {
 	f, err := ioutil.ReadFile(vhConfigFilePath)
 
 	if err != nil {
@@ -25,9 +121,21 @@ func ParseVHConfigFile(vhConfigFilePath string, docroot_dirs_path string) map[st
 	}
 
 	vhostConfigs := VHConfigs{}
-	err = yaml.Unmarshal(f, &vhostConfigs)
+	if err := yaml.Unmarshal(f, &vhostConfigs); err != nil {
+		log.Fatalf("could not parse config file %s : %v", vhConfigFilePath, err)
+	}
+	return vhostConfigs
+}
+
+func ParseVHConfigFile(vhConfigFilePath string, docroot_dirs_path string) map[string]string {
+	vh_map := make(map[string]string)
+	vhostConfigs := readVHConfigFile(vhConfigFilePath)
 
 	for _, vhost := range vhostConfigs.VirtualHosts {
+		if vhost.DocRoot == "" && len(vhost.Upstreams) > 0 {
+			// proxied hosts need no docroot
+			continue
+		}
 		docroot_path := filepath.Join(docroot_dirs_path, vhost.DocRoot)
 
 		// Check if the path exists
@@ -40,3 +148,35 @@ func ParseVHConfigFile(vhConfigFilePath string, docroot_dirs_path string) map[st
 
 	return vh_map
 }
+
+// ParseVHSettingsFile reads the per-host settings from the virtual hosting
+// config file, for use as Server.VirtualHostSettings.
+func ParseVHSettingsFile(vhConfigFilePath string) map[string]VirtualHostSettings {
+	settings := make(map[string]VirtualHostSettings)
+	for _, vhost := range readVHConfigFile(vhConfigFilePath).VirtualHosts {
+		settings[vhost.HostName] = VirtualHostSettings{
+			EarlyHints:   vhost.EarlyHints,
+			Upstreams:    vhost.Upstreams,
+			HealthCheck:  vhost.HealthCheck,
+			Affinity:     vhost.Affinity,
+			DailyQuota:   vhost.DailyQuota,
+			MonthlyQuota: vhost.MonthlyQuota,
+			MissingIndex: vhost.MissingIndex,
+			SPA:          vhost.SPA,
+			ETag:         vhost.ETag,
+			CachePolicy:  vhost.CachePolicy,
+			HSTS: HSTSPolicy{
+				MaxAge:            time.Duration(vhost.HSTSMaxAge) * time.Second,
+				IncludeSubDomains: vhost.HSTSIncludeSubDomains,
+				Preload:           vhost.HSTSPreload,
+			},
+		}
+	}
+	return settings
+}
+
+// ParseListenAddrs returns the addresses listed under "listen" in the config
+// file.
+func ParseListenAddrs(vhConfigFilePath string) []string {
+	return readVHConfigFile(vhConfigFilePath).Listen
+}
@@ -0,0 +1,141 @@
+package tritonhttp
+
+import (
+	"encoding/xml"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEPTH = "depth"
+
+	davContentType = "application/xml; charset=utf-8"
+	// davAllow lists the methods served when WebDAV is enabled
+	davAllow = "GET, HEAD, OPTIONS, PROPFIND"
+)
+
+// davMultistatus is the body of a 207 Multi-Status response
+// (RFC 4918 section 14.16).
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	XMLNS     string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+// davProp holds the live properties reported for every resource.
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength string          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// davResponseFor describes the file or directory info found at href.
+func davResponseFor(href string, info os.FileInfo) davResponse {
+	prop := davProp{
+		DisplayName:  info.Name(),
+		LastModified: FormatTime(info.ModTime()),
+	}
+	if info.IsDir() {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		prop.ContentLength = strconv.FormatInt(info.Size(), 10)
+		prop.ContentType = MIMETypeByExtension(filepath.Ext(info.Name()))
+	}
+	return davResponse{
+		Href: href,
+		Propstat: davPropstat{
+			Prop:   prop,
+			Status: responseProto + " 200 " + statusText[statusOK],
+		},
+	}
+}
+
+// handlePropfind answers a PROPFIND request with the metadata of the target
+// and, for "Depth: 1" on a directory, of its entries. Any request body is
+// ignored: all properties are always reported. The tree is read-only, so
+// no other WebDAV method is supported.
+func (s *Server) handlePropfind(req *Request) *Response {
+	depth := req.Headers[DEPTH]
+	if depth != "0" && depth != "1" {
+		// a missing Depth means infinity, which could walk the whole docroot
+		return s.newResponse(statusForbidden, responseOptions{req: req, detail: "PROPFIND is only supported with Depth 0 or 1"})
+	}
+	filelocation, info, err := s.resolvePath(req)
+	if err != nil {
+		log.Printf("Not found: %v", err)
+		return s.newResponse(statusNotFound, responseOptions{req: req, detail: "no resource found at " + req.URL})
+	}
+
+	href := req.URL
+	if i := strings.IndexByte(href, '?'); i >= 0 {
+		href = href[:i]
+	}
+	if info.IsDir() && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	ms := davMultistatus{XMLNS: "DAV:"}
+	ms.Responses = append(ms.Responses, davResponseFor(href, info))
+	if depth == "1" && info.IsDir() {
+		entries, err := os.ReadDir(filelocation)
+		if err != nil {
+			log.Printf("Failed to list %v: %v", filelocation, err)
+			return s.newResponse(statusInternalServerError, responseOptions{req: req, detail: "could not list " + href})
+		}
+		for _, entry := range entries {
+			// dot files such as .DS_Store are metadata, not content
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			entryInfo, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			entryHref := href + (&url.URL{Path: entry.Name()}).EscapedPath()
+			if entry.IsDir() {
+				entryHref += "/"
+			}
+			ms.Responses = append(ms.Responses, davResponseFor(entryHref, entryInfo))
+		}
+	}
+
+	body, err := xml.Marshal(ms)
+	if err != nil {
+		log.Printf("Failed to build multistatus body: %v", err)
+		return s.newResponse(statusInternalServerError, responseOptions{req: req, detail: err.Error()})
+	}
+	res := s.newResponse(statusMultiStatus, responseOptions{req: req})
+	res.Body = xml.Header + string(body)
+	res.Headers["Content-Type"] = davContentType
+	res.ContentLength = int64(len(res.Body))
+	return res
+}
+
+// handleOptions tells WebDAV clients which methods are available; they
+// check for the "DAV" header before mounting the tree.
+func (s *Server) handleOptions(req *Request) *Response {
+	res := s.newResponse(statusOK, responseOptions{req: req})
+	res.Headers["Allow"] = davAllow
+	res.Headers["Dav"] = "1"
+	res.Headers["Ms-Author-Via"] = "DAV"
+	return res
+}
@@ -0,0 +1,81 @@
+package tritonhttp
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// multistatus is the client view of a 207 Multi-Status body.
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+		Prop struct {
+			ContentLength string    `xml:"DAV: getcontentlength"`
+			Collection    *struct{} `xml:"DAV: resourcetype>collection"`
+		} `xml:"DAV: propstat>prop"`
+	} `xml:"DAV: response"`
+}
+
+func TestPropfind(t *testing.T) {
+	const propfindBody = `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`
+	tests := []struct {
+		name  string
+		raw   string
+		code  int
+		hrefs []string
+	}{
+		{"file", "PROPFIND /index.html HTTP/1.1\r\nHost: website1\r\nDepth: 0\r\n\r\n", 207, []string{"/index.html"}},
+		{"directory listing", "PROPFIND /subdir HTTP/1.1\r\nHost: website1\r\nDepth: 1\r\nContent-Type: application/xml\r\nContent-Length: " +
+			strconv.Itoa(len(propfindBody)) + "\r\n\r\n" + propfindBody, 207, []string{"/subdir/", "/subdir/index.html", "/subdir/subsubdir/"}},
+		{"missing", "PROPFIND /missing HTTP/1.1\r\nHost: website1\r\nDepth: 0\r\n\r\n", 404, nil},
+		{"infinite depth", "PROPFIND / HTTP/1.1\r\nHost: website1\r\n\r\n", 403, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.WebDAV = true
+			resp := parseResponse(t, serveRaw(t, s, tt.raw+"GET / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("Expected response code of %v but got: %v\n", tt.code, resp.StatusCode)
+			}
+			if tt.code != 207 {
+				return
+			}
+			var ms multistatus
+			if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+				t.Fatalf("Error decoding multistatus body: %v\n", err.Error())
+			}
+			var hrefs []string
+			for _, r := range ms.Responses {
+				hrefs = append(hrefs, r.Href)
+				if isDir := strings.HasSuffix(r.Href, "/"); isDir != (r.Prop.Collection != nil) || isDir != (r.Prop.ContentLength == "") {
+					t.Fatalf("Unexpected properties for %v: %+v\n", r.Href, r.Prop)
+				}
+			}
+			if strings.Join(hrefs, " ") != strings.Join(tt.hrefs, " ") {
+				t.Fatalf("Expected resources %v but got %v\n", tt.hrefs, hrefs)
+			}
+		})
+	}
+}
+
+func TestWebDAVOptions(t *testing.T) {
+	s := newTestServer()
+	s.WebDAV = true
+	resp := parseResponse(t, serveRaw(t, s, "OPTIONS / HTTP/1.1\r\nHost: website1\r\nConnection: close\r\n\r\n"))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != 200 || resp.Header.Get("DAV") != "1" || !strings.Contains(resp.Header.Get("Allow"), "PROPFIND") {
+		t.Fatalf("Unexpected OPTIONS response %v %v\n", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestWebDAVDisabled(t *testing.T) {
+	resp := parseResponse(t, serveRaw(t, newTestServer(), "PROPFIND / HTTP/1.1\r\nHost: website1\r\nDepth: 0\r\nConnection: close\r\n\r\n"))
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Fatalf("Expected a 405 allowing GET and HEAD but got %v %q\n", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}